@@ -0,0 +1,350 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ghsbhatia/msgbox/pkg/msgstore"
+)
+
+// Prefix of an addressee naming a group instead of a user
+const groupPrefix = "group:"
+
+// Delay before subscribing again when the event stream ends
+const reconnectDelay = 2 * time.Second
+
+func send(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet("send")
+	to := fs.String("to", "", "comma separated addressees, group:<name> for a group")
+	cc := fs.String("cc", "", "comma separated addressees copied")
+	bcc := fs.String("bcc", "", "comma separated addressees copied blindly")
+	subject := fs.String("subject", "", "subject of message")
+	body := fs.String("body", "", "body of message")
+	if _, err := parseArgs(fs, args, 0, 0); err != nil {
+		return err
+	}
+	user, err := e.mailboxUser()
+	if err != nil {
+		return err
+	}
+	if len(*to) == 0 {
+		return errors.New("send: no addressee given, set -to")
+	}
+
+	msg := msgstore.Message{
+		Sender:  user,
+		To:      receiversOf(*to),
+		Cc:      receiversOf(*cc),
+		Bcc:     receiversOf(*bcc),
+		Subject: *subject,
+		Body:    *body,
+	}
+	id, err := e.messages.StoreMessage(ctx, msg)
+	if err != nil {
+		return err
+	}
+	return e.out.printLine(map[string]string{"id": id}, "sent message %s", id)
+}
+
+func reply(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet("reply")
+	subject := fs.String("subject", "", "subject of reply")
+	body := fs.String("body", "", "body of reply")
+	pos, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	user, err := e.mailboxUser()
+	if err != nil {
+		return err
+	}
+
+	msg := msgstore.Message{Re: pos[0], Sender: user, Subject: *subject, Body: *body}
+	id, err := e.messages.StoreMessage(ctx, msg)
+	if err != nil {
+		return err
+	}
+	return e.out.printLine(map[string]string{"id": id}, "sent reply %s", id)
+}
+
+func show(ctx context.Context, e *env, args []string) error {
+	pos, err := parseArgs(newFlagSet("show"), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	msg, err := e.messages.GetMessage(ctx, pos[0])
+	if err != nil {
+		return err
+	}
+	if e.out.format == outputJSON {
+		return e.out.print(msg, nil, nil)
+	}
+	fields := [][]string{
+		{"Id:", msg.Id},
+		{"Re:", msg.Re},
+		{"From:", senderOf(msg)},
+		{"To:", addresseesOf(msg)},
+		{"Bcc:", receiverNames(msg.Bcc)},
+		{"Sent:", msg.Timestamp},
+		{"Subject:", msg.Subject},
+	}
+	var rows [][]string
+	for _, field := range fields {
+		if len(field[1]) > 0 {
+			rows = append(rows, field)
+		}
+	}
+	if err := e.out.print(nil, nil, rows); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(e.out.w, "\n%s\n", msg.Body)
+	return err
+}
+
+func mailbox(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet("mailbox")
+	query := pageQueryFlags(fs)
+	fs.BoolVar(&query.Unread, "unread", false, "list only unread messages")
+	fs.BoolVar(&query.Archived, "archived", false, "list archived messages instead of mailbox")
+	fs.StringVar(&query.From, "from", "", "list only messages sent by user")
+	fs.StringVar(&query.Group, "group", "", "list only messages sent to group")
+	since := fs.String("since", "", "list only messages sent at or after time, as 2006-01-02 or RFC 3339")
+	until := fs.String("until", "", "list only messages sent before time, as 2006-01-02 or RFC 3339")
+	fs.BoolVar(&query.RepliesOnly, "replies", false, "list only replies")
+	fs.BoolVar(&query.RootsOnly, "roots", false, "list only messages that are not replies")
+	if _, err := parseArgs(fs, args, 0, 0); err != nil {
+		return err
+	}
+	user, err := e.mailboxUser()
+	if err != nil {
+		return err
+	}
+	if query.Since, err = parseTime("since", *since); err != nil {
+		return err
+	}
+	if query.Until, err = parseTime("until", *until); err != nil {
+		return err
+	}
+
+	msgs, next, err := e.messages.GetMessagesPage(ctx, user, *query)
+	if err != nil {
+		return err
+	}
+	return e.out.printPage(messagePage{msgs, next}, next, messageHeader, messageRows(msgs))
+}
+
+func sent(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet("sent")
+	query := pageQueryFlags(fs)
+	if _, err := parseArgs(fs, args, 0, 0); err != nil {
+		return err
+	}
+	user, err := e.mailboxUser()
+	if err != nil {
+		return err
+	}
+	msgs, next, err := e.messages.GetSentMessages(ctx, user, *query)
+	if err != nil {
+		return err
+	}
+	return e.out.printPage(messagePage{msgs, next}, next, messageHeader, messageRows(msgs))
+}
+
+func search(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet("search")
+	limit := fs.Int("limit", 0, "maximum number of messages, default of service when zero")
+	pos, err := parseArgs(fs, args, 1, -1)
+	if err != nil {
+		return err
+	}
+	user, err := e.mailboxUser()
+	if err != nil {
+		return err
+	}
+	matches, err := e.messages.SearchMessages(ctx, user, msgstore.SearchQuery{Text: strings.Join(pos, " "), Limit: *limit})
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, 0, len(matches))
+	for _, match := range matches {
+		rows = append(rows, append(messageRow(match.Message), strconv.FormatFloat(match.Score, 'f', 2, 64)))
+	}
+	return e.out.print(matches, append(messageHeader, "SCORE"), rows)
+}
+
+func unreadCount(ctx context.Context, e *env, args []string) error {
+	if _, err := parseArgs(newFlagSet("unread"), args, 0, 0); err != nil {
+		return err
+	}
+	user, err := e.mailboxUser()
+	if err != nil {
+		return err
+	}
+	count, err := e.messages.GetUnreadCount(ctx, user)
+	if err != nil {
+		return err
+	}
+	return e.out.printLine(map[string]int64{"unread": count}, "%d", count)
+}
+
+func markRead(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet("read")
+	unread := fs.Bool("unread", false, "mark messages unread instead")
+	pos, err := parseArgs(fs, args, 1, -1)
+	if err != nil {
+		return err
+	}
+	if *unread {
+		return applyToMessages(ctx, e, pos, e.messages.MarkUnread, "marked %s unread")
+	}
+	return applyToMessages(ctx, e, pos, e.messages.MarkRead, "marked %s read")
+}
+
+func archive(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet("archive")
+	undo := fs.Bool("undo", false, "move messages back to mailbox instead")
+	pos, err := parseArgs(fs, args, 1, -1)
+	if err != nil {
+		return err
+	}
+	if *undo {
+		return applyToMessages(ctx, e, pos, e.messages.UnarchiveMessage, "moved %s back to mailbox")
+	}
+	return applyToMessages(ctx, e, pos, e.messages.ArchiveMessage, "archived %s")
+}
+
+func deleteMessages(ctx context.Context, e *env, args []string) error {
+	pos, err := parseArgs(newFlagSet("delete"), args, 1, -1)
+	if err != nil {
+		return err
+	}
+	return applyToMessages(ctx, e, pos, e.messages.DeleteMessage, "deleted %s")
+}
+
+// Apply an action to given messages in mailbox and report what was done to
+// each of them. Stops at the first message the action fails on.
+func applyToMessages(ctx context.Context, e *env, msgids []string,
+	action func(context.Context, string, string) error, done string) error {
+	user, err := e.mailboxUser()
+	if err != nil {
+		return err
+	}
+	for _, msgid := range msgids {
+		if err := action(ctx, user, msgid); err != nil {
+			return fmt.Errorf("%s: %v", msgid, err)
+		}
+		if err := e.out.printLine(map[string]string{"id": msgid}, done, msgid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func thread(ctx context.Context, e *env, args []string) error {
+	pos, err := parseArgs(newFlagSet("thread"), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	t, err := e.messages.GetThread(ctx, pos[0])
+	if err != nil {
+		return err
+	}
+	return e.out.print(t, messageHeader, threadRows(nil, t))
+}
+
+// Get table rows of a thread, subjects of replies indented by their depth
+func threadRows(rows [][]string, t msgstore.Thread) [][]string {
+	row := messageRow(t.Message)
+	row[len(row)-1] = strings.Repeat("  ", t.Depth) + row[len(row)-1]
+	rows = append(rows, row)
+	for _, r := range t.Replies {
+		rows = threadRows(rows, r)
+	}
+	return rows
+}
+
+func tail(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet("tail")
+	last := fs.Uint64("last-event", 0, "id of last event seen, to get the events that followed it")
+	if _, err := parseArgs(fs, args, 0, 0); err != nil {
+		return err
+	}
+	user, err := e.mailboxUser()
+	if err != nil {
+		return err
+	}
+
+	// Follow events until interrupted, subscribing again after the last event
+	// whenever the stream ends
+	for {
+		events, err := e.messages.SubscribeEvents(ctx, user, *last)
+		if err != nil {
+			return err
+		}
+		for ev := range events {
+			if err := e.out.printEvent(ev); err != nil {
+				return err
+			}
+			*last = ev.Id
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+// Page of messages as printed in json
+type messagePage struct {
+	Messages   []msgstore.Message `json:"messages"`
+	NextCursor string             `json:"next_cursor,omitempty"`
+}
+
+// Register flags of a page of messages
+func pageQueryFlags(fs *flag.FlagSet) *msgstore.MailboxQuery {
+	var query msgstore.MailboxQuery
+	fs.IntVar(&query.Limit, "limit", 0, "maximum number of messages, default page size of service when zero")
+	fs.StringVar(&query.Cursor, "cursor", "", "cursor of page as printed with previous page")
+	return &query
+}
+
+// Get receivers of comma separated addressees, groups prefixed with group:
+func receiversOf(addressees string) []msgstore.Receiver {
+	var receivers []msgstore.Receiver
+	for _, name := range strings.Split(addressees, ",") {
+		name = strings.TrimSpace(name)
+		switch {
+		case len(name) == 0:
+		case strings.HasPrefix(name, groupPrefix):
+			receivers = append(receivers, msgstore.Receiver{Groupname: strings.TrimPrefix(name, groupPrefix)})
+		default:
+			receivers = append(receivers, msgstore.Receiver{Username: name})
+		}
+	}
+	return receivers
+}
+
+func receiverNames(receivers []msgstore.Receiver) string {
+	return addresseesOf(msgstore.Message{To: receivers})
+}
+
+// Parse time of given flag as a date or RFC 3339 time, zero when not given
+func parseTime(name string, value string) (time.Time, error) {
+	if len(value) == 0 {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return t, fmt.Errorf("-%s: %q is neither a date nor an RFC 3339 time", name, value)
+	}
+	return t, nil
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+
+	jwt "github.com/dgrijalva/jwt-go"
+
+	"github.com/ghsbhatia/msgbox/pkg/client"
+	"github.com/ghsbhatia/msgbox/pkg/msgstore"
+	"github.com/ghsbhatia/msgbox/pkg/useradmin"
+)
+
+const (
+	defaultUserServiceUrl = "http://localhost:6060"
+	defaultMsgServiceUrl  = "http://localhost:6080"
+	defaultOutput         = outputTable
+)
+
+// Environment of a command: clients of the services, the user on whose behalf
+// messages are sent and read, and the printer of results.
+type env struct {
+	users    useradmin.Service
+	messages msgstore.Service
+	user     string
+	out      *printer
+}
+
+// Command of msgboxctl run with its remaining arguments
+type command struct {
+	usage string
+	help  string
+	run   func(ctx context.Context, e *env, args []string) error
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"user-register":   {"<username> [-name <display name>] [-email <email>] [-attr <key=value>]...", "register a user", userRegister},
+		"user-get":        {"<username>", "show a user", userGet},
+		"user-list":       {"[-prefix <prefix>] [-limit <n>] [-cursor <cursor>] [-desc]", "list users", userList},
+		"user-groups":     {"<username>", "list groups of a user", userGroups},
+		"user-delete":     {"<username>", "delete a user", userDelete},
+		"user-deactivate": {"<username>", "deactivate a user", userDeactivate},
+		"user-activate":   {"<username>", "activate a user", userActivate},
+		"user-role":       {"<username> admin|member", "change role of a user", userRole},
+		"group-register":  {"<groupname> <username>...", "register a group", groupRegister},
+		"group-get":       {"<groupname>", "show a group", groupGet},
+		"group-list":      {"[-prefix <prefix>] [-limit <n>] [-cursor <cursor>] [-desc]", "list groups", groupList},
+		"group-add":       {"<groupname> <username>...", "add users to a group", groupAdd},
+		"group-remove":    {"<groupname> <username>", "remove a user from a group", groupRemove},
+		"group-delete":    {"<groupname>", "delete a group", groupDelete},
+		"group-policy":    {"<groupname> open|members|announce", "change posting policy of a group", groupPolicy},
+		"group-moderator": {"<groupname> <username> [-revoke]", "make a member moderator of a group", groupModerator},
+		"send":            {"-to <recipient>[,...] [-cc ...] [-bcc ...] -subject <subject> -body <body>", "send a message, to group:<name> for a group", send},
+		"reply":           {"<msgid> -subject <subject> -body <body>", "reply to a message", reply},
+		"show":            {"<msgid>", "show a message", show},
+		"mailbox":         {"[-limit <n>] [-cursor <cursor>] [-unread] [-archived] [-from <user>] [-group <group>] [-since <time>] [-until <time>] [-replies|-roots]", "list mailbox, most recent first", mailbox},
+		"sent":            {"[-limit <n>] [-cursor <cursor>]", "list sent messages, most recent first", sent},
+		"search":          {"[-limit <n>] <words>...", "search mailbox", search},
+		"unread":          {"", "count unread messages in mailbox", unreadCount},
+		"read":            {"<msgid>... [-unread]", "mark messages read", markRead},
+		"archive":         {"<msgid>... [-undo]", "move messages to archive", archive},
+		"delete":          {"<msgid>...", "delete messages from mailbox", deleteMessages},
+		"thread":          {"<msgid>", "show the conversation of a message", thread},
+		"tail":            {"[-last-event <id>]", "follow new messages and replies", tail},
+	}
+}
+
+func main() {
+
+	var (
+		userServiceUrl = flag.String("users", envString("MSGBOX_USERSVC_URL", defaultUserServiceUrl), "useradmin service URL")
+		msgServiceUrl  = flag.String("messages", envString("MSGBOX_MSGSVC_URL", defaultMsgServiceUrl), "msgstore service URL")
+		token          = flag.String("token", envString("MSGBOX_TOKEN", ""), "bearer token of requests")
+		user           = flag.String("user", envString("MSGBOX_USER", ""), "user sending and reading messages")
+		output         = flag.String("o", envString("MSGBOX_OUTPUT", defaultOutput), "output format, table or json")
+	)
+
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "msgboxctl: unknown command %q\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+
+	out, err := newPrinter(os.Stdout, *output)
+	if err != nil {
+		fail(err)
+	}
+
+	var options []client.ClientOption
+	if len(*token) > 0 {
+		options = append(options, client.WithToken(*token))
+	}
+	users, err := client.NewUserAdminClient(*userServiceUrl, options...)
+	if err != nil {
+		fail(err)
+	}
+	messages, err := client.NewMsgStoreClient(*msgServiceUrl, options...)
+	if err != nil {
+		fail(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
+		<-c
+		cancel()
+	}()
+
+	// Messages are sent and read by the subject of token unless told otherwise
+	if len(*user) == 0 && len(*token) > 0 {
+		var claims jwt.StandardClaims
+		if _, _, err := new(jwt.Parser).ParseUnverified(*token, &claims); err == nil {
+			*user = claims.Subject
+		}
+	}
+
+	e := &env{users: users, messages: messages, user: *user, out: out}
+	err = cmd.run(ctx, e, flag.Args()[1:])
+	switch {
+	case err == flag.ErrHelp:
+		os.Exit(2)
+	case err != nil && ctx.Err() == nil:
+		fail(err)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: msgboxctl [flags] <command> [arguments]\n\nflags:\n")
+	flag.PrintDefaults()
+	fmt.Fprintf(os.Stderr, "\ncommands:\n")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", name, commands[name].help)
+		if len(commands[name].usage) > 0 {
+			fmt.Fprintf(os.Stderr, "  %-16s   %s\n", "", commands[name].usage)
+		}
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "msgboxctl: %v\n", err)
+	os.Exit(1)
+}
+
+// Parse flags of a command, which may be given before or after its positional
+// arguments, and get the positional arguments. Fails unless their number is
+// between given bounds, where a negative maximum means any number.
+func parseArgs(fs *flag.FlagSet, args []string, min, max int) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	if len(positional) < min || (max >= 0 && len(positional) > max) {
+		fs.Usage()
+		return nil, fmt.Errorf("%s: wrong number of arguments", fs.Name())
+	}
+	return positional, nil
+}
+
+// Get a flag set of given command that reports errors instead of exiting
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: msgboxctl %s %s\n", name, commands[name].usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// Flag collecting each of its values
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// Get the user on whose behalf messages are sent and read
+func (e *env) mailboxUser() (string, error) {
+	if len(e.user) == 0 {
+		return "", errors.New("no user given, set -user or MSGBOX_USER")
+	}
+	return e.user, nil
+}
+
+func envString(env, fallback string) string {
+	e := os.Getenv(env)
+	if e == "" {
+		return fallback
+	}
+	return e
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ghsbhatia/msgbox/pkg/msgstore"
+	"github.com/ghsbhatia/msgbox/pkg/useradmin"
+)
+
+// Output formats
+const (
+	// Aligned columns with a header, for people
+	outputTable = "table"
+	// Results as returned by the services, for scripts
+	outputJSON = "json"
+)
+
+// Maximum length of subject shown in a table
+const maxSubjectWidth = 50
+
+// Printer of command results in the chosen output format
+type printer struct {
+	w      io.Writer
+	format string
+}
+
+func newPrinter(w io.Writer, format string) (*printer, error) {
+	if format != outputTable && format != outputJSON {
+		return nil, fmt.Errorf("unknown output format %q", format)
+	}
+	return &printer{w, format}, nil
+}
+
+// Print given value as json, or given rows as a table with given header, if
+// any.
+func (p *printer) print(v interface{}, header []string, rows [][]string) error {
+	if p.format == outputJSON {
+		enc := json.NewEncoder(p.w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	if len(header) > 0 {
+		fmt.Fprintln(tw, strings.Join(header, "\t"))
+	}
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// Print a page of results, along with the cursor of next page if any.
+func (p *printer) printPage(v interface{}, next string, header []string, rows [][]string) error {
+	if p.format == outputJSON {
+		return p.print(v, nil, nil)
+	}
+	if err := p.print(nil, header, rows); err != nil {
+		return err
+	}
+	if len(next) > 0 {
+		fmt.Fprintf(p.w, "\nnext cursor: %s\n", next)
+	}
+	return nil
+}
+
+// Print a single value, as json or as a line of text.
+func (p *printer) printLine(v interface{}, format string, args ...interface{}) error {
+	if p.format == outputJSON {
+		return json.NewEncoder(p.w).Encode(v)
+	}
+	_, err := fmt.Fprintf(p.w, format+"\n", args...)
+	return err
+}
+
+// Print an event as it arrives, as a line of json or of text.
+func (p *printer) printEvent(ev msgstore.Event) error {
+	if p.format == outputJSON {
+		return json.NewEncoder(p.w).Encode(ev)
+	}
+	msg := ev.Message
+	_, err := fmt.Fprintf(p.w, "%-7s  %s  %s  %s  %s  %s\n",
+		ev.Type, msg.Id, msg.Timestamp, senderOf(msg), addresseesOf(msg), truncate(msg.Subject))
+	return err
+}
+
+var userHeader = []string{"USERNAME", "DISPLAY NAME", "EMAIL", "ROLE", "STATUS", "CREATED"}
+
+func userRow(u useradmin.UserDetails) []string {
+	status := "active"
+	if u.Deactivated {
+		status = "deactivated"
+	}
+	return []string{u.Id, u.DisplayName, u.Email, u.Role, status, u.CreatedAt}
+}
+
+var groupHeader = []string{"GROUP", "POLICY", "USERS", "MODERATORS"}
+
+func groupRow(g useradmin.GroupDetails) []string {
+	return []string{g.Groupname, g.Policy, strings.Join(g.Usernames, ","), strings.Join(g.Moderators, ",")}
+}
+
+var messageHeader = []string{"", "ID", "SENT", "FROM", "TO", "SUBJECT"}
+
+// Get table row of a message, marked when it is unread
+func messageRow(msg msgstore.Message) []string {
+	mark := ""
+	if msg.Unread {
+		mark = "*"
+	}
+	return []string{mark, msg.Id, msg.Timestamp, senderOf(msg), addresseesOf(msg), truncate(msg.Subject)}
+}
+
+func messageRows(msgs []msgstore.Message) [][]string {
+	rows := make([][]string, 0, len(msgs))
+	for _, msg := range msgs {
+		rows = append(rows, messageRow(msg))
+	}
+	return rows
+}
+
+// Get sender of a message along with its display name, if any
+func senderOf(msg msgstore.Message) string {
+	if len(msg.SenderName) > 0 {
+		return fmt.Sprintf("%s (%s)", msg.Sender, msg.SenderName)
+	}
+	return msg.Sender
+}
+
+// Get addressees of a message, groups prefixed with group:
+func addresseesOf(msg msgstore.Message) string {
+	var names []string
+	for _, rcv := range append([]msgstore.Receiver{msg.Recipient}, append(msg.To, msg.Cc...)...) {
+		switch {
+		case len(rcv.Groupname) > 0:
+			names = append(names, groupPrefix+rcv.Groupname)
+		case len(rcv.Username) > 0:
+			names = append(names, rcv.Username)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// Get given text cut to the width of a column
+func truncate(text string) string {
+	runes := []rune(text)
+	if len(runes) <= maxSubjectWidth {
+		return text
+	}
+	return string(runes[:maxSubjectWidth-3]) + "..."
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ghsbhatia/msgbox/pkg/useradmin"
+)
+
+func userRegister(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet("user-register")
+	name := fs.String("name", "", "display name")
+	email := fs.String("email", "", "email address")
+	var attrs listFlag
+	fs.Var(&attrs, "attr", "attribute as key=value, may be repeated")
+	pos, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	u := useradmin.UserDetails{Id: pos[0], DisplayName: *name, Email: *email}
+	for _, attr := range attrs {
+		kv := strings.SplitN(attr, "=", 2)
+		if len(kv) != 2 || len(kv[0]) == 0 {
+			return fmt.Errorf("attribute %q is not key=value", attr)
+		}
+		if u.Attributes == nil {
+			u.Attributes = make(map[string]string)
+		}
+		u.Attributes[kv[0]] = kv[1]
+	}
+
+	registered, err := e.users.RegisterUser(ctx, u)
+	if err != nil {
+		return err
+	}
+	return e.out.printLine(registered, "registered user %s", registered.Id)
+}
+
+func userGet(ctx context.Context, e *env, args []string) error {
+	pos, err := parseArgs(newFlagSet("user-get"), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	u, err := e.users.GetUser(ctx, pos[0])
+	if err != nil {
+		return err
+	}
+	if e.out.format == outputJSON {
+		return e.out.print(u, nil, nil)
+	}
+	header := append(userHeader, "ATTRIBUTES")
+	row := append(userRow(u), attributesOf(u))
+	return e.out.print(nil, header, [][]string{row})
+}
+
+func userList(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet("user-list")
+	query := listQueryFlags(fs)
+	if _, err := parseArgs(fs, args, 0, 0); err != nil {
+		return err
+	}
+	users, next, err := e.users.ListUsers(ctx, *query)
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, 0, len(users))
+	for _, u := range users {
+		rows = append(rows, userRow(u))
+	}
+	page := struct {
+		Users      []useradmin.UserDetails `json:"users"`
+		NextCursor string                  `json:"next_cursor,omitempty"`
+	}{users, next}
+	return e.out.printPage(page, next, userHeader, rows)
+}
+
+func userGroups(ctx context.Context, e *env, args []string) error {
+	pos, err := parseArgs(newFlagSet("user-groups"), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	groups, err := e.users.GetUserGroups(ctx, pos[0])
+	if err != nil {
+		return err
+	}
+	return e.out.print(groups, []string{"GROUP"}, nameRows(groups))
+}
+
+func userDelete(ctx context.Context, e *env, args []string) error {
+	return userAction(ctx, e, "user-delete", args, e.users.DeleteUser, "deleted user %s")
+}
+
+func userDeactivate(ctx context.Context, e *env, args []string) error {
+	return userAction(ctx, e, "user-deactivate", args, e.users.DeactivateUser, "deactivated user %s")
+}
+
+func userActivate(ctx context.Context, e *env, args []string) error {
+	return userAction(ctx, e, "user-activate", args, e.users.ActivateUser, "activated user %s")
+}
+
+// Run a command taking just a user name and report what was done to the user
+func userAction(ctx context.Context, e *env, name string, args []string,
+	action func(context.Context, string) error, done string) error {
+	pos, err := parseArgs(newFlagSet(name), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	if err := action(ctx, pos[0]); err != nil {
+		return err
+	}
+	return e.out.printLine(map[string]string{"username": pos[0]}, done, pos[0])
+}
+
+func userRole(ctx context.Context, e *env, args []string) error {
+	pos, err := parseArgs(newFlagSet("user-role"), args, 2, 2)
+	if err != nil {
+		return err
+	}
+	if err := e.users.SetUserRole(ctx, pos[0], pos[1]); err != nil {
+		return err
+	}
+	return e.out.printLine(map[string]string{"username": pos[0], "role": pos[1]},
+		"user %s is now %s", pos[0], pos[1])
+}
+
+func groupRegister(ctx context.Context, e *env, args []string) error {
+	pos, err := parseArgs(newFlagSet("group-register"), args, 2, -1)
+	if err != nil {
+		return err
+	}
+	id, err := e.users.RegisterGroup(ctx, pos[0], pos[1:])
+	if err != nil {
+		return err
+	}
+	return e.out.printLine(map[string]string{"id": id}, "registered group %s", pos[0])
+}
+
+func groupGet(ctx context.Context, e *env, args []string) error {
+	pos, err := parseArgs(newFlagSet("group-get"), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	g, err := e.users.GetGroup(ctx, pos[0])
+	if err != nil {
+		return err
+	}
+	return e.out.print(g, groupHeader, [][]string{groupRow(g)})
+}
+
+func groupList(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet("group-list")
+	query := listQueryFlags(fs)
+	if _, err := parseArgs(fs, args, 0, 0); err != nil {
+		return err
+	}
+	groups, next, err := e.users.ListGroups(ctx, *query)
+	if err != nil {
+		return err
+	}
+	page := struct {
+		Groups     []string `json:"groups"`
+		NextCursor string   `json:"next_cursor,omitempty"`
+	}{groups, next}
+	return e.out.printPage(page, next, []string{"GROUP"}, nameRows(groups))
+}
+
+func groupAdd(ctx context.Context, e *env, args []string) error {
+	pos, err := parseArgs(newFlagSet("group-add"), args, 2, -1)
+	if err != nil {
+		return err
+	}
+	if err := e.users.AddGroupUsers(ctx, pos[0], pos[1:]); err != nil {
+		return err
+	}
+	return e.out.printLine(map[string]interface{}{"groupname": pos[0], "usernames": pos[1:]},
+		"added %s to group %s", strings.Join(pos[1:], ", "), pos[0])
+}
+
+func groupRemove(ctx context.Context, e *env, args []string) error {
+	pos, err := parseArgs(newFlagSet("group-remove"), args, 2, 2)
+	if err != nil {
+		return err
+	}
+	if err := e.users.RemoveGroupUser(ctx, pos[0], pos[1]); err != nil {
+		return err
+	}
+	return e.out.printLine(map[string]string{"groupname": pos[0], "username": pos[1]},
+		"removed %s from group %s", pos[1], pos[0])
+}
+
+func groupDelete(ctx context.Context, e *env, args []string) error {
+	pos, err := parseArgs(newFlagSet("group-delete"), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	if err := e.users.DeleteGroup(ctx, pos[0]); err != nil {
+		return err
+	}
+	return e.out.printLine(map[string]string{"groupname": pos[0]}, "deleted group %s", pos[0])
+}
+
+func groupPolicy(ctx context.Context, e *env, args []string) error {
+	pos, err := parseArgs(newFlagSet("group-policy"), args, 2, 2)
+	if err != nil {
+		return err
+	}
+	if err := e.users.SetGroupPolicy(ctx, pos[0], pos[1]); err != nil {
+		return err
+	}
+	return e.out.printLine(map[string]string{"groupname": pos[0], "policy": pos[1]},
+		"group %s is now %s", pos[0], pos[1])
+}
+
+func groupModerator(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet("group-moderator")
+	revoke := fs.Bool("revoke", false, "revoke moderation instead of granting it")
+	pos, err := parseArgs(fs, args, 2, 2)
+	if err != nil {
+		return err
+	}
+	if err := e.users.SetGroupModerator(ctx, pos[0], pos[1], !*revoke); err != nil {
+		return err
+	}
+	done := "%s now moderates group %s"
+	if *revoke {
+		done = "%s no longer moderates group %s"
+	}
+	return e.out.printLine(map[string]interface{}{"groupname": pos[0], "username": pos[1], "moderator": !*revoke},
+		done, pos[1], pos[0])
+}
+
+// Register flags of a list of users or groups
+func listQueryFlags(fs *flag.FlagSet) *useradmin.ListQuery {
+	var query useradmin.ListQuery
+	fs.StringVar(&query.Prefix, "prefix", "", "list only names starting with prefix")
+	fs.IntVar(&query.Limit, "limit", 0, "maximum number of names, default page size of service when zero")
+	fs.StringVar(&query.Cursor, "cursor", "", "cursor of page as printed with previous page")
+	fs.BoolVar(&query.Descending, "desc", false, "list in descending order")
+	return &query
+}
+
+func nameRows(names []string) [][]string {
+	rows := make([][]string, 0, len(names))
+	for _, name := range names {
+		rows = append(rows, []string{name})
+	}
+	return rows
+}
+
+// Get attributes of a user as sorted key=value pairs
+func attributesOf(u useradmin.UserDetails) string {
+	pairs := make([]string, 0, len(u.Attributes))
+	for k, v := range u.Attributes {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
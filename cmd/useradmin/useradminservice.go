@@ -3,26 +3,36 @@ package main
 import (
 	"flag"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 
+	"github.com/ghsbhatia/msgbox/pkg/middleware"
 	"github.com/ghsbhatia/msgbox/pkg/useradmin"
+	"github.com/ghsbhatia/msgbox/pkg/useradmin/pb"
 	"github.com/go-kit/kit/log"
+	"google.golang.org/grpc"
 )
 
 const (
 	defaultPort       = "6060"
+	defaultGRPCPort   = "6061"
+	defaultRepository = "mysql"
 	defaultMysqlDbUrl = "root@tcp(127.0.0.1:3306)/msgbox"
 )
 
 func main() {
 
 	var (
-		addr       = envString("PORT", defaultPort)
-		httpAddr   = flag.String("http.addr", ":"+addr, "HTTP listen address")
-		mysqlDBUrl = envString("MYSQLDB_URL", defaultMysqlDbUrl)
+		addr           = envString("PORT", defaultPort)
+		httpAddr       = flag.String("http.addr", ":"+addr, "HTTP listen address")
+		grpcPort       = envString("GRPC_PORT", defaultGRPCPort)
+		grpcAddr       = flag.String("grpc.addr", ":"+grpcPort, "gRPC listen address")
+		repositoryType = envString("USERADMIN_REPOSITORY", defaultRepository)
+		mysqlDBUrl     = envString("MYSQLDB_URL", defaultMysqlDbUrl)
+		authKey        = envString("AUTH_KEY", "")
 	)
 
 	flag.Parse()
@@ -35,9 +45,20 @@ func main() {
 
 	var useradminsvc useradmin.Service
 	{
-		repository, err := useradmin.NewUserRepository(mysqlDBUrl)
-		if err != nil {
-			logger.Log("error creating repository:", err)
+		var repository useradmin.UserRepository
+		switch repositoryType {
+		case "mysql":
+			var err error
+			repository, err = useradmin.NewUserRepository(mysqlDBUrl)
+			if err != nil {
+				logger.Log("error creating repository:", err)
+				os.Exit(1)
+			}
+		case "memory":
+			logger.Log("repository", repositoryType, "msg", "users and groups are not persisted")
+			repository = useradmin.NewInMemoryUserRepository()
+		default:
+			logger.Log("error creating repository:", "unknown repository type "+repositoryType)
 			os.Exit(1)
 		}
 		useradminsvc = useradmin.NewService(repository)
@@ -47,15 +68,41 @@ func main() {
 
 	mux := http.NewServeMux()
 
-	mux.Handle("/", useradmin.MakeHandler(useradminsvc, httpLogger))
+	var handler http.Handler = useradmin.MakeHandler(useradminsvc, httpLogger)
+	if len(authKey) > 0 {
+		handler = middleware.NewHTTPAuthenticator(handler, []byte(authKey), httpLogger)
+	} else {
+		logger.Log("auth", "disabled", "msg", "requests are not authenticated")
+	}
+
+	mux.Handle("/", handler)
+
+	grpcLogger := log.With(logger, "component", "grpc")
+
+	interceptors := []grpc.UnaryServerInterceptor{middleware.NewGRPCInterceptor(grpcLogger)}
+	if len(authKey) > 0 {
+		interceptors = append(interceptors, middleware.NewGRPCAuthenticator([]byte(authKey), grpcLogger))
+	}
+	grpcServer := grpc.NewServer(grpc.ChainUnaryInterceptor(interceptors...))
+	pb.RegisterUserAdminServer(grpcServer, useradmin.MakeGRPCServer(useradminsvc, grpcLogger))
 
-	errs := make(chan error, 2)
+	errs := make(chan error, 3)
 
 	go func() {
 		logger.Log("transport", "http", "address", *httpAddr, "msg", "listening")
 		errs <- http.ListenAndServe(*httpAddr, mux)
 	}()
 
+	go func() {
+		listener, err := net.Listen("tcp", *grpcAddr)
+		if err != nil {
+			errs <- err
+			return
+		}
+		logger.Log("transport", "grpc", "address", *grpcAddr, "msg", "listening")
+		errs <- grpcServer.Serve(listener)
+	}()
+
 	go func() {
 		c := make(chan os.Signal)
 		signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
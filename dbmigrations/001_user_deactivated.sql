@@ -0,0 +1,4 @@
+-- Users can be deactivated
+USE msgbox;
+
+ALTER TABLE users ADD COLUMN deactivated BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,8 @@
+-- Users have profiles along with the time they were created at
+USE msgbox;
+
+ALTER TABLE users
+  ADD COLUMN display_name VARCHAR(64) DEFAULT NULL,
+  ADD COLUMN email VARCHAR(254) DEFAULT NULL,
+  ADD COLUMN created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  ADD COLUMN attributes JSON DEFAULT NULL;
@@ -0,0 +1,6 @@
+-- Users have roles, groups have posting policies and moderators
+USE msgbox;
+
+ALTER TABLE users ADD COLUMN role VARCHAR(16) NOT NULL DEFAULT 'member';
+ALTER TABLE usergroups ADD COLUMN policy VARCHAR(16) NOT NULL DEFAULT 'open';
+ALTER TABLE groupusers ADD COLUMN moderator BOOLEAN NOT NULL DEFAULT FALSE;
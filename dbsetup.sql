@@ -2,11 +2,18 @@ USE msgbox;
 
 CREATE TABLE users (
   name VARCHAR(32) NOT NULL,
+  display_name VARCHAR(64),
+  email VARCHAR(254),
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  attributes JSON,
+  deactivated BOOLEAN NOT NULL DEFAULT FALSE,
+  role VARCHAR(16) NOT NULL DEFAULT 'member',
   PRIMARY KEY (name)
 );
 
 CREATE TABLE usergroups (
   name VARCHAR(32) NOT NULL,
+  policy VARCHAR(16) NOT NULL DEFAULT 'open',
   PRIMARY KEY (name)
 );
 
@@ -14,6 +21,7 @@ CREATE TABLE groupusers (
   id INT NOT NULL AUTO_INCREMENT,
   groupname VARCHAR(32) NOT NULL,
   username VARCHAR(32) NOT NULL,
+  moderator BOOLEAN NOT NULL DEFAULT FALSE,
   PRIMARY KEY (id),
   FOREIGN KEY (groupname) REFERENCES usergroups(name),
   FOREIGN KEY (username) REFERENCES users(name)
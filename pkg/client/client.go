@@ -0,0 +1,192 @@
+// Package client provides Go clients of msgstore and useradmin services, which
+// call the services over HTTP and implement their Service interfaces, so that
+// a remote service may be used wherever a local one is.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-kit/kit/endpoint"
+	kithttp "github.com/go-kit/kit/transport/http"
+
+	"github.com/ghsbhatia/msgbox/pkg/middleware"
+)
+
+// Option to configure a client
+type ClientOption func(*httpClient)
+
+// Authenticate all requests with given bearer token. Without a token, requests
+// carry the token of the request context, if any, as when a service calls
+// another on behalf of an authenticated request.
+func WithToken(token string) ClientOption {
+	return func(c *httpClient) {
+		c.token = token
+	}
+}
+
+// Send requests with given http client instead of http.DefaultClient.
+func WithHTTPClient(client *http.Client) ClientOption {
+	return func(c *httpClient) {
+		c.options = append(c.options, kithttp.SetClient(client))
+	}
+}
+
+// Client calling resources of a service over HTTP. Failures reported by the
+// service are mapped back to the errors of the service package: by the message
+// of the error when it is known, otherwise by status code.
+type httpClient struct {
+	base     *url.URL
+	token    string
+	options  []kithttp.ClientOption
+	errors   []error       // errors of service, matched by message
+	statuses map[int]error // errors of service, matched by status code
+}
+
+func newHttpClient(instance string, errs []error, statuses map[int]error, options ...ClientOption) (*httpClient, error) {
+	if !strings.HasPrefix(instance, "http") {
+		instance = "http://" + instance
+	}
+	base, err := url.Parse(instance)
+	if err != nil {
+		return nil, err
+	}
+	base.Path = strings.TrimSuffix(base.Path, "/")
+
+	c := &httpClient{
+		base:     base,
+		errors:   append(errs, middleware.ErrUnauthorized),
+		statuses: statuses,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c, nil
+}
+
+// Request to a resource of service
+type request struct {
+	method string
+	path   string      // path of resource, with segments escaped
+	query  url.Values  // optional query parameters
+	body   interface{} // optional content, sent as json
+}
+
+// Call a resource of service and unmarshal the json content of its response
+// into given value, unless it is nil.
+func (c *httpClient) call(ctx context.Context, req request, v interface{}) error {
+	response, err := c.endpoint(req, c.decodeResponse)(ctx, req)
+	if err != nil {
+		return err
+	}
+	data := response.([]byte)
+	if v == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Open a stream from a resource of service. The caller must close the body of
+// returned response.
+func (c *httpClient) stream(ctx context.Context, req request, header http.Header) (*http.Response, error) {
+	decode := func(_ context.Context, r *http.Response) (interface{}, error) {
+		if r.StatusCode != http.StatusOK {
+			defer r.Body.Close()
+			return nil, c.decodeError(r)
+		}
+		return r, nil
+	}
+	before := kithttp.ClientBefore(func(ctx context.Context, r *http.Request) context.Context {
+		for name, values := range header {
+			r.Header[name] = values
+		}
+		return ctx
+	})
+	response, err := c.endpoint(req, decode, before, kithttp.BufferedStream(true))(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return response.(*http.Response), nil
+}
+
+// Get endpoint calling the resource of given request.
+func (c *httpClient) endpoint(req request, decode kithttp.DecodeResponseFunc, options ...kithttp.ClientOption) endpoint.Endpoint {
+	target := *c.base
+	target.RawPath = c.base.EscapedPath() + req.path
+	target.Path, _ = url.PathUnescape(target.RawPath)
+	target.RawQuery = req.query.Encode()
+
+	options = append(options, c.options...)
+	return kithttp.NewClient(req.method, &target, c.encodeRequest, decode, options...).Endpoint()
+}
+
+// Encode request with its content, authenticated with the token of client or
+// of context.
+func (c *httpClient) encodeRequest(ctx context.Context, r *http.Request, v interface{}) error {
+	token := c.token
+	if len(token) == 0 {
+		token = middleware.Token(ctx)
+	}
+	if len(token) > 0 {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	req := v.(request)
+	if req.body == nil {
+		return nil
+	}
+	data, err := json.Marshal(req.body)
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/json; charset=utf-8")
+	r.ContentLength = int64(len(data))
+	r.Body = ioutil.NopCloser(bytes.NewReader(data))
+	return nil
+}
+
+// Get content of a successful response, or the error it reports.
+func (c *httpClient) decodeResponse(_ context.Context, r *http.Response) (interface{}, error) {
+	if r.StatusCode < http.StatusOK || r.StatusCode >= http.StatusMultipleChoices {
+		return nil, c.decodeError(r)
+	}
+	return ioutil.ReadAll(r.Body)
+}
+
+// Get error reported by an unsuccessful response.
+func (c *httpClient) decodeError(r *http.Response) error {
+	var body struct {
+		Error string `json:"error"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+
+	for _, err := range c.errors {
+		if body.Error == err.Error() {
+			return err
+		}
+	}
+	if err, ok := c.statuses[r.StatusCode]; ok {
+		return err
+	}
+	if len(body.Error) > 0 {
+		return errors.New(body.Error)
+	}
+	return fmt.Errorf("unexpected status %d", r.StatusCode)
+}
+
+// Get path of a resource from its segments, escaping each one.
+func pathOf(segments ...string) string {
+	var b strings.Builder
+	for _, segment := range segments {
+		b.WriteString("/")
+		b.WriteString(url.PathEscape(segment))
+	}
+	return b.String()
+}
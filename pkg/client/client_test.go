@@ -0,0 +1,373 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ghsbhatia/msgbox/pkg/middleware"
+	"github.com/ghsbhatia/msgbox/pkg/msgstore"
+	"github.com/ghsbhatia/msgbox/pkg/svcclient"
+	"github.com/ghsbhatia/msgbox/pkg/useradmin"
+)
+
+// Test executor for service clients
+func TestClient(t *testing.T) {
+	s := &clientTestSuite{}
+	t.Run("Users", func(t *testing.T) { s.testUsers(t) })
+	t.Run("Groups", func(t *testing.T) { s.testGroups(t) })
+	t.Run("Messages", func(t *testing.T) { s.testMessages(t) })
+	t.Run("Mailbox", func(t *testing.T) { s.testMailbox(t) })
+	t.Run("Events", func(t *testing.T) { s.testEvents(t) })
+	t.Run("Authentication", func(t *testing.T) { s.testAuthentication(t) })
+}
+
+// Test suite for service clients
+type clientTestSuite struct{}
+
+// Start useradmin and msgstore services keeping data in memory, wrapped by
+// given middleware, and get their clients created with given options. The
+// returned function stops the services.
+func (s *clientTestSuite) start(t *testing.T, wrap func(http.Handler) http.Handler, options ...ClientOption) (useradmin.Service, msgstore.Service, func()) {
+	logger := kitlog.NewNopLogger()
+
+	usersvc := useradmin.NewService(useradmin.NewInMemoryUserRepository())
+	usersrv := httptest.NewServer(wrap(useradmin.MakeHandler(usersvc, logger)))
+
+	msgsvc := msgstore.NewService(msgstore.NewInMemoryMessageRepository(), svcclient.NewHttpClient(), usersrv.URL)
+	msgsrv := httptest.NewServer(wrap(msgstore.MakeHandler(msgsvc, logger)))
+
+	users, err := NewUserAdminClient(usersrv.URL, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs, err := NewMsgStoreClient(msgsrv.URL, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return users, msgs, func() {
+		msgsrv.Close()
+		usersrv.Close()
+	}
+}
+
+// Middleware that passes requests through unchanged
+func unauthenticated(h http.Handler) http.Handler {
+	return h
+}
+
+// Register users with given names
+func register(t *testing.T, users useradmin.Service, usernames ...string) {
+	for _, username := range usernames {
+		if _, err := users.RegisterUser(context.TODO(), useradmin.UserDetails{Id: username}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Test scenario - Register, get, list and update users
+func (s *clientTestSuite) testUsers(t *testing.T) {
+	ctx := context.TODO()
+	users, _, stop := s.start(t, unauthenticated)
+	defer stop()
+
+	alice := useradmin.UserDetails{
+		Id:          "Alice Smith",
+		DisplayName: "Alice",
+		Email:       "alice@example.com",
+		Attributes:  map[string]string{"team": "sales"},
+	}
+	registered, err := users.RegisterUser(ctx, alice)
+	assert.NoError(t, err)
+	assert.Equal(t, alice.Id, registered.Id)
+	assert.NotEmpty(t, registered.CreatedAt)
+
+	found, err := users.GetUser(ctx, "Alice Smith")
+	assert.NoError(t, err)
+	assert.Equal(t, alice.Email, found.Email)
+	assert.Equal(t, alice.Attributes, found.Attributes)
+	assert.Equal(t, useradmin.RoleMember, found.Role)
+
+	_, err = users.RegisterUser(ctx, alice)
+	assert.Equal(t, useradmin.ErrUserExists, err)
+	_, err = users.RegisterUser(ctx, useradmin.UserDetails{Id: "bob", Email: "bob"})
+	assert.Equal(t, useradmin.ErrBadRequest, err)
+	_, err = users.GetUser(ctx, "nobody")
+	assert.Equal(t, useradmin.ErrUserNotFound, err)
+
+	register(t, users, "bob", "carol")
+
+	page, next, err := users.ListUsers(ctx, useradmin.ListQuery{Limit: 2, Descending: true})
+	assert.NoError(t, err)
+	assert.Len(t, page, 2)
+	assert.Equal(t, "carol", page[0].Id)
+	page, next, err = users.ListUsers(ctx, useradmin.ListQuery{Limit: 2, Descending: true, Cursor: next})
+	assert.NoError(t, err)
+	assert.Len(t, page, 1)
+	assert.Empty(t, next)
+
+	assert.NoError(t, users.DeactivateUser(ctx, "bob"))
+	found, _ = users.GetUser(ctx, "bob")
+	assert.True(t, found.Deactivated)
+	assert.NoError(t, users.ActivateUser(ctx, "bob"))
+
+	assert.NoError(t, users.SetUserRole(ctx, "bob", useradmin.RoleAdmin))
+	assert.Equal(t, useradmin.ErrBadRequest, users.SetUserRole(ctx, "bob", "owner"))
+
+	assert.NoError(t, users.DeleteUser(ctx, "carol"))
+	assert.Equal(t, useradmin.ErrUserNotFound, users.DeleteUser(ctx, "carol"))
+}
+
+// Test scenario - Register, get, list and update groups
+func (s *clientTestSuite) testGroups(t *testing.T) {
+	ctx := context.TODO()
+	users, _, stop := s.start(t, unauthenticated)
+	defer stop()
+
+	register(t, users, "alice", "bob", "carol")
+
+	id, err := users.RegisterGroup(ctx, "friends", []string{"alice", "bob"})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, id)
+	_, err = users.RegisterGroup(ctx, "friends", []string{"alice"})
+	assert.Equal(t, useradmin.ErrGroupExists, err)
+
+	assert.NoError(t, users.AddGroupUsers(ctx, "friends", []string{"carol"}))
+	assert.NoError(t, users.RemoveGroupUser(ctx, "friends", "alice"))
+	assert.Equal(t, useradmin.ErrNotGroupMember, users.RemoveGroupUser(ctx, "friends", "alice"))
+
+	assert.NoError(t, users.SetGroupPolicy(ctx, "friends", "announce"))
+	assert.NoError(t, users.SetGroupModerator(ctx, "friends", "bob", true))
+
+	group, err := users.GetGroup(ctx, "friends")
+	assert.NoError(t, err)
+	assert.Equal(t, useradmin.GroupDetails{
+		Groupname:  "friends",
+		Usernames:  []string{"bob", "carol"},
+		Policy:     "announce",
+		Moderators: []string{"bob"},
+	}, group)
+
+	assert.NoError(t, users.SetGroupModerator(ctx, "friends", "bob", false))
+
+	groups, err := users.GetUserGroups(ctx, "bob")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"friends"}, groups)
+
+	groups, next, err := users.ListGroups(ctx, useradmin.ListQuery{Prefix: "fr"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"friends"}, groups)
+	assert.Empty(t, next)
+
+	assert.NoError(t, users.DeleteGroup(ctx, "friends"))
+	_, err = users.GetGroup(ctx, "friends")
+	assert.Equal(t, useradmin.ErrGroupNotFound, err)
+}
+
+// Test scenario - Send messages and replies and get them along with threads
+func (s *clientTestSuite) testMessages(t *testing.T) {
+	ctx := context.TODO()
+	users, msgs, stop := s.start(t, unauthenticated)
+	defer stop()
+
+	register(t, users, "alice", "bob")
+
+	msgid, err := msgs.StoreMessage(ctx, msgstore.Message{
+		Sender:    "alice",
+		Recipient: msgstore.Receiver{Username: "bob"},
+		Subject:   "lunch",
+		Body:      "lunch plans?",
+	})
+	assert.NoError(t, err)
+
+	replyid, err := msgs.StoreMessage(ctx, msgstore.Message{Re: msgid, Sender: "bob", Subject: "re:lunch", Body: "noon"})
+	assert.NoError(t, err)
+
+	msg, err := msgs.GetMessage(ctx, msgid)
+	assert.NoError(t, err)
+	assert.Equal(t, "lunch", msg.Subject)
+	assert.Equal(t, "bob", msg.Recipient.Username)
+
+	replies, err := msgs.GetReplies(ctx, msgid)
+	assert.NoError(t, err)
+	assert.Len(t, replies, 1)
+	assert.Equal(t, replyid, replies[0].Id)
+
+	thread, err := msgs.GetThread(ctx, replyid)
+	assert.NoError(t, err)
+	assert.Equal(t, msgid, thread.Id)
+	assert.Len(t, thread.Replies, 1)
+	assert.Equal(t, replyid, thread.Replies[0].Id)
+
+	_, err = msgs.StoreMessage(ctx, msgstore.Message{Sender: "alice", Recipient: msgstore.Receiver{Username: "nobody"}, Subject: "hi", Body: "hi"})
+	assert.Equal(t, msgstore.ErrUserNotFound, err)
+	_, err = msgs.StoreMessage(ctx, msgstore.Message{Sender: "alice", Subject: "hi", Body: "hi"})
+	assert.Equal(t, msgstore.ErrBadRequest, err)
+	_, err = msgs.GetMessage(ctx, "unknown")
+	assert.Equal(t, msgstore.ErrMsgNotFound, err)
+}
+
+// Test scenario - Page, search, read, archive and delete messages of mailbox
+func (s *clientTestSuite) testMailbox(t *testing.T) {
+	ctx := context.TODO()
+	users, msgs, stop := s.start(t, unauthenticated)
+	defer stop()
+
+	register(t, users, "alice", "bob")
+
+	var ids []string
+	for _, subject := range []string{"lunch plans", "meeting notes", "lunch again"} {
+		id, err := msgs.StoreMessage(ctx, msgstore.Message{
+			Sender:    "alice",
+			Recipient: msgstore.Receiver{Username: "bob"},
+			Subject:   subject,
+			Body:      subject,
+		})
+		assert.NoError(t, err)
+		ids = append(ids, id)
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	all, err := msgs.GetMessages(ctx, "bob")
+	assert.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	page, next, err := msgs.GetMessagesPage(ctx, "bob", msgstore.MailboxQuery{Limit: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{ids[2], ids[1]}, idsOf(page))
+	page, next, err = msgs.GetMessagesPage(ctx, "bob", msgstore.MailboxQuery{Limit: 2, Cursor: next})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{ids[0]}, idsOf(page))
+	assert.Empty(t, next)
+
+	page, _, err = msgs.GetMessagesPage(ctx, "bob", msgstore.MailboxQuery{})
+	assert.NoError(t, err)
+	assert.Len(t, page, 3)
+
+	sent, _, err := msgs.GetSentMessages(ctx, "alice", msgstore.MailboxQuery{Limit: 10})
+	assert.NoError(t, err)
+	assert.Len(t, sent, 3)
+
+	found, err := msgs.SearchMessages(ctx, "bob", msgstore.SearchQuery{Text: "lunch"})
+	assert.NoError(t, err)
+	assert.Len(t, found, 2)
+	assert.NotEmpty(t, found[0].Highlights)
+
+	count, err := msgs.GetUnreadCount(ctx, "bob")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), count)
+
+	assert.NoError(t, msgs.MarkRead(ctx, "bob", ids[0]))
+	assert.NoError(t, msgs.MarkUnread(ctx, "bob", ids[0]))
+	assert.NoError(t, msgs.MarkRead(ctx, "bob", ids[1]))
+	page, _, err = msgs.GetMessagesPage(ctx, "bob", msgstore.MailboxQuery{Unread: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{ids[2], ids[0]}, idsOf(page))
+
+	assert.NoError(t, msgs.ArchiveMessage(ctx, "bob", ids[0]))
+	page, _, err = msgs.GetMessagesPage(ctx, "bob", msgstore.MailboxQuery{Archived: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{ids[0]}, idsOf(page))
+	assert.NoError(t, msgs.UnarchiveMessage(ctx, "bob", ids[0]))
+
+	assert.NoError(t, msgs.DeleteMessage(ctx, "bob", ids[1]))
+	all, _ = msgs.GetMessages(ctx, "bob")
+	assert.Len(t, all, 2)
+}
+
+// Get ids of given messages
+func idsOf(msgs []msgstore.Message) []string {
+	var ids []string
+	for _, msg := range msgs {
+		ids = append(ids, msg.Id)
+	}
+	return ids
+}
+
+// Test scenario - Subscribe to events of mailbox and resume after last event
+func (s *clientTestSuite) testEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	users, msgs, stop := s.start(t, unauthenticated)
+	defer stop()
+
+	register(t, users, "alice", "bob")
+
+	events, err := msgs.SubscribeEvents(ctx, "bob", 0)
+	assert.NoError(t, err)
+
+	send := func(subject string) string {
+		msg := msgstore.Message{Sender: "alice", Recipient: msgstore.Receiver{Username: "bob"}, Subject: subject, Body: subject}
+		id, err := msgs.StoreMessage(context.TODO(), msg)
+		assert.NoError(t, err)
+		return id
+	}
+	receive := func(events <-chan msgstore.Event) msgstore.Event {
+		select {
+		case ev := <-events:
+			return ev
+		case <-time.After(time.Second):
+			t.Fatal("event not received")
+			return msgstore.Event{}
+		}
+	}
+
+	first := send("first")
+	ev := receive(events)
+	assert.Equal(t, "message", ev.Type)
+	assert.Equal(t, first, ev.Message.Id)
+
+	second := send("second")
+	resumed, err := msgs.SubscribeEvents(ctx, "bob", ev.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, second, receive(resumed).Message.Id)
+
+	cancel()
+	for range events {
+	}
+}
+
+// Test scenario - Requests carry given token or the token of context
+func (s *clientTestSuite) testAuthentication(t *testing.T) {
+	key := []byte("secret")
+	authenticate := func(h http.Handler) http.Handler {
+		return middleware.NewHTTPAuthenticator(h, key, kitlog.NewNopLogger())
+	}
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{Subject: "alice"}).SignedString(key)
+
+	users, msgs, stop := s.start(t, authenticate, WithToken(token))
+	defer stop()
+
+	register(t, users, "alice", "bob")
+
+	// sender is taken from the token
+	msgid, err := msgs.StoreMessage(context.TODO(), msgstore.Message{
+		Sender:    "bob",
+		Recipient: msgstore.Receiver{Username: "bob"},
+		Subject:   "hi",
+		Body:      "hi",
+	})
+	assert.NoError(t, err)
+	msg, err := msgs.GetMessage(context.TODO(), msgid)
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", msg.Sender)
+
+	_, err = msgs.GetMessages(context.TODO(), "bob")
+	assert.Equal(t, msgstore.ErrForbidden, err)
+
+	anonymous, err := NewUserAdminClient(users.(*useradminClient).base.String())
+	assert.NoError(t, err)
+	_, err = anonymous.GetUser(context.TODO(), "alice")
+	assert.Equal(t, middleware.ErrUnauthorized, err)
+
+	ctx := middleware.NewAuthContext(context.TODO(), "alice", token)
+	found, err := anonymous.GetUser(ctx, "alice")
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", found.Id)
+}
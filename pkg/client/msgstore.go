@@ -0,0 +1,249 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ghsbhatia/msgbox/pkg/msgstore"
+)
+
+// Maximum size of a line of event stream
+const maxEventLineSize = 1 << 20
+
+// Create a client of msgstore service at given instance, such as
+// http://localhost:6080. Failures are reported with the errors of msgstore
+// package.
+func NewMsgStoreClient(instance string, options ...ClientOption) (msgstore.Service, error) {
+	errs := []error{
+		msgstore.ErrBadRequest,
+		msgstore.ErrMsgNotFound,
+		msgstore.ErrUserNotFound,
+		msgstore.ErrGroupNotFound,
+		msgstore.ErrUserDeactivated,
+		msgstore.ErrForbidden,
+		msgstore.ErrPostingNotPermitted,
+		msgstore.ErrSystemError,
+		msgstore.ErrUpstreamUnavailable,
+	}
+	statuses := map[int]error{
+		http.StatusBadRequest:          msgstore.ErrBadRequest,
+		http.StatusForbidden:           msgstore.ErrForbidden,
+		http.StatusNotFound:            msgstore.ErrMsgNotFound,
+		http.StatusInternalServerError: msgstore.ErrSystemError,
+		http.StatusServiceUnavailable:  msgstore.ErrUpstreamUnavailable,
+	}
+	c, err := newHttpClient(instance, errs, statuses, options...)
+	if err != nil {
+		return nil, err
+	}
+	return &msgstoreClient{c}, nil
+}
+
+// msgstore.Service implementation calling msgstore over HTTP
+type msgstoreClient struct {
+	*httpClient
+}
+
+// Store a new message, or a reply when it refers to the original message.
+func (c *msgstoreClient) StoreMessage(ctx context.Context, msg msgstore.Message) (string, error) {
+	req := request{method: "POST", path: "/messages", body: msg}
+	if len(msg.Re) > 0 {
+		req.path = pathOf("messages", msg.Re, "replies")
+	}
+	var resp struct {
+		Id string `json:"id"`
+	}
+	err := c.call(ctx, req, &resp)
+	return resp.Id, err
+}
+
+func (c *msgstoreClient) GetMessage(ctx context.Context, msgid string) (msgstore.Message, error) {
+	var msg msgstore.Message
+	err := c.call(ctx, request{method: "GET", path: pathOf("messages", msgid)}, &msg)
+	return msg, err
+}
+
+// Get all messages of mailbox, following its pages.
+func (c *msgstoreClient) GetMessages(ctx context.Context, userid string) ([]msgstore.Message, error) {
+	var msgs []msgstore.Message
+	var query msgstore.MailboxQuery
+	for {
+		page, next, err := c.GetMessagesPage(ctx, userid, query)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, page...)
+		if len(next) == 0 {
+			return msgs, nil
+		}
+		query.Cursor = next
+	}
+}
+
+// Get a page of mailbox. A limit that is not positive gets the default page
+// size of the service.
+func (c *msgstoreClient) GetMessagesPage(ctx context.Context, userid string, query msgstore.MailboxQuery) ([]msgstore.Message, string, error) {
+	params := pageParams(query)
+	setBoolParam(params, "unread", query.Unread)
+	setBoolParam(params, "archived", query.Archived)
+	setParam(params, "from", query.From)
+	setParam(params, "group", query.Group)
+	setTimeParam(params, "since", query.Since)
+	setTimeParam(params, "until", query.Until)
+	setBoolParam(params, "replies_only", query.RepliesOnly)
+	setBoolParam(params, "roots_only", query.RootsOnly)
+
+	return c.getPage(ctx, request{method: "GET", path: pathOf("users", userid, "mailbox"), query: params})
+}
+
+// Get a page of sent messages. A limit that is not positive gets the default
+// page size of the service.
+func (c *msgstoreClient) GetSentMessages(ctx context.Context, userid string, query msgstore.MailboxQuery) ([]msgstore.Message, string, error) {
+	return c.getPage(ctx, request{method: "GET", path: pathOf("users", userid, "sent"), query: pageParams(query)})
+}
+
+func (c *msgstoreClient) getPage(ctx context.Context, req request) ([]msgstore.Message, string, error) {
+	var page struct {
+		Messages   []msgstore.Message `json:"messages"`
+		NextCursor string             `json:"next_cursor"`
+	}
+	err := c.call(ctx, req, &page)
+	return page.Messages, page.NextCursor, err
+}
+
+// Search messages received or sent by user. A limit that is not positive gets
+// the default number of messages of the service.
+func (c *msgstoreClient) SearchMessages(ctx context.Context, userid string, query msgstore.SearchQuery) ([]msgstore.SearchMatch, error) {
+	params := url.Values{"q": {query.Text}}
+	if query.Limit > 0 {
+		params.Set("limit", strconv.Itoa(query.Limit))
+	}
+	var resp struct {
+		Results []msgstore.SearchMatch `json:"results"`
+	}
+	err := c.call(ctx, request{method: "GET", path: pathOf("users", userid, "mailbox", "search"), query: params}, &resp)
+	return resp.Results, err
+}
+
+func (c *msgstoreClient) MarkRead(ctx context.Context, userid string, msgid string) error {
+	return c.call(ctx, request{method: "POST", path: pathOf("users", userid, "mailbox", msgid, "read")}, nil)
+}
+
+func (c *msgstoreClient) MarkUnread(ctx context.Context, userid string, msgid string) error {
+	return c.call(ctx, request{method: "POST", path: pathOf("users", userid, "mailbox", msgid, "unread")}, nil)
+}
+
+func (c *msgstoreClient) GetUnreadCount(ctx context.Context, userid string) (int64, error) {
+	var resp struct {
+		Unread int64 `json:"unread"`
+	}
+	err := c.call(ctx, request{method: "GET", path: pathOf("users", userid, "mailbox", "unread-count")}, &resp)
+	return resp.Unread, err
+}
+
+func (c *msgstoreClient) ArchiveMessage(ctx context.Context, userid string, msgid string) error {
+	return c.call(ctx, request{method: "POST", path: pathOf("users", userid, "mailbox", msgid, "archive")}, nil)
+}
+
+func (c *msgstoreClient) UnarchiveMessage(ctx context.Context, userid string, msgid string) error {
+	return c.call(ctx, request{method: "POST", path: pathOf("users", userid, "mailbox", msgid, "unarchive")}, nil)
+}
+
+func (c *msgstoreClient) DeleteMessage(ctx context.Context, userid string, msgid string) error {
+	return c.call(ctx, request{method: "DELETE", path: pathOf("users", userid, "mailbox", msgid)}, nil)
+}
+
+func (c *msgstoreClient) GetReplies(ctx context.Context, msgid string) ([]msgstore.Message, error) {
+	var msgs []msgstore.Message
+	err := c.call(ctx, request{method: "GET", path: pathOf("messages", msgid, "replies")}, &msgs)
+	return msgs, err
+}
+
+func (c *msgstoreClient) GetThread(ctx context.Context, msgid string) (msgstore.Thread, error) {
+	var t msgstore.Thread
+	err := c.call(ctx, request{method: "GET", path: pathOf("messages", msgid, "thread")}, &t)
+	return t, err
+}
+
+// Subscribe to server-sent events of user. The channel is closed when context
+// is done or the stream ends, in which case the client may subscribe again
+// after the id of last event it got.
+func (c *msgstoreClient) SubscribeEvents(ctx context.Context, userid string, after uint64) (<-chan msgstore.Event, error) {
+	header := http.Header{"Accept": {"text/event-stream"}}
+	if after > 0 {
+		header.Set("Last-Event-ID", strconv.FormatUint(after, 10))
+	}
+
+	resp, err := c.stream(ctx, request{method: "GET", path: pathOf("users", userid, "events")}, header)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan msgstore.Event)
+	go func() {
+		defer close(events)
+		defer resp.Body.Close()
+
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 4096), maxEventLineSize)
+
+		var ev msgstore.Event
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case len(line) == 0:
+				// blank line dispatches the event read so far
+				if len(ev.Type) == 0 {
+					continue
+				}
+				select {
+				case events <- ev:
+				case <-ctx.Done():
+					return
+				}
+				ev = msgstore.Event{}
+			case strings.HasPrefix(line, "id: "):
+				ev.Id, _ = strconv.ParseUint(strings.TrimPrefix(line, "id: "), 10, 64)
+			case strings.HasPrefix(line, "event: "):
+				ev.Type = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &ev.Message)
+			}
+		}
+	}()
+	return events, nil
+}
+
+// Get limit and cursor parameters of query
+func pageParams(query msgstore.MailboxQuery) url.Values {
+	params := url.Values{}
+	setParam(params, "cursor", query.Cursor)
+	if query.Limit > 0 {
+		params.Set("limit", strconv.Itoa(query.Limit))
+	}
+	return params
+}
+
+func setParam(params url.Values, name string, value string) {
+	if len(value) > 0 {
+		params.Set(name, value)
+	}
+}
+
+func setBoolParam(params url.Values, name string, value bool) {
+	if value {
+		params.Set(name, "true")
+	}
+}
+
+func setTimeParam(params url.Values, name string, value time.Time) {
+	if !value.IsZero() {
+		params.Set(name, value.Format(time.RFC3339Nano))
+	}
+}
@@ -0,0 +1,174 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/ghsbhatia/msgbox/pkg/useradmin"
+)
+
+// Create a client of useradmin service at given instance, such as
+// http://localhost:6060. Failures are reported with the errors of useradmin
+// package.
+func NewUserAdminClient(instance string, options ...ClientOption) (useradmin.Service, error) {
+	errs := []error{
+		useradmin.ErrBadRequest,
+		useradmin.ErrUserExists,
+		useradmin.ErrUserNotFound,
+		useradmin.ErrGroupExists,
+		useradmin.ErrGroupNotFound,
+		useradmin.ErrGroupEmpty,
+		useradmin.ErrNotGroupMember,
+		useradmin.ErrForbidden,
+	}
+	statuses := map[int]error{
+		http.StatusBadRequest: useradmin.ErrBadRequest,
+		http.StatusForbidden:  useradmin.ErrForbidden,
+		http.StatusNotFound:   useradmin.ErrUserNotFound,
+		http.StatusConflict:   useradmin.ErrUserExists,
+	}
+	c, err := newHttpClient(instance, errs, statuses, options...)
+	if err != nil {
+		return nil, err
+	}
+	return &useradminClient{c}, nil
+}
+
+// useradmin.Service implementation calling useradmin over HTTP
+type useradminClient struct {
+	*httpClient
+}
+
+// Group names as listed by useradmin
+type groupList struct {
+	Groups []struct {
+		Groupname string `json:"groupname"`
+	} `json:"groups"`
+	NextCursor string `json:"next_cursor"`
+}
+
+func (l groupList) names() []string {
+	names := make([]string, 0, len(l.Groups))
+	for _, group := range l.Groups {
+		names = append(names, group.Groupname)
+	}
+	return names
+}
+
+// Register user named by its id along with its profile.
+func (c *useradminClient) RegisterUser(ctx context.Context, u useradmin.UserDetails) (useradmin.UserDetails, error) {
+	body := map[string]interface{}{
+		"username":    u.Id,
+		"displayName": u.DisplayName,
+		"email":       u.Email,
+		"attributes":  u.Attributes,
+	}
+	var registered useradmin.UserDetails
+	err := c.call(ctx, request{method: "POST", path: "/users", body: body}, &registered)
+	return registered, err
+}
+
+func (c *useradminClient) GetUser(ctx context.Context, username string) (useradmin.UserDetails, error) {
+	var u useradmin.UserDetails
+	err := c.call(ctx, request{method: "GET", path: pathOf("users", username)}, &u)
+	return u, err
+}
+
+// List users. A limit that is not positive gets the default page size of the
+// service.
+func (c *useradminClient) ListUsers(ctx context.Context, query useradmin.ListQuery) ([]useradmin.UserDetails, string, error) {
+	var page struct {
+		Users      []useradmin.UserDetails `json:"users"`
+		NextCursor string                  `json:"next_cursor"`
+	}
+	err := c.call(ctx, request{method: "GET", path: "/users", query: listParams(query)}, &page)
+	return page.Users, page.NextCursor, err
+}
+
+func (c *useradminClient) GetUserGroups(ctx context.Context, username string) ([]string, error) {
+	var groups groupList
+	err := c.call(ctx, request{method: "GET", path: pathOf("users", username, "groups")}, &groups)
+	return groups.names(), err
+}
+
+func (c *useradminClient) DeleteUser(ctx context.Context, username string) error {
+	return c.call(ctx, request{method: "DELETE", path: pathOf("users", username)}, nil)
+}
+
+func (c *useradminClient) DeactivateUser(ctx context.Context, username string) error {
+	return c.call(ctx, request{method: "POST", path: pathOf("users", username, "deactivate")}, nil)
+}
+
+func (c *useradminClient) ActivateUser(ctx context.Context, username string) error {
+	return c.call(ctx, request{method: "POST", path: pathOf("users", username, "activate")}, nil)
+}
+
+func (c *useradminClient) SetUserRole(ctx context.Context, username string, role string) error {
+	body := map[string]string{"role": role}
+	return c.call(ctx, request{method: "PUT", path: pathOf("users", username, "role"), body: body}, nil)
+}
+
+func (c *useradminClient) RegisterGroup(ctx context.Context, groupname string, usernames []string) (string, error) {
+	body := map[string]interface{}{"groupname": groupname, "usernames": usernames}
+	var resp struct {
+		Id string `json:"id"`
+	}
+	err := c.call(ctx, request{method: "POST", path: "/groups", body: body}, &resp)
+	return resp.Id, err
+}
+
+func (c *useradminClient) GetGroup(ctx context.Context, groupname string) (useradmin.GroupDetails, error) {
+	var g useradmin.GroupDetails
+	err := c.call(ctx, request{method: "GET", path: pathOf("groups", groupname)}, &g)
+	return g, err
+}
+
+// List groups. A limit that is not positive gets the default page size of the
+// service.
+func (c *useradminClient) ListGroups(ctx context.Context, query useradmin.ListQuery) ([]string, string, error) {
+	var groups groupList
+	err := c.call(ctx, request{method: "GET", path: "/groups", query: listParams(query)}, &groups)
+	return groups.names(), groups.NextCursor, err
+}
+
+func (c *useradminClient) AddGroupUsers(ctx context.Context, groupname string, usernames []string) error {
+	body := map[string][]string{"usernames": usernames}
+	return c.call(ctx, request{method: "POST", path: pathOf("groups", groupname, "members"), body: body}, nil)
+}
+
+func (c *useradminClient) RemoveGroupUser(ctx context.Context, groupname string, username string) error {
+	return c.call(ctx, request{method: "DELETE", path: pathOf("groups", groupname, "members", username)}, nil)
+}
+
+func (c *useradminClient) DeleteGroup(ctx context.Context, groupname string) error {
+	return c.call(ctx, request{method: "DELETE", path: pathOf("groups", groupname)}, nil)
+}
+
+func (c *useradminClient) SetGroupPolicy(ctx context.Context, groupname string, policy string) error {
+	body := map[string]string{"policy": policy}
+	return c.call(ctx, request{method: "PUT", path: pathOf("groups", groupname, "policy"), body: body}, nil)
+}
+
+func (c *useradminClient) SetGroupModerator(ctx context.Context, groupname string, username string, moderator bool) error {
+	method := "PUT"
+	if !moderator {
+		method = "DELETE"
+	}
+	return c.call(ctx, request{method: method, path: pathOf("groups", groupname, "moderators", username)}, nil)
+}
+
+// Get query parameters of a list query
+func listParams(query useradmin.ListQuery) url.Values {
+	params := url.Values{}
+	setParam(params, "prefix", query.Prefix)
+	setParam(params, "cursor", query.Cursor)
+	if query.Limit > 0 {
+		params.Set("limit", strconv.Itoa(query.Limit))
+	}
+	if query.Descending {
+		params.Set("sort", "-name")
+	}
+	return params
+}
@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/go-kit/kit/log"
+)
+
+// Error reported when a request does not carry a valid bearer token
+var ErrUnauthorized = errors.New("unauthorized")
+
+// Query parameter carrying the bearer token of websocket upgrade requests, as
+// browsers can not set headers on those
+const accessTokenParam = "access_token"
+
+// HTTPAuthenticator wraps an http.Handler and admits only requests carrying a
+// bearer token that is a JWT signed with HMAC using the configured key. The
+// token is taken from the Authorization header, or for websocket upgrade
+// requests without one, from the access_token query parameter. The subject of
+// the token and the token itself are made available to the handler through
+// the request context.
+type HTTPAuthenticator struct {
+	handler http.Handler
+	key     []byte
+	logger  log.Logger
+}
+
+func NewHTTPAuthenticator(handler http.Handler, key []byte, logger log.Logger) *HTTPAuthenticator {
+	return &HTTPAuthenticator{handler, key, logger}
+}
+
+// ServeHTTP implements http.Handler.
+func (mw *HTTPAuthenticator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	header := r.Header.Get("Authorization")
+	if len(header) == 0 && strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		if token := r.URL.Query().Get(accessTokenParam); len(token) > 0 {
+			header = "Bearer " + token
+		}
+	}
+	token, subject, err := authenticate(mw.key, header)
+	if err != nil {
+		mw.logger.Log("http_method", r.Method, "http_path", r.URL.Path, "auth", "rejected", "err", err)
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": ErrUnauthorized.Error(),
+		})
+		return
+	}
+	mw.handler.ServeHTTP(w, r.WithContext(NewAuthContext(r.Context(), subject, token)))
+}
+
+// Validate bearer token of given authorization header with given key and get
+// its subject.
+func authenticate(key []byte, header string) (string, string, error) {
+	if len(header) < len("Bearer ") || !strings.EqualFold(header[:len("Bearer ")], "Bearer ") {
+		return "", "", errors.New("missing bearer token")
+	}
+	token := strings.TrimSpace(header[len("Bearer "):])
+	claims := &jwt.StandardClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method " + t.Method.Alg())
+		}
+		return key, nil
+	})
+	if err != nil {
+		return "", "", err
+	}
+	if len(claims.Subject) == 0 {
+		return "", "", errors.New("token has no subject")
+	}
+	return token, claims.Subject, nil
+}
+
+// NewAuthContext returns a context carrying given authenticated subject and
+// the token it was authenticated with.
+func NewAuthContext(ctx context.Context, subject string, token string) context.Context {
+	return context.WithValue(ctx, authkey, authentication{subject, token})
+}
+
+// Subject returns the authenticated subject of request context, if any.
+func Subject(ctx context.Context) (string, bool) {
+	auth, ok := ctx.Value(authkey).(authentication)
+	return auth.subject, ok
+}
+
+// Token returns the bearer token request context was authenticated with, or
+// empty string for an unauthenticated context.
+func Token(ctx context.Context) string {
+	auth, _ := ctx.Value(authkey).(authentication)
+	return auth.token
+}
+
+type authentication struct {
+	subject string
+	token   string
+}
+
+type authkeytype struct{}
+
+var authkey = authkeytype{}
@@ -0,0 +1,143 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+)
+
+var testKey = []byte("secret")
+
+// Test executor for http authenticator
+func TestHTTPAuthenticator(t *testing.T) {
+	s := &authTestSuite{}
+	t.Run("ValidToken", func(t *testing.T) { s.testValidToken(t) })
+	t.Run("MissingToken", func(t *testing.T) { s.testMissingToken(t) })
+	t.Run("InvalidSignature", func(t *testing.T) { s.testInvalidSignature(t) })
+	t.Run("UnsignedToken", func(t *testing.T) { s.testUnsignedToken(t) })
+	t.Run("ExpiredToken", func(t *testing.T) { s.testExpiredToken(t) })
+	t.Run("NoSubject", func(t *testing.T) { s.testNoSubject(t) })
+	t.Run("WebsocketQueryToken", func(t *testing.T) { s.testWebsocketQueryToken(t) })
+}
+
+// Test suite for http authenticator
+type authTestSuite struct{}
+
+// Get a signed token for given claims
+func signed(claims jwt.StandardClaims, key []byte) string {
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+	return token
+}
+
+// Serve a request with given authorization header and get the response
+// along with subject and token seen by the wrapped handler.
+func (s *authTestSuite) serve(header string) (*http.Response, string, string) {
+	var subject, token string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subject, _ = Subject(r.Context())
+		token = Token(r.Context())
+	})
+
+	req := httptest.NewRequest("GET", "http://foo.com/users/alice/mailbox", nil)
+	if len(header) > 0 {
+		req.Header.Set("Authorization", header)
+	}
+	w := httptest.NewRecorder()
+
+	NewHTTPAuthenticator(handler, testKey, log.NewNopLogger()).ServeHTTP(w, req)
+
+	return w.Result(), subject, token
+}
+
+// Test scenario - Request with a valid token
+func (s *authTestSuite) testValidToken(t *testing.T) {
+	token := signed(jwt.StandardClaims{Subject: "alice"}, testKey)
+
+	resp, subject, seen := s.serve("Bearer " + token)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "alice", subject)
+	assert.Equal(t, token, seen)
+}
+
+// Test scenario - Request without a token
+func (s *authTestSuite) testMissingToken(t *testing.T) {
+	resp, subject, _ := s.serve("")
+
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, "Bearer", resp.Header.Get("WWW-Authenticate"))
+	assert.Empty(t, subject)
+}
+
+// Test scenario - Request with a token signed with another key
+func (s *authTestSuite) testInvalidSignature(t *testing.T) {
+	token := signed(jwt.StandardClaims{Subject: "alice"}, []byte("other"))
+
+	resp, subject, _ := s.serve("Bearer " + token)
+
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Empty(t, subject)
+}
+
+// Test scenario - Request with an unsigned token
+func (s *authTestSuite) testUnsignedToken(t *testing.T) {
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.StandardClaims{Subject: "alice"}).
+		SignedString(jwt.UnsafeAllowNoneSignatureType)
+
+	resp, subject, _ := s.serve("Bearer " + token)
+
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Empty(t, subject)
+}
+
+// Test scenario - Request with an expired token
+func (s *authTestSuite) testExpiredToken(t *testing.T) {
+	token := signed(jwt.StandardClaims{Subject: "alice", ExpiresAt: 1}, testKey)
+
+	resp, subject, _ := s.serve("Bearer " + token)
+
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Empty(t, subject)
+}
+
+// Test scenario - Request with a token that names no subject
+func (s *authTestSuite) testNoSubject(t *testing.T) {
+	token := signed(jwt.StandardClaims{}, testKey)
+
+	resp, subject, _ := s.serve("Bearer " + token)
+
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Empty(t, subject)
+}
+
+// Test scenario - Token in query parameter is accepted for websocket upgrade
+// requests only
+func (s *authTestSuite) testWebsocketQueryToken(t *testing.T) {
+	token := signed(jwt.StandardClaims{Subject: "alice"}, testKey)
+
+	var subject string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subject, _ = Subject(r.Context())
+	})
+	authenticator := NewHTTPAuthenticator(handler, testKey, log.NewNopLogger())
+
+	req := httptest.NewRequest("GET", "http://foo.com/users/alice/ws?access_token="+token, nil)
+	req.Header.Set("Upgrade", "websocket")
+	w := httptest.NewRecorder()
+	authenticator.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "alice", subject)
+
+	subject = ""
+	req = httptest.NewRequest("GET", "http://foo.com/users/alice/mailbox?access_token="+token, nil)
+	w = httptest.NewRecorder()
+	authenticator.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Empty(t, subject)
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"github.com/ghsbhatia/msgbox/pkg/ctxlog"
+	"github.com/go-kit/kit/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// NewGRPCInterceptor returns a grpc server interceptor that performs
+// structured request logging, as HTTPInterceptor does for http requests.
+func NewGRPCInterceptor(logger log.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		ctx, ctxlogger := ctxlog.NewLogger(ctx, "grpc_method", info.FullMethod)
+
+		defer func(begin time.Time) {
+			ctxlogger.Log("grpc_code", status.Code(err), "grpc_duration", time.Since(begin))
+			logger.Log(ctxlogger.Keyvals()...)
+		}(time.Now())
+
+		return handler(ctx, req)
+	}
+}
+
+// NewGRPCAuthenticator returns a grpc server interceptor that admits only
+// requests carrying a bearer token in authorization metadata, validated as
+// HTTPAuthenticator does. The subject of the token and the token itself are
+// made available to the handler through the request context.
+func NewGRPCAuthenticator(key []byte, logger log.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		var header string
+		if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get("authorization")) > 0 {
+			header = md.Get("authorization")[0]
+		}
+		token, subject, err := authenticate(key, header)
+		if err != nil {
+			logger.Log("grpc_method", info.FullMethod, "auth", "rejected", "err", err)
+			return nil, status.Error(codes.Unauthenticated, ErrUnauthorized.Error())
+		}
+		return handler(NewAuthContext(ctx, subject, token), req)
+	}
+}
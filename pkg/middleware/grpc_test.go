@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Test executor for grpc authenticator
+func TestGRPCAuthenticator(t *testing.T) {
+	s := &grpcAuthTestSuite{}
+	t.Run("ValidToken", func(t *testing.T) { s.testValidToken(t) })
+	t.Run("MissingToken", func(t *testing.T) { s.testMissingToken(t) })
+	t.Run("InvalidSignature", func(t *testing.T) { s.testInvalidSignature(t) })
+}
+
+// Test suite for grpc authenticator
+type grpcAuthTestSuite struct{}
+
+// Intercept a request with given authorization metadata and get the result
+// along with subject and token seen by the handler.
+func (s *grpcAuthTestSuite) intercept(header string) (interface{}, error, string, string) {
+	var subject, token string
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		subject, _ = Subject(ctx)
+		token = Token(ctx)
+		return "ok", nil
+	}
+
+	ctx := context.TODO()
+	if len(header) > 0 {
+		ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", header))
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/pb.MsgStore/GetMessage"}
+
+	resp, err := NewGRPCAuthenticator(testKey, log.NewNopLogger())(ctx, nil, info, handler)
+
+	return resp, err, subject, token
+}
+
+// Test scenario - Request with a valid token
+func (s *grpcAuthTestSuite) testValidToken(t *testing.T) {
+	token := signed(jwt.StandardClaims{Subject: "alice"}, testKey)
+
+	resp, err, subject, seen := s.intercept("Bearer " + token)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", resp)
+	assert.Equal(t, "alice", subject)
+	assert.Equal(t, token, seen)
+}
+
+// Test scenario - Request without a token
+func (s *grpcAuthTestSuite) testMissingToken(t *testing.T) {
+	resp, err, subject, _ := s.intercept("")
+
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.Empty(t, subject)
+}
+
+// Test scenario - Request with a token signed with another key
+func (s *grpcAuthTestSuite) testInvalidSignature(t *testing.T) {
+	token := signed(jwt.StandardClaims{Subject: "alice"}, []byte("other"))
+
+	_, err, subject, _ := s.intercept("Bearer " + token)
+
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.Empty(t, subject)
+}
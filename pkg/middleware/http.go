@@ -1,6 +1,9 @@
 package middleware
 
 import (
+	"bufio"
+	"errors"
+	"net"
 	"net/http"
 	"time"
 
@@ -43,3 +46,21 @@ func (iw *interceptingWriter) WriteHeader(code int) {
 	iw.code = code
 	iw.ResponseWriter.WriteHeader(code)
 }
+
+// Flush implements http.Flusher, so that handlers can stream responses.
+func (iw *interceptingWriter) Flush() {
+	if flusher, ok := iw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker, so that handlers can take over the
+// connection, e.g. to switch to websocket protocol.
+func (iw *interceptingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := iw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	iw.code = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
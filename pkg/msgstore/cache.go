@@ -0,0 +1,169 @@
+package msgstore
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+)
+
+// Kinds of lookups against user service held by LookupCache
+const (
+	userLookup  = "user"
+	groupLookup = "group"
+)
+
+// Cache of user and group lookups against user service. Found users and groups
+// are kept for ttl and lookups of unknown users and groups for negativettl.
+// Lookups that fail for any other reason are not cached. The cache holds at
+// most size lookups; when it is full, expired lookups are swept and then
+// others are dropped to make room. Concurrent lookups of the same user or
+// group share a single fetch.
+type LookupCache struct {
+	mtx         sync.Mutex
+	ttl         time.Duration
+	negativettl time.Duration
+	size        int
+	entries     map[string]lookupEntry    // entries keyed by kind and id
+	pending     map[string]*pendingLookup // fetches in flight keyed by kind and id
+	hits        metrics.Counter
+	misses      metrics.Counter
+	now         func() time.Time
+}
+
+// Cached result of a lookup
+type lookupEntry struct {
+	value   interface{}
+	err     error
+	expires time.Time
+}
+
+// Fetch in flight, whose result is shared by lookups made while it runs
+type pendingLookup struct {
+	done  chan struct{} // closed once value and err are set
+	value interface{}
+	err   error
+}
+
+// Get a new instance of lookup cache holding at most size lookups. Hits and
+// misses are counted with given counters, labelled by kind of lookup.
+func NewLookupCache(ttl, negativettl time.Duration, size int, hits, misses metrics.Counter) *LookupCache {
+	return &LookupCache{
+		ttl:         ttl,
+		negativettl: negativettl,
+		size:        size,
+		entries:     make(map[string]lookupEntry),
+		pending:     make(map[string]*pendingLookup),
+		hits:        hits,
+		misses:      misses,
+		now:         time.Now,
+	}
+}
+
+// Get result of lookup of given kind and id from cache, or from fetch when it
+// is not cached or has expired. A lookup made while the same one is fetched
+// waits for that fetch instead of making its own, unless the fetch is cut short
+// by the context of the lookup that made it.
+func (c *LookupCache) lookup(kind, id string, fetch func() (interface{}, error)) (interface{}, error) {
+	if c == nil {
+		return fetch()
+	}
+
+	key := kind + ":" + id
+
+	for {
+		c.mtx.Lock()
+		entry, ok := c.entries[key]
+		if ok && c.now().Before(entry.expires) {
+			c.mtx.Unlock()
+			c.hits.With("lookup", kind).Add(1)
+			return entry.value, entry.err
+		}
+		if p, ok := c.pending[key]; ok {
+			c.mtx.Unlock()
+			<-p.done
+			if p.err == context.Canceled || p.err == context.DeadlineExceeded {
+				continue
+			}
+			c.hits.With("lookup", kind).Add(1)
+			return p.value, p.err
+		}
+		p := &pendingLookup{done: make(chan struct{})}
+		c.pending[key] = p
+		delete(c.entries, key)
+		c.mtx.Unlock()
+
+		c.misses.With("lookup", kind).Add(1)
+
+		p.value, p.err = fetch()
+
+		ttl := c.ttl
+		if p.err != nil {
+			ttl = c.negativettl
+			if !isNotFound(p.err) {
+				ttl = 0
+			}
+		}
+		c.mtx.Lock()
+		delete(c.pending, key)
+		if ttl > 0 && c.size > 0 {
+			if _, ok := c.entries[key]; !ok && len(c.entries) >= c.size {
+				c.evict()
+			}
+			c.entries[key] = lookupEntry{p.value, p.err, c.now().Add(ttl)}
+		}
+		c.mtx.Unlock()
+		close(p.done)
+
+		return p.value, p.err
+	}
+}
+
+// Remove cached lookup of given user.
+func (c *LookupCache) InvalidateUser(userid string) {
+	c.invalidate(userLookup + ":" + userid)
+}
+
+// Remove cached lookup of given group.
+func (c *LookupCache) InvalidateGroup(groupid string) {
+	c.invalidate(groupLookup + ":" + groupid)
+}
+
+// Remove all cached lookups.
+func (c *LookupCache) InvalidateAll() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.entries = make(map[string]lookupEntry)
+}
+
+// Make room in a full cache by removing expired lookups, and then others until
+// it is at most three quarters full, so that a cache full of lookups that have
+// not expired is not swept again on each lookup. Called with mutex held.
+func (c *LookupCache) evict() {
+	now := c.now()
+	for key, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+	for key := range c.entries {
+		if len(c.entries) <= c.size*3/4 {
+			break
+		}
+		delete(c.entries, key)
+	}
+}
+
+func (c *LookupCache) invalidate(key string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	delete(c.entries, key)
+}
+
+// Check if lookup failed because user or group does not exist.
+func isNotFound(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, user_not_found) || strings.Contains(msg, group_not_found)
+}
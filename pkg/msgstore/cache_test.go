@@ -0,0 +1,288 @@
+package msgstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ghsbhatia/msgbox/pkg/svcclient"
+	"github.com/go-kit/kit/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// Counter that ignores labels and keeps a single count
+type testCounter struct {
+	mtx   sync.Mutex
+	value float64
+}
+
+func (c *testCounter) With(labelValues ...string) metrics.Counter { return c }
+func (c *testCounter) Add(delta float64) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.value += delta
+}
+
+// Test executor for lookup cache
+func TestLookupCache(t *testing.T) {
+	s := &cacheTestSuite{}
+	t.Run("Hit", func(t *testing.T) { s.testHit(t) })
+	t.Run("Expiry", func(t *testing.T) { s.testExpiry(t) })
+	t.Run("NotFound", func(t *testing.T) { s.testNotFound(t) })
+	t.Run("Unavailable", func(t *testing.T) { s.testUnavailable(t) })
+	t.Run("Invalidate", func(t *testing.T) { s.testInvalidate(t) })
+	t.Run("Size", func(t *testing.T) { s.testSize(t) })
+	t.Run("ConcurrentMisses", func(t *testing.T) { s.testConcurrentMisses(t) })
+	t.Run("CancelledFetch", func(t *testing.T) { s.testCancelledFetch(t) })
+	t.Run("ServiceLookups", func(t *testing.T) { s.testServiceLookups(t) })
+}
+
+// Test suite for lookup cache
+type cacheTestSuite struct{}
+
+// Get a cache with a clock that tests can move forward
+func (s *cacheTestSuite) newCache() (*LookupCache, *testCounter, *testCounter, *time.Time) {
+	hits, misses := &testCounter{}, &testCounter{}
+	cache := NewLookupCache(time.Minute, time.Second, 8, hits, misses)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+	return cache, hits, misses, &now
+}
+
+// Get a fetch function that counts its calls
+func counting(calls *int, value interface{}, err error) func() (interface{}, error) {
+	return func() (interface{}, error) {
+		*calls++
+		return value, err
+	}
+}
+
+// Test scenario - Repeated lookup is served from cache
+func (s *cacheTestSuite) testHit(t *testing.T) {
+	cache, hits, misses, _ := s.newCache()
+
+	calls := 0
+	for i := 0; i < 3; i++ {
+		value, err := cache.lookup(userLookup, "alice", counting(&calls, "alice", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, "alice", value)
+	}
+
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, 2.0, hits.value)
+	assert.Equal(t, 1.0, misses.value)
+}
+
+// Test scenario - Lookup is fetched again once it expires
+func (s *cacheTestSuite) testExpiry(t *testing.T) {
+	cache, _, _, now := s.newCache()
+
+	calls := 0
+	cache.lookup(userLookup, "alice", counting(&calls, "alice", nil))
+	*now = now.Add(59 * time.Second)
+	cache.lookup(userLookup, "alice", counting(&calls, "alice", nil))
+	assert.Equal(t, 1, calls)
+
+	*now = now.Add(time.Second)
+	cache.lookup(userLookup, "alice", counting(&calls, "alice", nil))
+	assert.Equal(t, 2, calls)
+}
+
+// Test scenario - Lookup of unknown user is cached for negative ttl
+func (s *cacheTestSuite) testNotFound(t *testing.T) {
+	cache, _, _, now := s.newCache()
+
+	calls := 0
+	notfound := errors.New(user_not_found)
+	_, err := cache.lookup(userLookup, "bob", counting(&calls, "", notfound))
+	assert.Equal(t, notfound, err)
+	_, err = cache.lookup(userLookup, "bob", counting(&calls, "", notfound))
+	assert.Equal(t, notfound, err)
+	assert.Equal(t, 1, calls)
+
+	*now = now.Add(time.Second)
+	cache.lookup(userLookup, "bob", counting(&calls, "", notfound))
+	assert.Equal(t, 2, calls)
+}
+
+// Test scenario - Lookup that fails for other reasons is not cached
+func (s *cacheTestSuite) testUnavailable(t *testing.T) {
+	cache, _, _, _ := s.newCache()
+
+	calls := 0
+	cache.lookup(groupLookup, "friends", counting(&calls, []string(nil), svcclient.ErrUnavailable))
+	value, err := cache.lookup(groupLookup, "friends", counting(&calls, []string{"alice"}, nil))
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"alice"}, value)
+	assert.Equal(t, 2, calls)
+}
+
+// Test scenario - Invalidated lookups are fetched again
+func (s *cacheTestSuite) testInvalidate(t *testing.T) {
+	cache, _, _, _ := s.newCache()
+
+	calls := 0
+	cache.lookup(userLookup, "alice", counting(&calls, "alice", nil))
+	cache.lookup(groupLookup, "alice", counting(&calls, []string{"alice"}, nil))
+
+	cache.InvalidateUser("alice")
+	cache.lookup(userLookup, "alice", counting(&calls, "alice", nil))
+	cache.lookup(groupLookup, "alice", counting(&calls, []string{"alice"}, nil))
+	assert.Equal(t, 3, calls)
+
+	cache.InvalidateGroup("alice")
+	cache.lookup(groupLookup, "alice", counting(&calls, []string{"alice"}, nil))
+	assert.Equal(t, 4, calls)
+
+	cache.InvalidateAll()
+	cache.lookup(userLookup, "alice", counting(&calls, "alice", nil))
+	cache.lookup(groupLookup, "alice", counting(&calls, []string{"alice"}, nil))
+	assert.Equal(t, 6, calls)
+}
+
+// Test scenario - Lookups of many ids do not grow cache beyond its size
+func (s *cacheTestSuite) testSize(t *testing.T) {
+	cache, _, _, now := s.newCache()
+
+	calls := 0
+	notfound := errors.New(user_not_found)
+	for i := 0; i < 100; i++ {
+		cache.lookup(userLookup, fmt.Sprintf("user%d", i), counting(&calls, "", notfound))
+		assert.True(t, len(cache.entries) <= 8)
+	}
+
+	// expired lookups are swept before others are dropped
+	cache.InvalidateAll()
+	for i := 0; i < 7; i++ {
+		cache.lookup(userLookup, fmt.Sprintf("user%d", i), counting(&calls, "", notfound))
+	}
+	*now = now.Add(time.Second)
+	cache.lookup(userLookup, "alice", counting(&calls, "alice", nil))
+	cache.lookup(userLookup, "bob", counting(&calls, "bob", nil))
+	assert.Equal(t, 2, len(cache.entries))
+
+	calls = 0
+	cache.lookup(userLookup, "alice", counting(&calls, "alice", nil))
+	assert.Equal(t, 0, calls)
+}
+
+// Get a fetch function that counts its calls and waits for release before
+// returning
+func blocking(calls *int32, release <-chan struct{}, value interface{}, err error) func() (interface{}, error) {
+	return func() (interface{}, error) {
+		atomic.AddInt32(calls, 1)
+		<-release
+		return value, err
+	}
+}
+
+// Run given number of lookups of alice at the same time and wait for them
+func concurrentLookups(cache *LookupCache, lookups int, fetch func() (interface{}, error)) ([]interface{}, []error) {
+	values, errs := make([]interface{}, lookups), make([]error, lookups)
+	var wg sync.WaitGroup
+	for i := 0; i < lookups; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			values[i], errs[i] = cache.lookup(userLookup, "alice", fetch)
+		}(i)
+	}
+	wg.Wait()
+	return values, errs
+}
+
+// Test scenario - Concurrent lookups of a user that is not cached share a
+// single fetch
+func (s *cacheTestSuite) testConcurrentMisses(t *testing.T) {
+	cache, hits, misses, _ := s.newCache()
+
+	var calls int32
+	release := make(chan struct{})
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(release)
+	}()
+	values, errs := concurrentLookups(cache, 10, blocking(&calls, release, "alice", nil))
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	for i := range values {
+		assert.NoError(t, errs[i])
+		assert.Equal(t, "alice", values[i])
+	}
+	assert.Equal(t, 9.0, hits.value)
+	assert.Equal(t, 1.0, misses.value)
+}
+
+// Test scenario - Lookups waiting on a fetch cut short by the context of
+// another lookup fetch for themselves
+func (s *cacheTestSuite) testCancelledFetch(t *testing.T) {
+	cache, _, _, _ := s.newCache()
+
+	var calls int32
+	release := make(chan struct{})
+	fetch := func() (interface{}, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			<-release
+			return "", context.Canceled
+		}
+		return "alice", nil
+	}
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(release)
+	}()
+	values, errs := concurrentLookups(cache, 3, fetch)
+
+	canceled := 0
+	for i := range values {
+		if errs[i] == context.Canceled {
+			canceled++
+			continue
+		}
+		assert.NoError(t, errs[i])
+		assert.Equal(t, "alice", values[i])
+	}
+	assert.Equal(t, 1, canceled)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+// Counting svc client that returns a group of users
+type countingSvcClient struct {
+	MockedSvcClient
+	calls int
+}
+
+func (m *countingSvcClient) Get(ctx context.Context, url string, v interface{}) error {
+	m.calls++
+	return m.MockedSvcClient.Get(ctx, url, v)
+}
+
+// Test scenario - Service looks up users and groups only once
+func (s *cacheTestSuite) testServiceLookups(t *testing.T) {
+	ctx := context.TODO()
+
+	cache, _, _, _ := s.newCache()
+
+	client := &countingSvcClient{MockedSvcClient: MockedSvcClient{"tstgroup", []string{"user1", "user2"}}}
+
+	repository := new(MockedRepository)
+	repository.On("StoreMessage", ctx, mock.Anything).Return("id:01", nil)
+
+	service := NewService(repository, client, "/foo", WithLookupCache(cache))
+
+	rcv := Receiver{Groupname: "tstgroup"}
+	msg := Message{Sender: "tester", Subject: "test", Body: "body", Recipient: rcv}
+
+	for i := 0; i < 3; i++ {
+		_, err := service.StoreMessage(ctx, msg)
+		assert.NoError(t, err)
+	}
+
+	assert.Equal(t, 2, client.calls)
+}
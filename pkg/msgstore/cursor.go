@@ -0,0 +1,46 @@
+package msgstore
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error reported when a page cursor can not be decoded
+var errInvalidCursor = errors.New(invalid_cursor)
+
+// Encode position of given record into an opaque page cursor. Pages are ordered
+// by timestamp and id, both descending, so the position is the pair of these.
+func encodeCursor(record Record) string {
+	position := fmt.Sprintf("%d:%s", record.Timestamp.UnixNano(), record.Id)
+	return base64.RawURLEncoding.EncodeToString([]byte(position))
+}
+
+// Decode an opaque page cursor into timestamp and id of last record on the
+// previous page.
+func decodeCursor(cursor string) (time.Time, string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", errInvalidCursor
+	}
+	parts := strings.SplitN(string(data), ":", 2)
+	if len(parts) != 2 || len(parts[1]) == 0 {
+		return time.Time{}, "", errInvalidCursor
+	}
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, "", errInvalidCursor
+	}
+	return time.Unix(0, nanos), parts[1], nil
+}
+
+// Check if record sorts after the cursor position, i.e. belongs to next page.
+func afterCursor(record Record, timestamp time.Time, id string) bool {
+	if record.Timestamp.Equal(timestamp) {
+		return record.Id < id
+	}
+	return record.Timestamp.Before(timestamp)
+}
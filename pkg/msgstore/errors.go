@@ -8,4 +8,8 @@ var ErrBadRequest = errors.New("invalid request")
 var ErrMsgNotFound = errors.New("message not found")
 var ErrUserNotFound = errors.New("user not found")
 var ErrGroupNotFound = errors.New("group not found")
+var ErrUserDeactivated = errors.New("user is deactivated")
+var ErrForbidden = errors.New("operation not permitted")
+var ErrPostingNotPermitted = errors.New("not permitted to post to group")
 var ErrSystemError = errors.New("system error")
+var ErrUpstreamUnavailable = errors.New("upstream service unavailable")
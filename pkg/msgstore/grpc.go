@@ -0,0 +1,232 @@
+package msgstore
+
+import (
+	"context"
+	"net/http"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/transport"
+	kitgrpc "github.com/go-kit/kit/transport/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/ghsbhatia/msgbox/pkg/middleware"
+	"github.com/ghsbhatia/msgbox/pkg/msgstore/pb"
+)
+
+// Create grpc server for servicing message store requests. Requests are served
+// by the same endpoints as http requests and failures are reported with grpc
+// status codes corresponding to their http status codes.
+func MakeGRPCServer(service Service, logger kitlog.Logger) pb.MsgStoreServer {
+
+	opts := []kitgrpc.ServerOption{
+		kitgrpc.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
+	}
+
+	return &grpcServer{
+		storeMessage: kitgrpc.NewServer(
+			makeCreateMessageEndpoint(service),
+			decodeGRPCStoreMessageRequest,
+			encodeGRPCStoreMessageResponse,
+			opts...,
+		),
+		getMessage: kitgrpc.NewServer(
+			makeQueryMessageForIdEndpoint(service),
+			decodeGRPCGetMessageRequest,
+			encodeGRPCGetMessageResponse,
+			opts...,
+		),
+		getMessages: kitgrpc.NewServer(
+			makeQueryMessagesForUserEndpoint(service),
+			decodeGRPCGetMessagesRequest,
+			encodeGRPCGetMessagesResponse,
+			opts...,
+		),
+		getReplies: kitgrpc.NewServer(
+			makeQueryReplyEndpoint(service),
+			decodeGRPCGetRepliesRequest,
+			encodeGRPCGetRepliesResponse,
+			opts...,
+		),
+	}
+}
+
+type grpcServer struct {
+	storeMessage kitgrpc.Handler
+	getMessage   kitgrpc.Handler
+	getMessages  kitgrpc.Handler
+	getReplies   kitgrpc.Handler
+}
+
+func (s *grpcServer) StoreMessage(ctx context.Context, req *pb.StoreMessageRequest) (*pb.StoreMessageReply, error) {
+	_, rep, err := s.storeMessage.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return rep.(*pb.StoreMessageReply), nil
+}
+
+func (s *grpcServer) GetMessage(ctx context.Context, req *pb.GetMessageRequest) (*pb.GetMessageReply, error) {
+	_, rep, err := s.getMessage.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return rep.(*pb.GetMessageReply), nil
+}
+
+func (s *grpcServer) GetMessages(ctx context.Context, req *pb.GetMessagesRequest) (*pb.GetMessagesReply, error) {
+	_, rep, err := s.getMessages.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return rep.(*pb.GetMessagesReply), nil
+}
+
+func (s *grpcServer) GetReplies(ctx context.Context, req *pb.GetRepliesRequest) (*pb.GetRepliesReply, error) {
+	_, rep, err := s.getReplies.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return rep.(*pb.GetRepliesReply), nil
+}
+
+// Decode a new message, or a reply when it refers to the original message,
+// validating it as http requests are validated.
+func decodeGRPCStoreMessageRequest(ctx context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.StoreMessageRequest)
+	msg := messageOf(req.Message)
+
+	// Authenticated requests are always sent by the subject of their token
+	if subject, ok := middleware.Subject(ctx); ok {
+		msg.Sender = subject
+	}
+
+	if len(msg.Re) > 0 {
+		if !validReply(&msg) {
+			return nil, ErrBadRequest
+		}
+	} else if !validMessage(&msg) {
+		return nil, ErrBadRequest
+	}
+
+	return messageCreateRequest{msg}, nil
+}
+
+func encodeGRPCStoreMessageResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(*messageCreateResponse)
+	return &pb.StoreMessageReply{Id: resp.Id}, nil
+}
+
+func decodeGRPCGetMessageRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.GetMessageRequest)
+	return messageForIdQueryRequest{req.Id}, nil
+}
+
+func encodeGRPCGetMessageResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(*messageForIdQueryResponse)
+	return &pb.GetMessageReply{Message: pbMessageOf(resp.Content)}, nil
+}
+
+func decodeGRPCGetMessagesRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.GetMessagesRequest)
+	return messagesForUserQueryRequest{Username: req.Username}, nil
+}
+
+func encodeGRPCGetMessagesResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(*messagesForUserQueryResponse)
+	return &pb.GetMessagesReply{Messages: pbMessagesOf(resp.Content)}, nil
+}
+
+func decodeGRPCGetRepliesRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.GetRepliesRequest)
+	return replyQueryRequest{req.Id}, nil
+}
+
+func encodeGRPCGetRepliesResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(*replyQueryResponse)
+	return &pb.GetRepliesReply{Messages: pbMessagesOf(resp.Content)}, nil
+}
+
+// Get grpc status error for request execution error
+func grpcError(err error) error {
+	var code codes.Code
+	switch errorStatus(err) {
+	case http.StatusNotFound:
+		code = codes.NotFound
+	case http.StatusForbidden:
+		code = codes.PermissionDenied
+	case http.StatusInternalServerError:
+		code = codes.Internal
+	case http.StatusServiceUnavailable:
+		code = codes.Unavailable
+	default:
+		code = codes.InvalidArgument
+	}
+	return status.Error(code, err.Error())
+}
+
+// Map protobuf message to transport message structure
+func messageOf(m *pb.Message) Message {
+	if m == nil {
+		return Message{}
+	}
+	msg := Message{
+		Id:         m.Id,
+		Re:         m.Re,
+		Sender:     m.Sender,
+		SenderName: m.SenderName,
+		To:         receiversOf(m.To),
+		Cc:         receiversOf(m.Cc),
+		Bcc:        receiversOf(m.Bcc),
+		Subject:    m.Subject,
+		Body:       m.Body,
+		Timestamp:  m.SentAt,
+		Unread:     m.Unread,
+	}
+	if m.Recipient != nil {
+		msg.Recipient = Receiver{Groupname: m.Recipient.Groupname, Username: m.Recipient.Username}
+	}
+	return msg
+}
+
+func receiversOf(rs []*pb.Receiver) []Receiver {
+	var receivers []Receiver
+	for _, r := range rs {
+		receivers = append(receivers, Receiver{Groupname: r.Groupname, Username: r.Username})
+	}
+	return receivers
+}
+
+// Map transport message structure to protobuf message
+func pbMessageOf(msg Message) *pb.Message {
+	return &pb.Message{
+		Id:         msg.Id,
+		Re:         msg.Re,
+		Sender:     msg.Sender,
+		SenderName: msg.SenderName,
+		Recipient:  &pb.Receiver{Username: msg.Recipient.Username, Groupname: msg.Recipient.Groupname},
+		To:         pbReceiversOf(msg.To),
+		Cc:         pbReceiversOf(msg.Cc),
+		Bcc:        pbReceiversOf(msg.Bcc),
+		Subject:    msg.Subject,
+		Body:       msg.Body,
+		SentAt:     msg.Timestamp,
+		Unread:     msg.Unread,
+	}
+}
+
+func pbMessagesOf(msgs []Message) []*pb.Message {
+	pbmsgs := []*pb.Message{}
+	for _, msg := range msgs {
+		pbmsgs = append(pbmsgs, pbMessageOf(msg))
+	}
+	return pbmsgs
+}
+
+func pbReceiversOf(receivers []Receiver) []*pb.Receiver {
+	var rs []*pb.Receiver
+	for _, r := range receivers {
+		rs = append(rs, &pb.Receiver{Username: r.Username, Groupname: r.Groupname})
+	}
+	return rs
+}
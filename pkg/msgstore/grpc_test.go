@@ -0,0 +1,247 @@
+package msgstore
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/ghsbhatia/msgbox/pkg/middleware"
+	"github.com/ghsbhatia/msgbox/pkg/msgstore/pb"
+)
+
+// Test executor for grpc transport
+func TestGRPCTransport(t *testing.T) {
+	s := &grpcTestSuite{}
+	t.Run("StoreMessage", func(t *testing.T) { s.testStoreMessage(t) })
+	t.Run("StoreMessageInvalid", func(t *testing.T) { s.testStoreMessageInvalid(t) })
+	t.Run("StoreMessageSender", func(t *testing.T) { s.testStoreMessageSender(t) })
+	t.Run("GetMessage", func(t *testing.T) { s.testGetMessage(t) })
+	t.Run("GetMessageNotFound", func(t *testing.T) { s.testGetMessageNotFound(t) })
+	t.Run("GetMessages", func(t *testing.T) { s.testGetMessages(t) })
+	t.Run("GetMessagesForbidden", func(t *testing.T) { s.testGetMessagesForbidden(t) })
+	t.Run("GetReplies", func(t *testing.T) { s.testGetReplies(t) })
+}
+
+// Test suite for grpc transport
+type grpcTestSuite struct{}
+
+// Connect a client to grpc server of given service, created with given
+// options. The returned function closes the connection and the server.
+func (s *grpcTestSuite) dial(t *testing.T, service Service, opts ...grpc.ServerOption) (pb.MsgStoreClient, func()) {
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(opts...)
+	pb.RegisterMsgStoreServer(server, MakeGRPCServer(service, kitlog.NewNopLogger()))
+	go server.Serve(listener)
+
+	dialer := func(context.Context, string) (net.Conn, error) { return listener.Dial() }
+	conn, err := grpc.Dial("bufnet", grpc.WithContextDialer(dialer), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pb.NewMsgStoreClient(conn), func() {
+		conn.Close()
+		server.Stop()
+	}
+}
+
+// Test scenario - Store a message and a reply
+func (s *grpcTestSuite) testStoreMessage(t *testing.T) {
+
+	msg := Message{
+		Sender:  "tester",
+		To:      []Receiver{{Username: "user1"}},
+		Cc:      []Receiver{{Groupname: "news"}},
+		Subject: "test",
+		Body:    "test message",
+	}
+	reply := Message{Re: "id:01", Sender: "user1", Subject: "re:test", Body: "test reply"}
+
+	service := new(MockedService)
+	service.On("StoreMessage", msg).Return("id:01", nil)
+	service.On("StoreMessage", reply).Return("id:02", nil)
+
+	client, done := s.dial(t, service)
+	defer done()
+
+	resp, err := client.StoreMessage(context.TODO(), &pb.StoreMessageRequest{Message: &pb.Message{
+		Sender:  "tester",
+		To:      []*pb.Receiver{{Username: "user1"}},
+		Cc:      []*pb.Receiver{{Groupname: "news"}},
+		Subject: "test",
+		Body:    "test message",
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, "id:01", resp.Id)
+
+	resp, err = client.StoreMessage(context.TODO(), &pb.StoreMessageRequest{Message: &pb.Message{
+		Re:      "id:01",
+		Sender:  "user1",
+		Subject: "re:test",
+		Body:    "test reply",
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, "id:02", resp.Id)
+
+	service.AssertExpectations(t)
+}
+
+// Test scenario - Messages that are not valid are rejected
+func (s *grpcTestSuite) testStoreMessageInvalid(t *testing.T) {
+
+	service := new(MockedService)
+
+	client, done := s.dial(t, service)
+	defer done()
+
+	for _, msg := range []*pb.Message{
+		nil,
+		{Sender: "tester", Recipient: &pb.Receiver{Username: "user1"}, Subject: "test"},
+		{Re: "id:01", Sender: "tester", Recipient: &pb.Receiver{Username: "user1"}, Subject: "re:test", Body: "test reply"},
+	} {
+		_, err := client.StoreMessage(context.TODO(), &pb.StoreMessageRequest{Message: msg})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+
+	service.AssertExpectations(t)
+}
+
+// Test scenario - Authenticated message is sent by subject of its token
+func (s *grpcTestSuite) testStoreMessageSender(t *testing.T) {
+
+	msg := Message{Sender: "tester", Recipient: Receiver{Username: "user1"}, Subject: "test", Body: "test message"}
+
+	service := new(MockedService)
+	service.On("StoreMessage", msg).Return("id:01", nil)
+
+	authenticated := func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return handler(middleware.NewAuthContext(ctx, "tester", "token"), req)
+	}
+	client, done := s.dial(t, service, grpc.UnaryInterceptor(authenticated))
+	defer done()
+
+	_, err := client.StoreMessage(context.TODO(), &pb.StoreMessageRequest{Message: &pb.Message{
+		Sender:    "other",
+		Recipient: &pb.Receiver{Username: "user1"},
+		Subject:   "test",
+		Body:      "test message",
+	}})
+	assert.NoError(t, err)
+
+	service.AssertExpectations(t)
+}
+
+// Test scenario - Get a message for id
+func (s *grpcTestSuite) testGetMessage(t *testing.T) {
+
+	msg := Message{
+		Id:         "id:01",
+		Sender:     "user2",
+		SenderName: "User Two",
+		Recipient:  Receiver{Username: "user1"},
+		Bcc:        []Receiver{{Username: "user3"}},
+		Subject:    "test",
+		Body:       "test message",
+		Timestamp:  "2019-12-15T10:00:00Z",
+		Unread:     true,
+	}
+
+	service := new(MockedService)
+	service.On("GetMessage", "id:01").Return(msg, nil)
+
+	client, done := s.dial(t, service)
+	defer done()
+
+	resp, err := client.GetMessage(context.TODO(), &pb.GetMessageRequest{Id: "id:01"})
+	assert.NoError(t, err)
+	assert.Equal(t, msg, messageOf(resp.Message))
+
+	service.AssertExpectations(t)
+}
+
+// Test scenario - Message that does not exist is not found
+func (s *grpcTestSuite) testGetMessageNotFound(t *testing.T) {
+
+	service := new(MockedService)
+	service.On("GetMessage", "id:01").Return(Message{}, ErrMsgNotFound)
+
+	client, done := s.dial(t, service)
+	defer done()
+
+	_, err := client.GetMessage(context.TODO(), &pb.GetMessageRequest{Id: "id:01"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Equal(t, ErrMsgNotFound.Error(), status.Convert(err).Message())
+
+	service.AssertExpectations(t)
+}
+
+// Test scenario - Get messages in mailbox of user
+func (s *grpcTestSuite) testGetMessages(t *testing.T) {
+
+	msgs := []Message{
+		{Id: "id:01", Sender: "user2", Recipient: Receiver{Username: "user1"}, Subject: "a", Body: "a"},
+		{Id: "id:02", Sender: "user3", Recipient: Receiver{Groupname: "news"}, Subject: "b", Body: "b"},
+	}
+
+	service := new(MockedService)
+	service.On("GetMessages", "user1").Return(msgs, nil)
+	service.On("GetMessages", "user2").Return([]Message{}, nil)
+
+	client, done := s.dial(t, service)
+	defer done()
+
+	resp, err := client.GetMessages(context.TODO(), &pb.GetMessagesRequest{Username: "user1"})
+	assert.NoError(t, err)
+	assert.Len(t, resp.Messages, 2)
+	for i, m := range resp.Messages {
+		assert.Equal(t, msgs[i], messageOf(m))
+	}
+
+	resp, err = client.GetMessages(context.TODO(), &pb.GetMessagesRequest{Username: "user2"})
+	assert.NoError(t, err)
+	assert.Empty(t, resp.Messages)
+
+	service.AssertExpectations(t)
+}
+
+// Test scenario - Mailbox of another user is forbidden
+func (s *grpcTestSuite) testGetMessagesForbidden(t *testing.T) {
+
+	service := new(MockedService)
+	service.On("GetMessages", mock.Anything).Return(nil, ErrForbidden)
+
+	client, done := s.dial(t, service)
+	defer done()
+
+	_, err := client.GetMessages(context.TODO(), &pb.GetMessagesRequest{Username: "user1"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	service.AssertExpectations(t)
+}
+
+// Test scenario - Get replies to a message
+func (s *grpcTestSuite) testGetReplies(t *testing.T) {
+
+	replies := []Message{{Id: "id:02", Re: "id:01", Sender: "user2", Subject: "re:test", Body: "test reply"}}
+
+	service := new(MockedService)
+	service.On("GetReplies", "id:01").Return(replies, nil)
+
+	client, done := s.dial(t, service)
+	defer done()
+
+	resp, err := client.GetReplies(context.TODO(), &pb.GetRepliesRequest{Id: "id:01"})
+	assert.NoError(t, err)
+	assert.Len(t, resp.Messages, 1)
+	assert.Equal(t, replies[0], messageOf(resp.Messages[0]))
+
+	service.AssertExpectations(t)
+}
@@ -0,0 +1,134 @@
+package msgstore
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Types of mailbox events
+const (
+	// A new message has been sent to or by the user
+	eventMessage = "message"
+	// A reply has been sent to or by the user
+	eventReply = "reply"
+)
+
+// Default number of past events kept by hub for subscribers that reconnect
+const defaultEventHistory = 1000
+
+// Number of events that may be pending for a subscriber before it is dropped
+const subscriberBuffer = 64
+
+// Event about a message published to a user
+type Event struct {
+	Id      uint64
+	Type    string
+	Message Message
+}
+
+// event published to a user
+type userEvent struct {
+	user string
+	Event
+}
+
+// subscription of a user to events
+type subscriber struct {
+	user   string
+	events chan Event
+}
+
+// In-process hub that publishes mailbox events to subscribed users. The hub
+// keeps a history of recent events, so that a subscriber that reconnects gets
+// the events it missed. Event ids start from the time the hub is created, so
+// that they keep increasing across restarts.
+type EventHub struct {
+	mtx         sync.Mutex
+	seq         uint64
+	size        int
+	history     []userEvent                         // most recent events, oldest first
+	subscribers map[string]map[*subscriber]struct{} // subscribers keyed by user
+}
+
+// Get a new instance of event hub that keeps given number of past events.
+func NewEventHub(size int) *EventHub {
+	return &EventHub{
+		seq:         uint64(time.Now().UnixNano()),
+		size:        size,
+		subscribers: make(map[string]map[*subscriber]struct{}),
+	}
+}
+
+// Publish event of given type about given message to a user. Subscribers that
+// can not keep up are dropped and have to subscribe again.
+func (h *EventHub) publish(user string, eventType string, msg Message) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	h.seq++
+	ev := Event{h.seq, eventType, msg}
+
+	h.history = append(h.history, userEvent{user, ev})
+	if len(h.history) > h.size {
+		h.history = h.history[len(h.history)-h.size:]
+	}
+
+	for sub := range h.subscribers[user] {
+		select {
+		case sub.events <- ev:
+		default:
+			h.unsubscribe(sub)
+		}
+	}
+}
+
+// Subscribe to events of given user, starting with past events after given
+// event id, if any. The channel is closed when context is done or the
+// subscriber is dropped.
+func (h *EventHub) subscribe(ctx context.Context, user string, after uint64) <-chan Event {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	var missed []Event
+	if after > 0 {
+		for _, ev := range h.history {
+			if ev.user == user && ev.Id > after {
+				missed = append(missed, ev.Event)
+			}
+		}
+	}
+
+	sub := &subscriber{user, make(chan Event, len(missed)+subscriberBuffer)}
+	for _, ev := range missed {
+		sub.events <- ev
+	}
+
+	if h.subscribers[user] == nil {
+		h.subscribers[user] = make(map[*subscriber]struct{})
+	}
+	h.subscribers[user][sub] = struct{}{}
+
+	go func() {
+		<-ctx.Done()
+		h.mtx.Lock()
+		defer h.mtx.Unlock()
+		h.unsubscribe(sub)
+	}()
+
+	return sub.events
+}
+
+// Remove subscriber and close its channel, unless it has been removed
+// already. Caller must hold the lock.
+func (h *EventHub) unsubscribe(sub *subscriber) {
+	subs := h.subscribers[sub.user]
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(h.subscribers, sub.user)
+	}
+	close(sub.events)
+}
@@ -0,0 +1,122 @@
+package msgstore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test executor for event hub
+func TestEventHub(t *testing.T) {
+	s := &hubTestSuite{}
+	t.Run("Publish", func(t *testing.T) { s.testPublish(t) })
+	t.Run("Replay", func(t *testing.T) { s.testReplay(t) })
+	t.Run("History", func(t *testing.T) { s.testHistory(t) })
+	t.Run("DropSlowSubscriber", func(t *testing.T) { s.testDropSlowSubscriber(t) })
+	t.Run("Unsubscribe", func(t *testing.T) { s.testUnsubscribe(t) })
+}
+
+// Test suite for event hub
+type hubTestSuite struct{}
+
+// Get ids of events pending in given channel
+func pending(events <-chan Event) []uint64 {
+	var ids []uint64
+	for len(events) > 0 {
+		ids = append(ids, (<-events).Id)
+	}
+	return ids
+}
+
+// Test scenario - Events are published to subscribers of their user only
+func (s *hubTestSuite) testPublish(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	hub := NewEventHub(10)
+	alice1, alice2, bob := hub.subscribe(ctx, "alice", 0), hub.subscribe(ctx, "alice", 0), hub.subscribe(ctx, "bob", 0)
+
+	hub.publish("alice", eventMessage, Message{Id: "id:01"})
+
+	for _, events := range []<-chan Event{alice1, alice2} {
+		ev := <-events
+		assert.Equal(t, eventMessage, ev.Type)
+		assert.Equal(t, "id:01", ev.Message.Id)
+	}
+	assert.Len(t, bob, 0)
+}
+
+// Test scenario - Subscriber gets events published after given event id first
+func (s *hubTestSuite) testReplay(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	hub := NewEventHub(10)
+	hub.publish("alice", eventMessage, Message{Id: "id:01"})
+	hub.publish("bob", eventMessage, Message{Id: "id:02"})
+	hub.publish("alice", eventReply, Message{Id: "id:03"})
+	hub.publish("alice", eventReply, Message{Id: "id:04"})
+
+	all := pending(hub.subscribe(ctx, "alice", 1))
+	assert.Len(t, all, 3)
+
+	events := hub.subscribe(ctx, "alice", all[0])
+	assert.Equal(t, all[1:], pending(events))
+
+	hub.publish("alice", eventMessage, Message{Id: "id:05"})
+	assert.Equal(t, "id:05", (<-events).Message.Id)
+
+	assert.Len(t, hub.subscribe(ctx, "alice", 0), 0)
+}
+
+// Test scenario - Hub keeps given number of past events
+func (s *hubTestSuite) testHistory(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	hub := NewEventHub(2)
+	for i := 0; i < 5; i++ {
+		hub.publish("alice", eventMessage, Message{})
+	}
+
+	assert.Len(t, pending(hub.subscribe(ctx, "alice", 1)), 2)
+}
+
+// Test scenario - Subscriber that does not keep up is dropped
+func (s *hubTestSuite) testDropSlowSubscriber(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	hub := NewEventHub(10)
+	events := hub.subscribe(ctx, "alice", 0)
+	for i := 0; i <= subscriberBuffer; i++ {
+		hub.publish("alice", eventMessage, Message{})
+	}
+
+	assert.Len(t, pending(events), subscriberBuffer)
+	_, ok := <-events
+	assert.False(t, ok)
+}
+
+// Test scenario - Subscription ends when its context is done
+func (s *hubTestSuite) testUnsubscribe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+
+	hub := NewEventHub(10)
+	events := hub.subscribe(ctx, "alice", 0)
+	cancel()
+
+	select {
+	case _, ok := <-events:
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("subscription not closed")
+	}
+
+	hub.publish("alice", eventMessage, Message{})
+	hub.mtx.Lock()
+	defer hub.mtx.Unlock()
+	assert.Empty(t, hub.subscribers)
+}
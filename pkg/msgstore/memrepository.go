@@ -0,0 +1,495 @@
+package msgstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ghsbhatia/msgbox/pkg/ctxlog"
+	"github.com/go-kit/kit/log"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Error reported by in-memory repository when a message does not exist. The
+// error text matches the one reported by mongo driver so that service maps it
+// to the same service error.
+var errNoDocuments = errors.New("msgstore: " + no_docs_in_result)
+
+// Get a new instance of in-memory message repository. Messages are lost when
+// the process terminates.
+func NewInMemoryMessageRepository() MessageRepository {
+	return &inMemoryMessageRepository{
+		messages: make(map[string]*Record),
+		replies:  make(map[string][]string),
+		index:    make(map[string]map[string]int),
+	}
+}
+
+// in-memory message repository implementation
+type inMemoryMessageRepository struct {
+	mtx      sync.RWMutex
+	messages map[string]*Record        // messages keyed by message id
+	ordered  []string                  // message ids in the order of storage
+	replies  map[string][]string       // reply ids keyed by original message id
+	index    map[string]map[string]int // occurrences of terms in subject and body keyed by term and message id
+}
+
+func (r *inMemoryMessageRepository) StoreMessage(ctx context.Context, message *Record) (msgid string, err error) {
+
+	defer func(begin time.Time) {
+		logger := log.With(ctxlog.Logger(ctx), "component", "repository")
+		logger.Log(
+			"method", "store message",
+			"subject", message.Subject,
+			"id", msgid,
+			"re", message.ReplyToMsgId,
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	// If this message is a reply, original message must exist
+
+	if len(message.ReplyToMsgId) > 0 {
+		if _, ok := r.messages[message.ReplyToMsgId]; !ok {
+			err = fmt.Errorf("error finding orginal msg with id %s: %v", message.ReplyToMsgId, errNoDocuments)
+			return "", err
+		}
+	}
+
+	message.Timestamp = time.Now()
+
+	msgid = primitive.NewObjectID().Hex()
+
+	record := copyRecord(*message)
+	record.Id = msgid
+
+	r.messages[msgid] = &record
+	r.ordered = append(r.ordered, msgid)
+
+	for _, term := range tokenize(record.Subject + " " + record.Body) {
+		if r.index[term] == nil {
+			r.index[term] = make(map[string]int)
+		}
+		r.index[term][msgid]++
+	}
+
+	if len(message.ReplyToMsgId) > 0 {
+		r.replies[message.ReplyToMsgId] = append(r.replies[message.ReplyToMsgId], msgid)
+	}
+
+	return msgid, nil
+}
+
+func (r *inMemoryMessageRepository) GetUserMessages(ctx context.Context, user string) (results []Record, err error) {
+
+	defer func(begin time.Time) {
+		logger := log.With(ctxlog.Logger(ctx), "component", "repository")
+		logger.Log(
+			"method", "get user messages",
+			"user", user,
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	for _, msgid := range r.ordered {
+		record := r.messages[msgid]
+		if inMailbox(record, user, MailboxQuery{}) {
+			results = append(results, copyRecord(*record))
+		}
+	}
+
+	return results, nil
+}
+
+func (r *inMemoryMessageRepository) GetUserMessagesPage(ctx context.Context, user string, query MailboxQuery) (results []Record, next string, err error) {
+
+	defer func(begin time.Time) {
+		logger := log.With(ctxlog.Logger(ctx), "component", "repository")
+		logger.Log(
+			"method", "get user messages page",
+			"user", user,
+			"limit", query.Limit,
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+
+	results, next, err = r.findPage(func(record *Record) bool {
+		return inMailbox(record, user, query)
+	}, query)
+	return results, next, err
+}
+
+func (r *inMemoryMessageRepository) GetSentMessagesPage(ctx context.Context, user string, query MailboxQuery) (results []Record, next string, err error) {
+
+	defer func(begin time.Time) {
+		logger := log.With(ctxlog.Logger(ctx), "component", "repository")
+		logger.Log(
+			"method", "get sent messages page",
+			"user", user,
+			"limit", query.Limit,
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+
+	results, next, err = r.findPage(func(record *Record) bool {
+		return record.Sender == user
+	}, query)
+	return results, next, err
+}
+
+// Find a page of messages selected by given function, most recent first,
+// starting after the cursor of given query.
+func (r *inMemoryMessageRepository) findPage(selected func(*Record) bool, query MailboxQuery) ([]Record, string, error) {
+	var (
+		timestamp time.Time
+		id        string
+		err       error
+	)
+	if len(query.Cursor) > 0 {
+		timestamp, id, err = decodeCursor(query.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	// messages are stored in timestamp order, so walk them backwards
+	var results []Record
+	for i := len(r.ordered) - 1; i >= 0; i-- {
+		record := r.messages[r.ordered[i]]
+		if !selected(record) {
+			continue
+		}
+		if len(query.Cursor) > 0 && !afterCursor(*record, timestamp, id) {
+			continue
+		}
+		results = append(results, copyRecord(*record))
+		if query.Limit > 0 && len(results) > query.Limit {
+			break
+		}
+	}
+
+	results, next := pageOf(results, query.Limit)
+	return results, next, nil
+}
+
+func (r *inMemoryMessageRepository) SearchUserMessages(ctx context.Context, user string, query SearchQuery) (results []SearchResult, err error) {
+
+	defer func(begin time.Time) {
+		logger := log.With(ctxlog.Logger(ctx), "component", "repository")
+		logger.Log(
+			"method", "search user messages",
+			"user", user,
+			"limit", query.Limit,
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	// score messages by the number of occurrences of search terms
+	scores := make(map[string]float64)
+	for _, term := range searchTerms(query.Text) {
+		for msgid, count := range r.index[term] {
+			scores[msgid] += float64(count)
+		}
+	}
+
+	for msgid, score := range scores {
+		record := r.messages[msgid]
+		if !(contains(record.Recipients, user) || record.Sender == user) || contains(record.DeletedBy, user) {
+			continue
+		}
+		results = append(results, SearchResult{copyRecord(*record), score})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		if !results[i].Timestamp.Equal(results[j].Timestamp) {
+			return results[i].Timestamp.After(results[j].Timestamp)
+		}
+		return results[i].Id > results[j].Id
+	})
+
+	if query.Limit > 0 && len(results) > query.Limit {
+		results = results[:query.Limit]
+	}
+
+	return results, nil
+}
+
+func (r *inMemoryMessageRepository) GetMessage(ctx context.Context, msgid string) (result Record, err error) {
+
+	defer func(begin time.Time) {
+		logger := log.With(ctxlog.Logger(ctx), "component", "repository")
+		logger.Log(
+			"method", "get message",
+			"id", msgid,
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	record, ok := r.messages[msgid]
+	if !ok {
+		err = errNoDocuments
+		return Record{}, err
+	}
+
+	return copyRecord(*record), nil
+}
+
+func (r *inMemoryMessageRepository) SetRecipientFlag(ctx context.Context, msgid string, user string, flag RecipientFlag, set bool) (err error) {
+
+	defer func(begin time.Time) {
+		logger := log.With(ctxlog.Logger(ctx), "component", "repository")
+		logger.Log(
+			"method", "set recipient flag",
+			"id", msgid,
+			"user", user,
+			"flag", flag,
+			"set", set,
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	// Only recipients of the message have their own state
+
+	record, ok := r.messages[msgid]
+	if !ok || !contains(record.Recipients, user) || contains(record.DeletedBy, user) {
+		err = errNoDocuments
+		return err
+	}
+
+	users := recipientFlagUsers(record, flag)
+	if users == nil {
+		err = fmt.Errorf("unknown recipient flag %s", flag)
+		return err
+	}
+
+	if set {
+		*users = appendunique(*users, user)
+	} else {
+		*users = remove(*users, user)
+	}
+
+	return nil
+}
+
+func (r *inMemoryMessageRepository) CountUnreadMessages(ctx context.Context, user string) (count int64, err error) {
+
+	defer func(begin time.Time) {
+		logger := log.With(ctxlog.Logger(ctx), "component", "repository")
+		logger.Log(
+			"method", "count unread messages",
+			"user", user,
+			"count", count,
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	for _, record := range r.messages {
+		if inMailbox(record, user, MailboxQuery{Unread: true}) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (r *inMemoryMessageRepository) GetReplyMessages(ctx context.Context, msgid string) (results []Record, err error) {
+
+	defer func(begin time.Time) {
+		logger := log.With(ctxlog.Logger(ctx), "component", "repository")
+		logger.Log(
+			"method", "get reply messages",
+			"msgid", msgid,
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	for _, replyid := range r.replies[msgid] {
+		results = append(results, copyRecord(*r.messages[replyid]))
+	}
+
+	return results, nil
+}
+
+func (r *inMemoryMessageRepository) GetThreadMessages(ctx context.Context, msgid string) (results []Record, err error) {
+
+	defer func(begin time.Time) {
+		logger := log.With(ctxlog.Logger(ctx), "component", "repository")
+		logger.Log(
+			"method", "get thread messages",
+			"msgid", msgid,
+			"count", len(results),
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	parents := []string{msgid}
+	for len(parents) > 0 {
+		var children []string
+		for _, parent := range parents {
+			for _, replyid := range r.replies[parent] {
+				results = append(results, copyRecord(*r.messages[replyid]))
+				children = append(children, replyid)
+			}
+		}
+		parents = children
+	}
+
+	return results, nil
+}
+
+func (r *inMemoryMessageRepository) Purge(ctx context.Context) (err error) {
+
+	defer func(begin time.Time) {
+		logger := log.With(ctxlog.Logger(ctx), "component", "repository")
+		logger.Log(
+			"method", "purge",
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.messages = make(map[string]*Record)
+	r.ordered = nil
+	r.replies = make(map[string][]string)
+	r.index = make(map[string]map[string]int)
+
+	return nil
+}
+
+// Copy a record so that callers do not share slices with the repository.
+func copyRecord(record Record) Record {
+	record.Recipients = append([]string(nil), record.Recipients...)
+	record.To = append([]Addressee(nil), record.To...)
+	record.Cc = append([]Addressee(nil), record.Cc...)
+	record.Bcc = append([]Addressee(nil), record.Bcc...)
+	record.ReadBy = append([]string(nil), record.ReadBy...)
+	record.ArchivedBy = append([]string(nil), record.ArchivedBy...)
+	record.DeletedBy = append([]string(nil), record.DeletedBy...)
+	return record
+}
+
+// Check if record is selected by query of mailbox of given user.
+func inMailbox(record *Record, user string, query MailboxQuery) bool {
+	if !contains(record.Recipients, user) || contains(record.DeletedBy, user) {
+		return false
+	}
+	if contains(record.ArchivedBy, user) != query.Archived {
+		return false
+	}
+	if query.Unread && contains(record.ReadBy, user) {
+		return false
+	}
+	if len(query.From) > 0 && record.Sender != query.From {
+		return false
+	}
+	if len(query.Group) > 0 && !sentToGroup(record, query.Group) {
+		return false
+	}
+	if !query.Since.IsZero() && record.Timestamp.Before(query.Since) {
+		return false
+	}
+	if !query.Until.IsZero() && !record.Timestamp.Before(query.Until) {
+		return false
+	}
+	if query.RepliesOnly && len(record.ReplyToMsgId) == 0 {
+		return false
+	}
+	if query.RootsOnly && len(record.ReplyToMsgId) > 0 {
+		return false
+	}
+	return true
+}
+
+// Check if message is sent to given group, other than as a bcc addressee.
+func sentToGroup(record *Record, group string) bool {
+	if record.GroupId == group {
+		return true
+	}
+	for _, addressee := range append(append([]Addressee{}, record.To...), record.Cc...) {
+		if addressee.Groupname == group {
+			return true
+		}
+	}
+	return false
+}
+
+// Get the record field holding recipients for whom given flag is set.
+func recipientFlagUsers(record *Record, flag RecipientFlag) *[]string {
+	switch flag {
+	case FlagRead:
+		return &record.ReadBy
+	case FlagArchived:
+		return &record.ArchivedBy
+	case FlagDeleted:
+		return &record.DeletedBy
+	}
+	return nil
+}
+
+// Remove all occurrences of an element from collection.
+func remove(collection []string, element string) []string {
+	result := collection[:0]
+	for _, item := range collection {
+		if item != element {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// Check if collection contains the given element.
+func contains(collection []string, element string) bool {
+	for _, item := range collection {
+		if item == element {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package msgstore
+
+import (
+	"context"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+// Test executor for in-memory message repository
+func TestInMemoryMessageRepository(t *testing.T) {
+	r := NewInMemoryMessageRepository()
+	s := &repositoryTestSuite{context.TODO()}
+	t.Run("StoreMessage", func(t *testing.T) { s.testStoreMessage(t, r) })
+	t.Run("StoreReply", func(t *testing.T) { s.testStoreReply(t, r) })
+	t.Run("GetMessage", func(t *testing.T) { s.testGetMessage(t, r) })
+	t.Run("GetUserMessages", func(t *testing.T) { s.testGetUserMessages(t, r) })
+	t.Run("GetUserMessagesPage", func(t *testing.T) { s.testGetUserMessagesPage(t, r) })
+	t.Run("GetFilteredUserMessages", func(t *testing.T) { s.testGetFilteredUserMessages(t, r) })
+	t.Run("GetSentMessagesPage", func(t *testing.T) { s.testGetSentMessagesPage(t, r) })
+	t.Run("SearchUserMessages", func(t *testing.T) { s.testSearchUserMessages(t, r) })
+	t.Run("ReadState", func(t *testing.T) { s.testReadState(t, r) })
+	t.Run("DeleteAndArchive", func(t *testing.T) { s.testDeleteAndArchive(t, r) })
+	t.Run("GetThreadMessages", func(t *testing.T) { s.testGetThreadMessages(t, r) })
+	t.Run("StoreConcurrentReplies", func(t *testing.T) { s.testStoreConcurrentReplies(t, r) })
+	t.Run("GetUnknownMessage", func(t *testing.T) { s.testGetUnknownMessage(t, r) })
+	t.Run("StoreReplyUnknownMessage", func(t *testing.T) { s.testStoreReplyUnknownMessage(t, r) })
+}
+
+// Test scenario - get a message that was never stored
+func (s *repositoryTestSuite) testGetUnknownMessage(t *testing.T, r MessageRepository) {
+
+	r.Purge(s.ctx)
+
+	is := is.New(t)
+
+	_, err := r.GetMessage(s.ctx, "5d6ec1b8e1a5e6a2c4f1b2c3")
+
+	is.True(err != nil)
+	is.Equal(ErrMsgNotFound, (&service{}).mapError(err))
+}
+
+// Test scenario - store reply to a message that was never stored
+func (s *repositoryTestSuite) testStoreReplyUnknownMessage(t *testing.T, r MessageRepository) {
+
+	r.Purge(s.ctx)
+
+	is := is.New(t)
+
+	msg := &Record{ReplyToMsgId: "5d6ec1b8e1a5e6a2c4f1b2c3", Sender: "bob", Recipients: []string{"alice"}, Subject: "re:test", Body: "reply"}
+	_, err := r.StoreMessage(s.ctx, msg)
+
+	is.True(err != nil)
+	is.Equal(ErrMsgNotFound, (&service{}).mapError(err))
+}
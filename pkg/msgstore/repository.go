@@ -17,26 +17,97 @@ import (
 
 // Record represents message stored in the repository.
 type Record struct {
-	Id           string    `json:"id,omitempty" bson:"_id,omitempty"`
-	ReplyToMsgId string    // Optional: Id of message to which this message is a reply
-	Sender       string    // Sender userid
-	GroupId      string    // Optional: Id of group if this message recipient is a group
-	Recipients   []string  // Recipient userids
-	Subject      string    // Subject
-	Body         string    // Message Content
-	Timestamp    time.Time // Auto Generated: System time when this message is stored
+	Id           string      `json:"id,omitempty" bson:"_id,omitempty"`
+	ReplyToMsgId string      // Optional: Id of message to which this message is a reply
+	Sender       string      // Sender userid
+	SenderName   string      // Optional: Display name of sender when message is stored
+	GroupId      string      // Optional: Id of group if this message recipient is a group
+	Recipients   []string    // Recipient userids
+	To           []Addressee `bson:",omitempty"` // Optional: Addressees of message sent to several users and groups
+	Cc           []Addressee `bson:",omitempty"` // Optional: Addressees that receive a copy
+	Bcc          []Addressee `bson:",omitempty"` // Optional: Addressees that receive a copy hidden from other recipients
+	Subject      string      // Subject
+	Body         string      // Message Content
+	Timestamp    time.Time   // Auto Generated: System time when this message is stored
+	ReadBy       []string    // Recipient userids who have read this message
+	ArchivedBy   []string    // Recipient userids who have archived this message
+	DeletedBy    []string    // Recipient userids who have deleted this message
+}
+
+// Addressee of a message as given by its sender, either a user or a group.
+type Addressee struct {
+	Username  string `bson:",omitempty"`
+	Groupname string `bson:",omitempty"`
+}
+
+// RecipientFlag identifies state of a message that is kept per recipient. The
+// value is the name of record field holding recipients for whom flag is set.
+type RecipientFlag string
+
+const (
+	// Message has been read by recipient
+	FlagRead RecipientFlag = "readby"
+	// Message has been moved out of mailbox into archive by recipient
+	FlagArchived RecipientFlag = "archivedby"
+	// Message has been deleted from mailbox by recipient
+	FlagDeleted RecipientFlag = "deletedby"
+)
+
+// MailboxQuery selects a page of messages from a mailbox.
+type MailboxQuery struct {
+	Limit       int       // Maximum number of messages in the page, all messages if not positive
+	Cursor      string    // Optional: Opaque cursor of the page returned by previous query
+	Unread      bool      // Optional: Select only messages not read by mailbox owner
+	Archived    bool      // Optional: Select archived messages instead of messages in mailbox
+	From        string    // Optional: Select only messages sent by this user
+	Group       string    // Optional: Select only messages sent to this group, openly addressed
+	Since       time.Time // Optional: Select only messages stored at or after this time
+	Until       time.Time // Optional: Select only messages stored before this time
+	RepliesOnly bool      // Optional: Select only replies to other messages
+	RootsOnly   bool      // Optional: Select only messages that are not replies
+}
+
+// SearchQuery selects messages in a mailbox matching a text.
+type SearchQuery struct {
+	Text  string // Words to search in subject and body, any of which must match
+	Limit int    // Maximum number of messages, all matching messages if not positive
+}
+
+// SearchResult is a message matching a search along with its relevance.
+type SearchResult struct {
+	Record `bson:",inline"`
+	Score  float64 // Relevance of message to the search, higher is more relevant
 }
 
 // Repository for message persistence
 type MessageRepository interface {
 	// Store Message: args: message, return: message id
 	StoreMessage(context.Context, *Record) (string, error)
-	// Get Messages: args: user id, return: messages
+	// Get Messages, excluding archived and deleted ones: args: user id, return: messages
 	GetUserMessages(context.Context, string) ([]Record, error)
+	// Get Messages ordered by timestamp descending: args: user id, query,
+	// return: messages, cursor of next page or empty if there are no more messages
+	GetUserMessagesPage(context.Context, string, MailboxQuery) ([]Record, string, error)
+	// Get Messages sent by a user ordered by timestamp descending: args: user
+	// id, query of which only limit and cursor apply, return: messages, cursor
+	// of next page or empty if there are no more messages
+	GetSentMessagesPage(context.Context, string, MailboxQuery) ([]Record, string, error)
+	// Search Messages received or sent by user, including archived and
+	// excluding deleted ones, ordered by relevance descending: args: user id,
+	// query, return: messages
+	SearchUserMessages(context.Context, string, SearchQuery) ([]SearchResult, error)
 	// Get Message: args: message id, return: message
 	GetMessage(context.Context, string) (Record, error)
+	// Set or clear a recipient flag: args: message id, recipient user id, flag,
+	// true to set or false to clear. Flags of deleted messages can not change.
+	SetRecipientFlag(context.Context, string, string, RecipientFlag, bool) error
+	// Count Unread Messages, excluding archived and deleted ones: args: user
+	// id, return: number of messages
+	CountUnreadMessages(context.Context, string) (int64, error)
 	// Get Message Replies: args: message id, return: messages
 	GetReplyMessages(context.Context, string) ([]Record, error)
+	// Get Thread Messages: args: message id, return: direct and indirect replies
+	GetThreadMessages(context.Context, string) ([]Record, error)
 	// Delete all Content
 	Purge(context.Context) error
 }
@@ -47,14 +118,22 @@ func NewMessageRepository(dburl string, db string) (MessageRepository, error) {
 	if err != nil {
 		return nil, err
 	}
+	err = createIndexes(connection.(*mongo.Client).Database(db))
+	if err != nil {
+		return nil, err
+	}
+	err = migrateReplies(context.TODO(), connection.(*mongo.Client).Database(db))
+	if err != nil {
+		return nil, err
+	}
 	return &messageRepository{connection: connection, database: db}, nil
 }
 
 const (
 	// collection to store messages
 	MSGCOLLECTION = "messages"
-	// collection to store message relationships so that replies can be correlated
-	// to original message
+	// collection that used to store message relationships, before replies
+	// were correlated by ReplyToMsgId. It is migrated and dropped on startup.
 	REPCOLLECTION = "replies"
 )
 
@@ -64,12 +143,6 @@ type messageRepository struct {
 	database   string
 }
 
-// relationship between original message and reply messages
-type relationship struct {
-	MessageId primitive.ObjectID
-	ReplyIds  []primitive.ObjectID
-}
-
 func (r *messageRepository) StoreMessage(ctx context.Context, message *Record) (msgid string, err error) {
 
 	defer func(begin time.Time) {
@@ -104,20 +177,10 @@ func (r *messageRepository) StoreMessage(ctx context.Context, message *Record) (
 		return "", err
 	}
 
-	msgid = fmt.Sprintf("%s", result.InsertedID.(primitive.ObjectID).Hex())
-
-	// If this message is a reply, create relationship to original message
+	// Replies are correlated to original message by ReplyToMsgId of the reply
+	// itself, so storing the reply is a single atomic insert.
 
-	if len(message.ReplyToMsgId) > 0 {
-		originalMsgId, _ := primitive.ObjectIDFromHex(message.ReplyToMsgId)
-		replyIds, _ := r.getReplyRelationship(ctx, originalMsgId)
-		if len(replyIds) == 0 {
-			r.storeReplyRelationship(ctx, originalMsgId, result.InsertedID.(primitive.ObjectID))
-		} else {
-			replyIds = append(replyIds, result.InsertedID.(primitive.ObjectID))
-			r.updateReplyRelationship(ctx, originalMsgId, replyIds)
-		}
-	}
+	msgid = fmt.Sprintf("%s", result.InsertedID.(primitive.ObjectID).Hex())
 
 	return msgid, nil
 }
@@ -138,7 +201,7 @@ func (r *messageRepository) GetUserMessages(ctx context.Context, user string) (r
 	client := r.connection.(*mongo.Client)
 	collection := client.Database(r.database).Collection(MSGCOLLECTION)
 
-	filter := bson.D{{"recipients", user}}
+	filter := mailboxFilter(user, MailboxQuery{})
 	cursor, dberr := collection.Find(ctx, filter, options.Find())
 	if dberr != nil {
 		err = dberr
@@ -159,42 +222,103 @@ func (r *messageRepository) GetUserMessages(ctx context.Context, user string) (r
 
 }
 
-func (r *messageRepository) GetMessage(ctx context.Context, msgid string) (result Record, err error) {
+func (r *messageRepository) GetUserMessagesPage(ctx context.Context, user string, query MailboxQuery) (results []Record, next string, err error) {
+
+	logger := log.With(ctxlog.Logger(ctx), "component", "repository")
 
 	defer func(begin time.Time) {
-		logger := log.With(ctxlog.Logger(ctx), "component", "repository")
 		logger.Log(
-			"method", "get message",
-			"id", msgid,
+			"method", "get user messages page",
+			"user", user,
+			"limit", query.Limit,
 			"took", time.Since(begin),
 			"err", err,
 		)
 	}(time.Now())
 
+	results, next, err = r.findPage(ctx, mailboxFilter(user, query), query)
+	return results, next, err
+}
+
+func (r *messageRepository) GetSentMessagesPage(ctx context.Context, user string, query MailboxQuery) (results []Record, next string, err error) {
+
+	logger := log.With(ctxlog.Logger(ctx), "component", "repository")
+
+	defer func(begin time.Time) {
+		logger.Log(
+			"method", "get sent messages page",
+			"user", user,
+			"limit", query.Limit,
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+
+	results, next, err = r.findPage(ctx, bson.D{{"sender", user}}, query)
+	return results, next, err
+}
+
+// Find a page of messages selected by given filter, most recent first,
+// starting after the cursor of given query.
+func (r *messageRepository) findPage(ctx context.Context, filter bson.D, query MailboxQuery) ([]Record, string, error) {
+
+	logger := log.With(ctxlog.Logger(ctx), "component", "repository")
+
 	client := r.connection.(*mongo.Client)
 	collection := client.Database(r.database).Collection(MSGCOLLECTION)
 
-	result = Record{}
+	if len(query.Cursor) > 0 {
+		timestamp, id, err := decodeCursor(query.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		docId, oiderr := primitive.ObjectIDFromHex(id)
+		if oiderr != nil {
+			return nil, "", errInvalidCursor
+		}
+		// the selecting filter may have conditions on the same fields
+		filter = bson.D{{"$and", bson.A{filter, bson.D{{"$or", bson.A{
+			bson.D{{"timestamp", bson.D{{"$lt", timestamp}}}},
+			bson.D{{"timestamp", timestamp}, {"_id", bson.D{{"$lt", docId}}}},
+		}}}}}}
+	}
 
-	docId, oiderr := primitive.ObjectIDFromHex(msgid)
-	if oiderr == nil {
-		err = collection.FindOne(ctx, bson.M{"_id": docId}).Decode(&result)
-		result.Id = msgid
-	} else {
-		err = oiderr
+	findOptions := options.Find().SetSort(bson.D{{"timestamp", -1}, {"_id", -1}})
+	if query.Limit > 0 {
+		// fetch one more message to find out if there is a next page
+		findOptions.SetLimit(int64(query.Limit + 1))
 	}
 
-	return result, err
+	cursor, err := collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, "", err
+	}
+	defer cursor.Close(ctx)
+
+	var results []Record
+	for cursor.Next(ctx) {
+		var msg Record
+		dberr := cursor.Decode(&msg)
+		if dberr != nil {
+			logger.Log("method", "find page", "cursor error", dberr)
+		} else {
+			results = append(results, msg)
+		}
+	}
+
+	results, next := pageOf(results, query.Limit)
+	return results, next, nil
 }
 
-func (r *messageRepository) GetReplyMessages(ctx context.Context, msgid string) (results []Record, err error) {
+func (r *messageRepository) SearchUserMessages(ctx context.Context, user string, query SearchQuery) (results []SearchResult, err error) {
 
 	logger := log.With(ctxlog.Logger(ctx), "component", "repository")
 
 	defer func(begin time.Time) {
 		logger.Log(
-			"method", "get reply messages",
-			"msgid", msgid,
+			"method", "search user messages",
+			"user", user,
+			"limit", query.Limit,
 			"took", time.Since(begin),
 			"err", err,
 		)
@@ -203,149 +327,356 @@ func (r *messageRepository) GetReplyMessages(ctx context.Context, msgid string)
 	client := r.connection.(*mongo.Client)
 	collection := client.Database(r.database).Collection(MSGCOLLECTION)
 
-	originalMsgId, oiderr := primitive.ObjectIDFromHex(msgid)
-	if oiderr != nil {
-		err = oiderr
+	filter := bson.D{
+		{"$text", bson.D{{"$search", query.Text}}},
+		{"$or", bson.A{bson.D{{"recipients", user}}, bson.D{{"sender", user}}}},
+		{string(FlagDeleted), bson.D{{"$ne", user}}},
+	}
+
+	score := bson.D{{"$meta", "textScore"}}
+	findOptions := options.Find().
+		SetProjection(bson.D{{"score", score}}).
+		SetSort(bson.D{{"score", score}, {"timestamp", -1}, {"_id", -1}})
+	if query.Limit > 0 {
+		findOptions.SetLimit(int64(query.Limit))
+	}
+
+	cursor, err := collection.Find(ctx, filter, findOptions)
+	if err != nil {
 		return nil, err
 	}
+	defer cursor.Close(ctx)
 
-	replyIds, _ := r.getReplyRelationship(ctx, originalMsgId)
-	if len(replyIds) > 0 {
-		filter := bson.D{{"_id", bson.D{{"$in", replyIds}}}}
-		cursor, dberr := collection.Find(context.TODO(), filter, options.Find())
+	for cursor.Next(ctx) {
+		var result SearchResult
+		dberr := cursor.Decode(&result)
 		if dberr != nil {
-			err = dberr
-			return nil, err
-		}
-		for cursor.Next(context.TODO()) {
-			var msg Record
-			dberr := cursor.Decode(&msg)
-			if dberr != nil {
-				logger.Log("method", "get reply messages", "msgid", msgid, "cursor error", dberr)
-			} else {
-				results = append(results, msg)
-			}
+			logger.Log("method", "search user messages", "cursor error", dberr)
+		} else {
+			results = append(results, result)
 		}
-
 	}
 
 	return results, nil
 }
 
-func (r *messageRepository) Purge(ctx context.Context) (err error) {
-
-	logger := log.With(ctxlog.Logger(ctx), "component", "repository")
+func (r *messageRepository) GetMessage(ctx context.Context, msgid string) (result Record, err error) {
 
 	defer func(begin time.Time) {
+		logger := log.With(ctxlog.Logger(ctx), "component", "repository")
 		logger.Log(
-			"method", "purge",
+			"method", "get message",
+			"id", msgid,
 			"took", time.Since(begin),
 			"err", err,
 		)
 	}(time.Now())
 
 	client := r.connection.(*mongo.Client)
-	collection := client.Database(r.database).Collection(REPCOLLECTION)
+	collection := client.Database(r.database).Collection(MSGCOLLECTION)
 
-	deleteResult, dberr := collection.DeleteMany(ctx, bson.D{{}})
-	if dberr == nil {
-		msg := fmt.Sprintf("Deleted %v documents in the %s collection\n", deleteResult.DeletedCount, REPCOLLECTION)
-		logger.Log("method", "purge", "info", msg)
+	result = Record{}
+
+	docId, oiderr := primitive.ObjectIDFromHex(msgid)
+	if oiderr == nil {
+		err = collection.FindOne(ctx, bson.M{"_id": docId}).Decode(&result)
+		result.Id = msgid
 	} else {
-		err = dberr
+		err = oiderr
 	}
 
-	collection = client.Database(r.database).Collection(MSGCOLLECTION)
-	deleteResult, dberr = collection.DeleteMany(context.TODO(), bson.D{{}})
-	if dberr == nil {
-		msg := fmt.Sprintf("Deleted %v documents in the %s collection\n", deleteResult.DeletedCount, MSGCOLLECTION)
-		logger.Log("method", "purge", "info", msg)
-	} else {
+	return result, err
+}
+
+func (r *messageRepository) SetRecipientFlag(ctx context.Context, msgid string, user string, flag RecipientFlag, set bool) (err error) {
+
+	defer func(begin time.Time) {
+		logger := log.With(ctxlog.Logger(ctx), "component", "repository")
+		logger.Log(
+			"method", "set recipient flag",
+			"id", msgid,
+			"user", user,
+			"flag", flag,
+			"set", set,
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+
+	client := r.connection.(*mongo.Client)
+	collection := client.Database(r.database).Collection(MSGCOLLECTION)
+
+	docId, oiderr := primitive.ObjectIDFromHex(msgid)
+	if oiderr != nil {
+		err = mongo.ErrNoDocuments
+		return err
+	}
+
+	operator := "$addToSet"
+	if !set {
+		operator = "$pull"
+	}
+
+	// Only recipients of the message have their own state
+
+	filter := bson.D{{"_id", docId}, {"recipients", user}, {string(FlagDeleted), bson.D{{"$ne", user}}}}
+	update := bson.D{{operator, bson.D{{string(flag), user}}}}
+	result, dberr := collection.UpdateOne(ctx, filter, update)
+	if dberr != nil {
 		err = dberr
+		return err
+	}
+	if result.MatchedCount == 0 {
+		err = mongo.ErrNoDocuments
 	}
 
 	return err
 }
 
-func (r *messageRepository) getReplyRelationship(ctx context.Context, msgid primitive.ObjectID) (results []primitive.ObjectID, err error) {
+func (r *messageRepository) CountUnreadMessages(ctx context.Context, user string) (count int64, err error) {
 
 	defer func(begin time.Time) {
 		logger := log.With(ctxlog.Logger(ctx), "component", "repository")
 		logger.Log(
-			"method", "get reply relationship",
+			"method", "count unread messages",
+			"user", user,
+			"count", count,
 			"took", time.Since(begin),
 			"err", err,
 		)
 	}(time.Now())
 
 	client := r.connection.(*mongo.Client)
-	collection := client.Database(r.database).Collection(REPCOLLECTION)
+	collection := client.Database(r.database).Collection(MSGCOLLECTION)
 
-	relation := &relationship{}
-	err = collection.FindOne(ctx, bson.M{"messageid": msgid}).Decode(&relation)
-	results = relation.ReplyIds
+	filter := mailboxFilter(user, MailboxQuery{Unread: true})
+	count, err = collection.CountDocuments(ctx, filter)
 
-	return results, err
+	return count, err
 }
 
-func (r *messageRepository) storeReplyRelationship(ctx context.Context, msgid primitive.ObjectID, replyid primitive.ObjectID) (relid string, err error) {
+func (r *messageRepository) GetReplyMessages(ctx context.Context, msgid string) (results []Record, err error) {
 
 	logger := log.With(ctxlog.Logger(ctx), "component", "repository")
 
 	defer func(begin time.Time) {
 		logger.Log(
-			"method", "store reply relationship",
+			"method", "get reply messages",
+			"msgid", msgid,
 			"took", time.Since(begin),
-			"relationship id", relid,
 			"err", err,
 		)
 	}(time.Now())
 
 	client := r.connection.(*mongo.Client)
-	collection := client.Database(r.database).Collection(REPCOLLECTION)
-
-	relation := &relationship{ReplyIds: make([]primitive.ObjectID, 1)}
-	relation.MessageId = msgid
-	relation.ReplyIds[0] = replyid
+	collection := client.Database(r.database).Collection(MSGCOLLECTION)
 
-	result, dberr := collection.InsertOne(ctx, relation)
+	filter := bson.D{{"replytomsgid", msgid}}
+	findOptions := options.Find().SetSort(bson.D{{"timestamp", 1}, {"_id", 1}})
+	cursor, dberr := collection.Find(ctx, filter, findOptions)
 	if dberr != nil {
 		err = dberr
-		return "", err
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var msg Record
+		dberr := cursor.Decode(&msg)
+		if dberr != nil {
+			logger.Log("method", "get reply messages", "msgid", msgid, "cursor error", dberr)
+		} else {
+			results = append(results, msg)
+		}
 	}
 
-	relid = fmt.Sprintf("%s", result.InsertedID.(primitive.ObjectID).Hex())
-	return relid, nil
+	return results, nil
 }
 
-func (r *messageRepository) updateReplyRelationship(ctx context.Context, msgId primitive.ObjectID, replyIds []primitive.ObjectID) (err error) {
+func (r *messageRepository) GetThreadMessages(ctx context.Context, msgid string) (results []Record, err error) {
 
 	logger := log.With(ctxlog.Logger(ctx), "component", "repository")
 
 	defer func(begin time.Time) {
 		logger.Log(
-			"method", "update reply relationship",
-			"msgid", msgId,
+			"method", "get thread messages",
+			"msgid", msgid,
+			"count", len(results),
 			"took", time.Since(begin),
-			"relationship id", msgId,
 			"err", err,
 		)
 	}(time.Now())
 
 	client := r.connection.(*mongo.Client)
-	collection := client.Database(r.database).Collection(REPCOLLECTION)
+	collection := client.Database(r.database).Collection(MSGCOLLECTION)
 
-	filter := bson.M{"messageid": msgId}
-	update := bson.D{{"$set", bson.D{{"replyids", replyIds}}}}
-	result, err := collection.UpdateOne(ctx, filter, update)
-	if err != nil {
-		msg := fmt.Sprintf("Matched %v documents and updated %v documents.\n", result.MatchedCount, result.ModifiedCount)
-		logger.Log("method", "update reply relationship", "info", msg)
+	// Walk down the thread one level at a time, fetching replies to all
+	// messages of the previous level with one query
+
+	parents := []string{msgid}
+	for len(parents) > 0 {
+		filter := bson.D{{"replytomsgid", bson.D{{"$in", parents}}}}
+		cursor, dberr := collection.Find(ctx, filter, options.Find())
+		if dberr != nil {
+			err = dberr
+			return nil, err
+		}
+		parents = nil
+		for cursor.Next(ctx) {
+			var msg Record
+			dberr := cursor.Decode(&msg)
+			if dberr != nil {
+				logger.Log("method", "get thread messages", "msgid", msgid, "cursor error", dberr)
+			} else {
+				results = append(results, msg)
+				parents = append(parents, msg.Id)
+			}
+		}
+		cursor.Close(ctx)
+	}
+
+	return results, nil
+}
+
+func (r *messageRepository) Purge(ctx context.Context) (err error) {
+
+	logger := log.With(ctxlog.Logger(ctx), "component", "repository")
+
+	defer func(begin time.Time) {
+		logger.Log(
+			"method", "purge",
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+
+	client := r.connection.(*mongo.Client)
+	collection := client.Database(r.database).Collection(MSGCOLLECTION)
+
+	deleteResult, dberr := collection.DeleteMany(ctx, bson.D{{}})
+	if dberr == nil {
+		msg := fmt.Sprintf("Deleted %v documents in the %s collection\n", deleteResult.DeletedCount, MSGCOLLECTION)
+		logger.Log("method", "purge", "info", msg)
+	} else {
+		err = dberr
 	}
 
 	return err
 }
 
+// Build filter selecting messages in mailbox of given user.
+func mailboxFilter(user string, query MailboxQuery) bson.D {
+	filter := bson.D{{"recipients", user}, {string(FlagDeleted), bson.D{{"$ne", user}}}}
+	if query.Archived {
+		filter = append(filter, bson.E{string(FlagArchived), user})
+	} else {
+		filter = append(filter, bson.E{string(FlagArchived), bson.D{{"$ne", user}}})
+	}
+	if query.Unread {
+		filter = append(filter, bson.E{string(FlagRead), bson.D{{"$ne", user}}})
+	}
+	if len(query.From) > 0 {
+		filter = append(filter, bson.E{"sender", query.From})
+	}
+	if len(query.Group) > 0 {
+		filter = append(filter, bson.E{"$or", bson.A{
+			bson.D{{"groupid", query.Group}},
+			bson.D{{"to.groupname", query.Group}},
+			bson.D{{"cc.groupname", query.Group}},
+		}})
+	}
+	var period bson.D
+	if !query.Since.IsZero() {
+		period = append(period, bson.E{"$gte", query.Since})
+	}
+	if !query.Until.IsZero() {
+		period = append(period, bson.E{"$lt", query.Until})
+	}
+	if len(period) > 0 {
+		filter = append(filter, bson.E{"timestamp", period})
+	}
+	if query.RepliesOnly {
+		filter = append(filter, bson.E{"replytomsgid", bson.D{{"$ne", ""}}})
+	}
+	if query.RootsOnly {
+		filter = append(filter, bson.E{"replytomsgid", ""})
+	}
+	return filter
+}
+
+// Create indexes supporting repository queries. Creating an index that already
+// exists is a no-op.
+func createIndexes(db *mongo.Database) error {
+	indexes := []mongo.IndexModel{
+		{Keys: bson.D{{"recipients", 1}, {"timestamp", -1}, {"_id", -1}}},
+		{Keys: bson.D{{"sender", 1}, {"timestamp", -1}, {"_id", -1}}},
+		{Keys: bson.D{{"replytomsgid", 1}}},
+		{Keys: bson.D{{"subject", "text"}, {"body", "text"}}},
+	}
+	_, err := db.Collection(MSGCOLLECTION).Indexes().CreateMany(context.TODO(), indexes)
+	if err != nil {
+		return errors.Wrap(err, "error creating indexes")
+	}
+	return nil
+}
+
+// relationship between original message and reply messages, as stored in
+// the replies collection
+type relationship struct {
+	MessageId primitive.ObjectID
+	ReplyIds  []primitive.ObjectID
+}
+
+// Move reply relationships of replies collection onto the replies themselves,
+// setting ReplyToMsgId of each reply that lacks it, and drop the collection.
+// Relationships are moved before the collection is dropped, so a migration
+// that fails part way is completed on next startup. Once the collection is
+// gone this is a no-op.
+func migrateReplies(ctx context.Context, db *mongo.Database) error {
+	cursor, err := db.Collection(REPCOLLECTION).Find(ctx, bson.D{})
+	if err != nil {
+		return errors.Wrap(err, "error reading reply relationships")
+	}
+	defer cursor.Close(ctx)
+
+	messages := db.Collection(MSGCOLLECTION)
+	for cursor.Next(ctx) {
+		var relation relationship
+		if err := cursor.Decode(&relation); err != nil {
+			return errors.Wrap(err, "error decoding reply relationship")
+		}
+		if len(relation.ReplyIds) == 0 {
+			continue
+		}
+		filter := bson.D{
+			{"_id", bson.D{{"$in", relation.ReplyIds}}},
+			{"replytomsgid", bson.D{{"$in", bson.A{"", nil}}}},
+		}
+		update := bson.D{{"$set", bson.D{{"replytomsgid", relation.MessageId.Hex()}}}}
+		if _, err := messages.UpdateMany(ctx, filter, update); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("error migrating replies to msg with id %s", relation.MessageId.Hex()))
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return errors.Wrap(err, "error reading reply relationships")
+	}
+
+	if err := db.Collection(REPCOLLECTION).Drop(ctx); err != nil {
+		return errors.Wrap(err, "error dropping replies collection")
+	}
+	return nil
+}
+
+// Trim records fetched for a page to the page limit and compute cursor of the
+// next page. Records must be fetched with one more than the limit.
+func pageOf(records []Record, limit int) ([]Record, string) {
+	if limit <= 0 || len(records) <= limit {
+		return records, ""
+	}
+	records = records[:limit]
+	return records, encodeCursor(records[limit-1])
+}
+
 func getDBConnection(dburl string) (interface{}, error) {
 	// Set client options
 	clientOptions := options.Client().ApplyURI(dburl)
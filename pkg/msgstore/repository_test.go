@@ -3,10 +3,14 @@ package msgstore
 import (
 	"context"
 	"fmt"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/matryer/is"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 // Test executor for message repository
@@ -17,6 +21,15 @@ func TestMessageRepository(t *testing.T) {
 	t.Run("StoreReply", func(t *testing.T) { s.testStoreReply(t, r) })
 	t.Run("GetMessage", func(t *testing.T) { s.testGetMessage(t, r) })
 	t.Run("GetUserMessages", func(t *testing.T) { s.testGetUserMessages(t, r) })
+	t.Run("GetUserMessagesPage", func(t *testing.T) { s.testGetUserMessagesPage(t, r) })
+	t.Run("GetFilteredUserMessages", func(t *testing.T) { s.testGetFilteredUserMessages(t, r) })
+	t.Run("GetSentMessagesPage", func(t *testing.T) { s.testGetSentMessagesPage(t, r) })
+	t.Run("SearchUserMessages", func(t *testing.T) { s.testSearchUserMessages(t, r) })
+	t.Run("ReadState", func(t *testing.T) { s.testReadState(t, r) })
+	t.Run("DeleteAndArchive", func(t *testing.T) { s.testDeleteAndArchive(t, r) })
+	t.Run("GetThreadMessages", func(t *testing.T) { s.testGetThreadMessages(t, r) })
+	t.Run("StoreConcurrentReplies", func(t *testing.T) { s.testStoreConcurrentReplies(t, r) })
+	t.Run("MigrateReplies", func(t *testing.T) { s.testMigrateReplies(t, r) })
 }
 
 // Test suite for message respository
@@ -145,3 +158,453 @@ func (s *repositoryTestSuite) testGetUserMessages(t *testing.T, r MessageReposit
 	}
 
 }
+
+// Test scenario - get messages sent to user one page at a time
+func (s *repositoryTestSuite) testGetUserMessagesPage(t *testing.T, r MessageRepository) {
+
+	r.Purge(s.ctx)
+
+	is := is.New(t)
+
+	var msgids []string
+	for i := 0; i < 5; i++ {
+		msg := &Record{Sender: "alice", Recipients: []string{"bob"}, Subject: fmt.Sprintf("test%d", i), Body: "this is a test message"}
+		msgid, err := r.StoreMessage(s.ctx, msg)
+		is.NoErr(err)
+		msgids = append(msgids, msgid)
+	}
+
+	{
+		msg := &Record{Sender: "bob", Recipients: []string{"alice"}, Subject: "other", Body: "not in bob's mailbox"}
+		_, err := r.StoreMessage(s.ctx, msg)
+		is.NoErr(err)
+	}
+
+	var (
+		cursor string
+		pages  [][]Record
+	)
+	for {
+		messages, next, err := r.GetUserMessagesPage(s.ctx, "bob", MailboxQuery{Limit: 2, Cursor: cursor})
+		is.NoErr(err)
+		pages = append(pages, messages)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	is.Equal(len(pages), 3)
+	is.Equal(len(pages[0]), 2)
+	is.Equal(len(pages[1]), 2)
+	is.Equal(len(pages[2]), 1)
+
+	// most recent message first
+	var received []string
+	for _, page := range pages {
+		for _, msg := range page {
+			received = append(received, msg.Id)
+		}
+	}
+	for i, msgid := range received {
+		is.Equal(msgid, msgids[len(msgids)-1-i])
+	}
+
+	{
+		messages, next, err := r.GetUserMessagesPage(s.ctx, "bob", MailboxQuery{})
+		is.NoErr(err)
+		is.Equal(len(messages), 5)
+		is.Equal(next, "")
+	}
+
+	{
+		_, _, err := r.GetUserMessagesPage(s.ctx, "bob", MailboxQuery{Limit: 2, Cursor: "bogus!"})
+		is.True(err != nil)
+	}
+
+}
+
+// Test scenario - get messages of a user filtered by sender, group, period and reply status
+func (s *repositoryTestSuite) testGetFilteredUserMessages(t *testing.T, r MessageRepository) {
+
+	r.Purge(s.ctx)
+
+	is := is.New(t)
+
+	// messages are stored apart so that the period filters can tell them
+	// apart by timestamp, which mongo keeps in milliseconds
+	store := func(msg *Record) string {
+		time.Sleep(2 * time.Millisecond)
+		msgid, err := r.StoreMessage(s.ctx, msg)
+		is.NoErr(err)
+		return msgid
+	}
+
+	direct := store(&Record{Sender: "alice", Recipients: []string{"bob"}, Subject: "direct", Body: "hi"})
+	group := store(&Record{Sender: "carol", GroupId: "friends", Recipients: []string{"bob", "alice"}, Subject: "group", Body: "hi"})
+	cc := store(&Record{Sender: "alice", Recipients: []string{"bob", "dave"}, Subject: "cc", Body: "hi",
+		To: []Addressee{{Username: "dave"}}, Cc: []Addressee{{Groupname: "friends"}}})
+	bcc := store(&Record{Sender: "alice", Recipients: []string{"bob", "dave"}, Subject: "bcc", Body: "hi",
+		To: []Addressee{{Username: "dave"}}, Bcc: []Addressee{{Groupname: "friends"}}})
+	reply := store(&Record{ReplyToMsgId: direct, Sender: "alice", Recipients: []string{"bob"}, Subject: "re:direct", Body: "again"})
+
+	received, err := r.GetMessage(s.ctx, cc)
+	is.NoErr(err)
+
+	ids := func(query MailboxQuery) []string {
+		messages, _, err := r.GetUserMessagesPage(s.ctx, "bob", query)
+		is.NoErr(err)
+		var msgids []string
+		for _, msg := range messages {
+			msgids = append(msgids, msg.Id)
+		}
+		return msgids
+	}
+
+	is.Equal(ids(MailboxQuery{From: "alice"}), []string{reply, bcc, cc, direct})
+	is.Equal(ids(MailboxQuery{Group: "friends"}), []string{cc, group})
+	is.Equal(ids(MailboxQuery{RepliesOnly: true}), []string{reply})
+	is.Equal(ids(MailboxQuery{RootsOnly: true, From: "alice"}), []string{bcc, cc, direct})
+	is.Equal(ids(MailboxQuery{Since: received.Timestamp}), []string{reply, bcc, cc})
+	is.Equal(ids(MailboxQuery{Until: received.Timestamp}), []string{group, direct})
+
+	// filters apply to every page
+	messages, next, err := r.GetUserMessagesPage(s.ctx, "bob", MailboxQuery{Limit: 1, From: "alice", RootsOnly: true})
+	is.NoErr(err)
+	is.Equal(messages[0].Id, bcc)
+	messages, _, err = r.GetUserMessagesPage(s.ctx, "bob", MailboxQuery{Limit: 1, Cursor: next, From: "alice", RootsOnly: true})
+	is.NoErr(err)
+	is.Equal(messages[0].Id, cc)
+}
+
+// Test scenario - get messages sent by a user in pages
+func (s *repositoryTestSuite) testGetSentMessagesPage(t *testing.T, r MessageRepository) {
+
+	r.Purge(s.ctx)
+
+	is := is.New(t)
+
+	var msgids []string
+	for i := 0; i < 3; i++ {
+		msg := &Record{Sender: "alice", Recipients: []string{"bob"}, Subject: fmt.Sprintf("test%d", i), Body: "this is a test message"}
+		msgid, err := r.StoreMessage(s.ctx, msg)
+		is.NoErr(err)
+		msgids = append(msgids, msgid)
+	}
+
+	{
+		msg := &Record{Sender: "bob", Recipients: []string{"alice"}, Subject: "other", Body: "not sent by alice"}
+		_, err := r.StoreMessage(s.ctx, msg)
+		is.NoErr(err)
+	}
+
+	messages, next, err := r.GetSentMessagesPage(s.ctx, "alice", MailboxQuery{Limit: 2})
+	is.NoErr(err)
+	is.Equal(len(messages), 2)
+	is.Equal(messages[0].Id, msgids[2])
+	is.Equal(messages[1].Id, msgids[1])
+	is.True(next != "")
+
+	messages, next, err = r.GetSentMessagesPage(s.ctx, "alice", MailboxQuery{Limit: 2, Cursor: next})
+	is.NoErr(err)
+	is.Equal(len(messages), 1)
+	is.Equal(messages[0].Id, msgids[0])
+	is.Equal(next, "")
+
+	// messages sent remain even when recipients delete them
+	is.NoErr(r.SetRecipientFlag(s.ctx, msgids[0], "bob", FlagDeleted, true))
+	messages, _, err = r.GetSentMessagesPage(s.ctx, "alice", MailboxQuery{})
+	is.NoErr(err)
+	is.Equal(len(messages), 3)
+}
+
+// Test scenario - search messages of a user by relevance
+func (s *repositoryTestSuite) testSearchUserMessages(t *testing.T, r MessageRepository) {
+
+	r.Purge(s.ctx)
+
+	is := is.New(t)
+
+	store := func(sender, recipient, subject, body string) string {
+		msg := &Record{Sender: sender, Recipients: []string{recipient}, Subject: subject, Body: body}
+		msgid, err := r.StoreMessage(s.ctx, msg)
+		is.NoErr(err)
+		return msgid
+	}
+
+	once := store("alice", "bob", "weekend", "lunch on sunday")
+	twice := store("alice", "bob", "lunch", "lunch at noon")
+	archived := store("carol", "bob", "lunch", "")
+	deleted := store("carol", "bob", "lunch", "")
+	sent := store("bob", "alice", "lunch", "sent by bob")
+	store("carol", "alice", "lunch", "neither sent nor received by bob")
+	store("alice", "bob", "dinner", "no match")
+
+	is.NoErr(r.SetRecipientFlag(s.ctx, archived, "bob", FlagArchived, true))
+	is.NoErr(r.SetRecipientFlag(s.ctx, deleted, "bob", FlagDeleted, true))
+
+	results, err := r.SearchUserMessages(s.ctx, "bob", SearchQuery{Text: "lunch"})
+	is.NoErr(err)
+	is.Equal(len(results), 4)
+	is.Equal(results[0].Id, twice)
+	is.True(results[0].Score > results[1].Score)
+
+	var found []string
+	for _, result := range results[1:] {
+		found = append(found, result.Id)
+	}
+	is.True(contains(found, once))
+	is.True(contains(found, archived))
+	is.True(contains(found, sent))
+
+	results, err = r.SearchUserMessages(s.ctx, "bob", SearchQuery{Text: "Lunch", Limit: 1})
+	is.NoErr(err)
+	is.Equal(len(results), 1)
+	is.Equal(results[0].Id, twice)
+
+	results, err = r.SearchUserMessages(s.ctx, "bob", SearchQuery{Text: "breakfast"})
+	is.NoErr(err)
+	is.Equal(len(results), 0)
+}
+
+// Test scenario - mark messages read and unread per recipient
+func (s *repositoryTestSuite) testReadState(t *testing.T, r MessageRepository) {
+
+	r.Purge(s.ctx)
+
+	is := is.New(t)
+
+	msg := &Record{Sender: "alice", Recipients: []string{"bob", "peter"}, Subject: "test", Body: "this is a test message"}
+	msgid, err := r.StoreMessage(s.ctx, msg)
+	is.NoErr(err)
+
+	{
+		msg := &Record{Sender: "alice", Recipients: []string{"bob"}, Subject: "test2", Body: "another test message"}
+		_, err := r.StoreMessage(s.ctx, msg)
+		is.NoErr(err)
+	}
+
+	is.NoErr(r.SetRecipientFlag(s.ctx, msgid, "bob", FlagRead, true))
+
+	{
+		count, err := r.CountUnreadMessages(s.ctx, "bob")
+		is.NoErr(err)
+		is.Equal(count, int64(1))
+	}
+
+	{
+		// read state of one recipient does not affect the others
+		count, err := r.CountUnreadMessages(s.ctx, "peter")
+		is.NoErr(err)
+		is.Equal(count, int64(1))
+	}
+
+	{
+		messages, _, err := r.GetUserMessagesPage(s.ctx, "bob", MailboxQuery{Unread: true})
+		is.NoErr(err)
+		is.Equal(len(messages), 1)
+		is.Equal(messages[0].Subject, "test2")
+	}
+
+	is.NoErr(r.SetRecipientFlag(s.ctx, msgid, "bob", FlagRead, false))
+
+	{
+		count, err := r.CountUnreadMessages(s.ctx, "bob")
+		is.NoErr(err)
+		is.Equal(count, int64(2))
+	}
+
+	{
+		// only recipients have read state
+		err := r.SetRecipientFlag(s.ctx, msgid, "alice", FlagRead, true)
+		is.True(err != nil)
+	}
+
+}
+
+// Test scenario - delete and archive messages per recipient
+func (s *repositoryTestSuite) testDeleteAndArchive(t *testing.T, r MessageRepository) {
+
+	r.Purge(s.ctx)
+
+	is := is.New(t)
+
+	msg := &Record{Sender: "alice", GroupId: "team", Recipients: []string{"bob", "peter"}, Subject: "test", Body: "this is a test message"}
+	msgid, err := r.StoreMessage(s.ctx, msg)
+	is.NoErr(err)
+
+	{
+		msg := &Record{Sender: "alice", Recipients: []string{"bob"}, Subject: "test2", Body: "another test message"}
+		_, err := r.StoreMessage(s.ctx, msg)
+		is.NoErr(err)
+	}
+
+	is.NoErr(r.SetRecipientFlag(s.ctx, msgid, "bob", FlagDeleted, true))
+
+	{
+		messages, err := r.GetUserMessages(s.ctx, "bob")
+		is.NoErr(err)
+		is.Equal(len(messages), 1)
+		is.Equal(messages[0].Subject, "test2")
+
+		count, err := r.CountUnreadMessages(s.ctx, "bob")
+		is.NoErr(err)
+		is.Equal(count, int64(1))
+	}
+
+	{
+		// message stays in mailbox of other group members
+		messages, err := r.GetUserMessages(s.ctx, "peter")
+		is.NoErr(err)
+		is.Equal(len(messages), 1)
+	}
+
+	{
+		// deleted message can not be changed any more
+		err := r.SetRecipientFlag(s.ctx, msgid, "bob", FlagRead, true)
+		is.True(err != nil)
+	}
+
+	is.NoErr(r.SetRecipientFlag(s.ctx, msgid, "peter", FlagArchived, true))
+
+	{
+		messages, _, err := r.GetUserMessagesPage(s.ctx, "peter", MailboxQuery{})
+		is.NoErr(err)
+		is.Equal(len(messages), 0)
+
+		messages, _, err = r.GetUserMessagesPage(s.ctx, "peter", MailboxQuery{Archived: true})
+		is.NoErr(err)
+		is.Equal(len(messages), 1)
+		is.Equal(messages[0].Id, msgid)
+	}
+
+	is.NoErr(r.SetRecipientFlag(s.ctx, msgid, "peter", FlagArchived, false))
+
+	{
+		messages, _, err := r.GetUserMessagesPage(s.ctx, "peter", MailboxQuery{})
+		is.NoErr(err)
+		is.Equal(len(messages), 1)
+	}
+
+}
+
+// Test scenario - get direct and indirect replies to a message
+func (s *repositoryTestSuite) testGetThreadMessages(t *testing.T, r MessageRepository) {
+
+	r.Purge(s.ctx)
+
+	is := is.New(t)
+
+	msg := &Record{Sender: "alice", Recipients: []string{"bob", "peter"}, Subject: "test", Body: "this is a test message"}
+	rootid, err := r.StoreMessage(s.ctx, msg)
+	is.NoErr(err)
+
+	reply := func(re string, sender string) string {
+		msg := &Record{ReplyToMsgId: re, Sender: sender, Recipients: []string{"alice"}, Subject: "re:test", Body: "reply"}
+		msgid, err := r.StoreMessage(s.ctx, msg)
+		is.NoErr(err)
+		return msgid
+	}
+
+	r1 := reply(rootid, "bob")
+	reply(rootid, "peter")
+	r11 := reply(r1, "alice")
+	reply(r11, "bob")
+
+	{
+		messages, err := r.GetThreadMessages(s.ctx, rootid)
+		is.NoErr(err)
+		is.Equal(len(messages), 4)
+	}
+
+	{
+		messages, err := r.GetThreadMessages(s.ctx, r1)
+		is.NoErr(err)
+		is.Equal(len(messages), 2)
+	}
+
+}
+
+// Test scenario - store many replies to the same message at the same time
+func (s *repositoryTestSuite) testStoreConcurrentReplies(t *testing.T, r MessageRepository) {
+
+	r.Purge(s.ctx)
+
+	is := is.New(t)
+
+	msg := &Record{Sender: "alice", Recipients: []string{"bob"}, Subject: "test", Body: "this is a test message"}
+	msgid, err := r.StoreMessage(s.ctx, msg)
+	is.NoErr(err)
+
+	const replies = 50
+
+	var wg sync.WaitGroup
+	errs := make(chan error, replies)
+	for i := 0; i < replies; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			msg := &Record{ReplyToMsgId: msgid, Sender: "bob", Recipients: []string{"alice"}, Subject: "re:test", Body: fmt.Sprintf("reply %d", i)}
+			_, err := r.StoreMessage(s.ctx, msg)
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		is.NoErr(err)
+	}
+
+	messages, err := r.GetReplyMessages(s.ctx, msgid)
+	is.NoErr(err)
+	is.Equal(len(messages), replies)
+
+	bodies := make(map[string]bool)
+	for _, msg := range messages {
+		bodies[msg.Body] = true
+	}
+	is.Equal(len(bodies), replies)
+
+}
+
+// Test scenario - replies related to their message in the replies collection
+// are correlated by ReplyToMsgId once migrated
+func (s *repositoryTestSuite) testMigrateReplies(t *testing.T, r MessageRepository) {
+
+	r.Purge(s.ctx)
+
+	is := is.New(t)
+
+	repository := r.(*messageRepository)
+	db := repository.connection.(*mongo.Client).Database(repository.database)
+
+	msgid, err := r.StoreMessage(s.ctx, &Record{Sender: "alice", Recipients: []string{"bob"}, Subject: "test", Body: "this is a test message"})
+	is.NoErr(err)
+
+	// reply stored before replies were correlated by ReplyToMsgId
+	result, err := db.Collection(MSGCOLLECTION).InsertOne(s.ctx, bson.D{
+		{"sender", "bob"}, {"recipients", bson.A{"alice"}}, {"subject", "re:test"}, {"body", "reply"},
+	})
+	is.NoErr(err)
+
+	originalid, _ := primitive.ObjectIDFromHex(msgid)
+	relation := relationship{originalid, []primitive.ObjectID{result.InsertedID.(primitive.ObjectID)}}
+	_, err = db.Collection(REPCOLLECTION).InsertOne(s.ctx, relation)
+	is.NoErr(err)
+
+	is.NoErr(migrateReplies(s.ctx, db))
+
+	messages, err := r.GetReplyMessages(s.ctx, msgid)
+	is.NoErr(err)
+	is.Equal(len(messages), 1)
+	is.Equal(messages[0].Body, "reply")
+
+	names, err := db.ListCollectionNames(s.ctx, bson.D{{"name", REPCOLLECTION}})
+	is.NoErr(err)
+	is.Equal(len(names), 0) // replies collection is dropped
+
+	// nothing left to migrate
+	is.NoErr(migrateReplies(s.ctx, db))
+
+}
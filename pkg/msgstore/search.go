@@ -0,0 +1,56 @@
+package msgstore
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Split text into lower case terms made of letters and digits.
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Get distinct terms of a search text in the order they appear.
+func searchTerms(text string) []string {
+	var terms []string
+	for _, term := range tokenize(text) {
+		terms = appendunique(terms, term)
+	}
+	return terms
+}
+
+// Find words of given field text that match any of given search terms. A word
+// matches a term it starts with, so that words found by the stemming text
+// search of mongo are highlighted as well. Offsets are counted in characters.
+func highlightsOf(field, text string, terms []string) []Highlight {
+	highlights := []Highlight{}
+	start, offset := -1, 0
+	var word []rune
+	flush := func() {
+		if start >= 0 {
+			lower := strings.ToLower(string(word))
+			for _, term := range terms {
+				if strings.HasPrefix(lower, term) {
+					highlights = append(highlights, Highlight{field, start, offset})
+					break
+				}
+			}
+		}
+		start, word = -1, word[:0]
+	}
+	for _, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if start < 0 {
+				start = offset
+			}
+			word = append(word, r)
+		} else {
+			flush()
+		}
+		offset++
+	}
+	flush()
+	return highlights
+}
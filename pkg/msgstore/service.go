@@ -4,37 +4,90 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/ghsbhatia/msgbox/pkg/middleware"
 	"github.com/ghsbhatia/msgbox/pkg/svcclient"
+	"github.com/ghsbhatia/msgbox/pkg/useradmin/api"
 )
 
 const no_docs_in_result = "no documents in result"
 const user_not_found = "user:404"
+const user_deactivated = "user:deactivated"
 const group_not_found = "group:404"
+const invalid_cursor = "invalid cursor"
 
 // Service interface for message store functions
 type Service interface {
 	// store a new message and return its id
-	StoreMessage(context.Context, message) (string, error)
+	StoreMessage(context.Context, Message) (string, error)
 	// get message for a given id
-	GetMessage(context.Context, string) (message, error)
+	GetMessage(context.Context, string) (Message, error)
 	// get messages for a given user
-	GetMessages(context.Context, string) ([]message, error)
+	GetMessages(context.Context, string) ([]Message, error)
+	// get a page of messages for a given user, most recent first, and the
+	// cursor of next page
+	GetMessagesPage(context.Context, string, MailboxQuery) ([]Message, string, error)
+	// get a page of messages sent by a given user, most recent first, and the
+	// cursor of next page
+	GetSentMessages(context.Context, string, MailboxQuery) ([]Message, string, error)
+	// search messages received or sent by a given user, most relevant first
+	SearchMessages(context.Context, string, SearchQuery) ([]SearchMatch, error)
+	// mark message as read by given user
+	MarkRead(context.Context, string, string) error
+	// mark message as not read by given user
+	MarkUnread(context.Context, string, string) error
+	// get number of messages not read by given user
+	GetUnreadCount(context.Context, string) (int64, error)
+	// move message out of mailbox of given user into archive
+	ArchiveMessage(context.Context, string, string) error
+	// move message back from archive into mailbox of given user
+	UnarchiveMessage(context.Context, string, string) error
+	// delete message from mailbox of given user
+	DeleteMessage(context.Context, string, string) error
 	// get replies for a given message id
-	GetReplies(context.Context, string) ([]message, error)
+	GetReplies(context.Context, string) ([]Message, error)
+	// get the whole conversation that given message id belongs to
+	GetThread(context.Context, string) (Thread, error)
+	// subscribe to events of a given user, starting with past events after a
+	// given event id, until context is done
+	SubscribeEvents(context.Context, string, uint64) (<-chan Event, error)
+}
+
+// Option to configure message store service
+type ServiceOption func(*service)
+
+// Cache user and group lookups against user service in given cache.
+func WithLookupCache(cache *LookupCache) ServiceOption {
+	return func(s *service) {
+		s.cache = cache
+	}
+}
+
+// Publish events of stored messages through given hub.
+func WithEventHub(hub *EventHub) ServiceOption {
+	return func(s *service) {
+		s.events = hub
+	}
 }
 
 // Create a new service instance with a given message repository
-func NewService(repository MessageRepository, client svcclient.HttpServiceClient, usersvcurl string) Service {
-	return &service{repository, client, usersvcurl}
+func NewService(repository MessageRepository, client svcclient.HttpServiceClient, usersvcurl string, options ...ServiceOption) Service {
+	svc := &service{repository: repository, httpsvclient: client, usersvcurl: usersvcurl, events: NewEventHub(defaultEventHistory)}
+	for _, option := range options {
+		option(svc)
+	}
+	return svc
 }
 
 type service struct {
 	repository   MessageRepository
 	httpsvclient svcclient.HttpServiceClient
 	usersvcurl   string
+	cache        *LookupCache
+	events       *EventHub
 }
 
 type replyMessageRecipient struct {
@@ -43,107 +96,380 @@ type replyMessageRecipient struct {
 }
 
 // Store the given message
-func (s *service) StoreMessage(ctx context.Context, msg message) (string, error) {
+func (s *service) StoreMessage(ctx context.Context, msg Message) (string, error) {
 
-	// Ensure sender is a registered user
-	{
-		_, err := s.getUser(ctx, msg.Sender)
-		if err != nil {
-			return "", s.mapError(err)
+	// Authenticated messages are always sent by the subject of the request
+	if subject, ok := middleware.Subject(ctx); ok {
+		msg.Sender = subject
+	}
+
+	// A message has either a single recipient or lists of addressees
+	if len(msg.Recipient.Groupname) > 0 || len(msg.Recipient.Username) > 0 {
+		if len(msg.To) > 0 || len(msg.Cc) > 0 || len(msg.Bcc) > 0 {
+			return "", ErrBadRequest
 		}
 	}
 
+	// Ensure sender is a registered user
+	sender, err := s.getUser(ctx, msg.Sender)
+	if err != nil {
+		return "", s.mapError(err)
+	}
+
 	if len(msg.Re) > 0 {
-		return s.storeReply(ctx, msg)
+		return s.storeReply(ctx, msg, sender)
 	}
 
-	// If message recipient is a group, get users for the group and store them as
-	// recipients
+	// Expand groups the message is addressed to into their users and store
+	// each user once as recipient
 
 	recipients := []string{}
-	if len(msg.Recipient.Groupname) > 0 {
-		grpusers, err := s.getGroupUsers(ctx, msg.Recipient.Groupname)
+	for _, rcv := range addresseesOf(msg) {
+		users, err := s.getAddresseeUsers(ctx, sender, rcv)
 		if err != nil {
-			return "", s.mapError(err)
+			return "", err
 		}
-		recipients = grpusers
-	} else if len(msg.Recipient.Username) > 0 {
-		_, err := s.getUser(ctx, msg.Recipient.Username)
-		if err != nil {
-			return "", s.mapError(err)
+		for _, user := range users {
+			recipients = appendunique(recipients, user)
 		}
-		recipients = append(recipients, msg.Recipient.Username)
 	}
 
 	record := &Record{
 		ReplyToMsgId: msg.Re,
 		Sender:       msg.Sender,
+		SenderName:   sender.DisplayName,
 		Recipients:   recipients,
 		GroupId:      msg.Recipient.Groupname,
+		To:           mapReceivers(msg.To),
+		Cc:           mapReceivers(msg.Cc),
+		Bcc:          mapReceivers(msg.Bcc),
 		Subject:      msg.Subject,
 		Body:         msg.Body,
 	}
 
-	return s.repository.StoreMessage(ctx, record)
+	return s.storeRecord(ctx, record)
 }
 
 // Get message corresponding to its id
-func (s *service) GetMessage(ctx context.Context, msgid string) (message, error) {
+func (s *service) GetMessage(ctx context.Context, msgid string) (Message, error) {
 	record, err := s.repository.GetMessage(ctx, msgid)
-	var msg message
-	if err == nil {
-		msg = mapRecord(record)
+	if err != nil {
+		return Message{}, s.mapError(err)
+	}
+	if err := authorizeMessage(ctx, record); err != nil {
+		return Message{}, err
 	}
-	return msg, s.mapError(err)
+	return mapRecord(record, viewerOf(ctx)), nil
 }
 
 // Get messages for a given user
-func (s *service) GetMessages(ctx context.Context, userid string) ([]message, error) {
+func (s *service) GetMessages(ctx context.Context, userid string) ([]Message, error) {
+	if err := authorizeMailbox(ctx, userid); err != nil {
+		return nil, err
+	}
 	_, iderr := s.getUser(ctx, userid)
 	if iderr != nil {
 		return nil, s.mapError(iderr)
 	}
 	records, err := s.repository.GetUserMessages(ctx, userid)
-	msgs := mapRecords(records)
+	msgs := mapMailboxRecords(records, userid)
 	return msgs, s.mapError(err)
 }
 
-// Get reply messages for message identified by given message id
-func (s *service) GetReplies(ctx context.Context, msgid string) ([]message, error) {
-	_, iderr := s.repository.GetMessage(ctx, msgid)
+// Get a page of messages for a given user
+func (s *service) GetMessagesPage(ctx context.Context, userid string, query MailboxQuery) ([]Message, string, error) {
+	if err := authorizeMailbox(ctx, userid); err != nil {
+		return nil, "", err
+	}
+	_, iderr := s.getUser(ctx, userid)
+	if iderr != nil {
+		return nil, "", s.mapError(iderr)
+	}
+	records, next, err := s.repository.GetUserMessagesPage(ctx, userid, query)
+	if err != nil {
+		return nil, "", s.mapError(err)
+	}
+	return mapMailboxRecords(records, userid), next, nil
+}
+
+// Get a page of messages sent by a given user
+func (s *service) GetSentMessages(ctx context.Context, userid string, query MailboxQuery) ([]Message, string, error) {
+	if err := authorizeMailbox(ctx, userid); err != nil {
+		return nil, "", err
+	}
+	_, iderr := s.getUser(ctx, userid)
+	if iderr != nil {
+		return nil, "", s.mapError(iderr)
+	}
+	records, next, err := s.repository.GetSentMessagesPage(ctx, userid, query)
+	if err != nil {
+		return nil, "", s.mapError(err)
+	}
+	// sent messages are seen by their sender, including bcc addressees
+	return mapRecords(records, userid), next, nil
+}
+
+// Search messages received or sent by a given user, including archived ones
+func (s *service) SearchMessages(ctx context.Context, userid string, query SearchQuery) ([]SearchMatch, error) {
+	if err := authorizeMailbox(ctx, userid); err != nil {
+		return nil, err
+	}
+	_, iderr := s.getUser(ctx, userid)
 	if iderr != nil {
 		return nil, s.mapError(iderr)
 	}
+	results, err := s.repository.SearchUserMessages(ctx, userid, query)
+	if err != nil {
+		return nil, s.mapError(err)
+	}
+	terms := searchTerms(query.Text)
+	found := []SearchMatch{}
+	for _, result := range results {
+		msg := mapRecord(result.Record, userid)
+		// messages the user only sent are never unread
+		msg.Unread = contains(result.Recipients, userid) && !contains(result.ReadBy, userid)
+		highlights := append(
+			highlightsOf("subject", msg.Subject, terms),
+			highlightsOf("body", msg.Body, terms)...,
+		)
+		found = append(found, SearchMatch{msg, result.Score, highlights})
+	}
+	return found, nil
+}
+
+// Subscribe to events of a given user
+func (s *service) SubscribeEvents(ctx context.Context, userid string, after uint64) (<-chan Event, error) {
+	if err := authorizeMailbox(ctx, userid); err != nil {
+		return nil, err
+	}
+	_, iderr := s.getUser(ctx, userid)
+	if iderr != nil {
+		return nil, s.mapError(iderr)
+	}
+	return s.events.subscribe(ctx, userid, after), nil
+}
+
+// Mark message identified by given message id as read by given user
+func (s *service) MarkRead(ctx context.Context, userid string, msgid string) error {
+	return s.setRecipientFlag(ctx, userid, msgid, FlagRead, true)
+}
+
+// Mark message identified by given message id as not read by given user
+func (s *service) MarkUnread(ctx context.Context, userid string, msgid string) error {
+	return s.setRecipientFlag(ctx, userid, msgid, FlagRead, false)
+}
+
+// Move message identified by given message id into archive of given user
+func (s *service) ArchiveMessage(ctx context.Context, userid string, msgid string) error {
+	return s.setRecipientFlag(ctx, userid, msgid, FlagArchived, true)
+}
+
+// Move message identified by given message id from archive of given user back
+// into the mailbox
+func (s *service) UnarchiveMessage(ctx context.Context, userid string, msgid string) error {
+	return s.setRecipientFlag(ctx, userid, msgid, FlagArchived, false)
+}
+
+// Delete message identified by given message id from mailbox of given user.
+// The message stays in mailboxes of other recipients.
+func (s *service) DeleteMessage(ctx context.Context, userid string, msgid string) error {
+	return s.setRecipientFlag(ctx, userid, msgid, FlagDeleted, true)
+}
+
+// Get number of messages in mailbox of given user that the user has not read
+func (s *service) GetUnreadCount(ctx context.Context, userid string) (int64, error) {
+	if err := authorizeMailbox(ctx, userid); err != nil {
+		return 0, err
+	}
+	_, iderr := s.getUser(ctx, userid)
+	if iderr != nil {
+		return 0, s.mapError(iderr)
+	}
+	count, err := s.repository.CountUnreadMessages(ctx, userid)
+	return count, s.mapError(err)
+}
+
+// Set or clear flag of message identified by given message id for given user
+func (s *service) setRecipientFlag(ctx context.Context, userid string, msgid string, flag RecipientFlag, set bool) error {
+	if err := authorizeMailbox(ctx, userid); err != nil {
+		return err
+	}
+	_, iderr := s.getUser(ctx, userid)
+	if iderr != nil {
+		return s.mapError(iderr)
+	}
+	err := s.repository.SetRecipientFlag(ctx, msgid, userid, flag, set)
+	return s.mapError(err)
+}
+
+// Get reply messages for message identified by given message id. Replies
+// that an authenticated viewer neither sent nor received are left out.
+func (s *service) GetReplies(ctx context.Context, msgid string) ([]Message, error) {
+	original, iderr := s.repository.GetMessage(ctx, msgid)
+	if iderr != nil {
+		return nil, s.mapError(iderr)
+	}
+	if err := authorizeMessage(ctx, original); err != nil {
+		return nil, err
+	}
 	records, err := s.repository.GetReplyMessages(ctx, msgid)
-	msgs := mapRecords(records)
+	viewer := viewerOf(ctx)
+	visible := []Record{}
+	for _, record := range records {
+		if canView(record, viewer) {
+			visible = append(visible, record)
+		}
+	}
+	msgs := mapRecords(visible, viewer)
 	return msgs, s.mapError(err)
 }
 
-// Get users for group identified by given group id
-func (s *service) getGroupUsers(ctx context.Context, groupid string) ([]string, error) {
-	var group struct {
-		Groupname string   `json:"groupname"`
-		Usernames []string `json:"usernames"`
+// Get conversation tree that message identified by given message id belongs
+// to. The tree starts at the message that is not a reply and replies on each
+// level are ordered by timestamp. Messages in the tree that an authenticated
+// viewer neither sent nor received are shown by their ids only.
+func (s *service) GetThread(ctx context.Context, msgid string) (Thread, error) {
+	root, err := s.repository.GetMessage(ctx, msgid)
+	if err != nil {
+		return Thread{}, s.mapError(err)
+	}
+	if err := authorizeMessage(ctx, root); err != nil {
+		return Thread{}, err
 	}
-	requesturl := fmt.Sprintf("%s/groups/%s", s.usersvcurl, groupid)
-	err := s.httpsvclient.Get(requesturl, &group)
-	if err != nil && err.Error() == "404" {
-		err = errors.New("group:404")
+	for len(root.ReplyToMsgId) > 0 {
+		root, err = s.repository.GetMessage(ctx, root.ReplyToMsgId)
+		if err != nil {
+			return Thread{}, s.mapError(err)
+		}
+	}
+	records, err := s.repository.GetThreadMessages(ctx, root.Id)
+	if err != nil {
+		return Thread{}, s.mapError(err)
+	}
+	replies := make(map[string][]Record)
+	for _, record := range records {
+		replies[record.ReplyToMsgId] = append(replies[record.ReplyToMsgId], record)
 	}
-	return group.Usernames, err
+	return buildThread(root, replies, viewerOf(ctx), 0), nil
 }
 
-// Get user for given id
-func (s *service) getUser(ctx context.Context, userid string) (string, error) {
-	var user struct {
-		Id string `json:"id"`
+// Check that an authenticated request accesses the mailbox of its own subject.
+func authorizeMailbox(ctx context.Context, userid string) error {
+	if subject, ok := middleware.Subject(ctx); ok && subject != userid {
+		return ErrForbidden
 	}
-	requesturl := fmt.Sprintf("%s/users/%s", s.usersvcurl, userid)
-	err := s.httpsvclient.Get(requesturl, &user)
-	if err != nil && err.Error() == "404" {
-		err = errors.New("user:404")
+	return nil
+}
+
+// Check that an authenticated request views a message that its subject sent or
+// received.
+func authorizeMessage(ctx context.Context, record Record) error {
+	if subject, ok := middleware.Subject(ctx); ok && !canView(record, subject) {
+		return ErrForbidden
 	}
-	return user.Id, err
+	return nil
+}
+
+// Check whether given viewer may see a message, which is any message when the
+// viewer is not authenticated.
+func canView(record Record, viewer string) bool {
+	return len(viewer) == 0 || record.Sender == viewer || contains(record.Recipients, viewer)
+}
+
+// Get users that given addressee of a message from sender stands for. Groups
+// are subject to their posting policy.
+func (s *service) getAddresseeUsers(ctx context.Context, sender api.UserDetails, rcv Receiver) ([]string, error) {
+	if len(rcv.Groupname) > 0 {
+		group, err := s.getGroup(ctx, rcv.Groupname)
+		if err != nil {
+			return nil, s.mapError(err)
+		}
+		if err := authorizeGroupPost(sender, group); err != nil {
+			return nil, err
+		}
+		return group.Usernames, nil
+	}
+	if _, err := s.getUser(ctx, rcv.Username); err != nil {
+		return nil, s.mapError(err)
+	}
+	return []string{rcv.Username}, nil
+}
+
+// Get all addressees of a message, which is either the single recipient or
+// the users and groups in its to, cc and bcc lists.
+func addresseesOf(msg Message) []Receiver {
+	if len(msg.Recipient.Groupname) > 0 || len(msg.Recipient.Username) > 0 {
+		return []Receiver{msg.Recipient}
+	}
+	addressees := make([]Receiver, 0, len(msg.To)+len(msg.Cc)+len(msg.Bcc))
+	addressees = append(addressees, msg.To...)
+	addressees = append(addressees, msg.Cc...)
+	return append(addressees, msg.Bcc...)
+}
+
+// Get authenticated subject viewing messages, or empty string when request is
+// not authenticated.
+func viewerOf(ctx context.Context) string {
+	subject, _ := middleware.Subject(ctx)
+	return subject
+}
+
+// Check that sender may post to given group under its posting policy. Admins
+// may post to any group.
+func authorizeGroupPost(sender api.UserDetails, group api.GroupDetails) error {
+	if sender.Role == api.RoleAdmin {
+		return nil
+	}
+	switch group.Policy {
+	case "", api.PolicyOpen:
+		return nil
+	case api.PolicyMembers:
+		if contains(group.Usernames, sender.Id) {
+			return nil
+		}
+	case api.PolicyAnnounce:
+		if contains(group.Moderators, sender.Id) {
+			return nil
+		}
+	}
+	return ErrPostingNotPermitted
+}
+
+// Get group identified by given group id along with its users and posting
+// policy
+func (s *service) getGroup(ctx context.Context, groupid string) (api.GroupDetails, error) {
+	value, err := s.cache.lookup(groupLookup, groupid, func() (interface{}, error) {
+		var group api.GroupDetails
+		requesturl := fmt.Sprintf("%s/groups/%s", s.usersvcurl, groupid)
+		err := s.httpsvclient.Get(ctx, requesturl, &group)
+		if err != nil && err.Error() == "404" {
+			err = errors.New("group:404")
+		}
+		return group, err
+	})
+	group := value.(api.GroupDetails)
+	// callers may append to the users, so do not hand out the cached slice
+	group.Usernames = append([]string(nil), group.Usernames...)
+	return group, err
+}
+
+// Get user for given id. Deactivated users are reported as an error as they
+// can neither send nor receive messages.
+func (s *service) getUser(ctx context.Context, userid string) (api.UserDetails, error) {
+	value, err := s.cache.lookup(userLookup, userid, func() (interface{}, error) {
+		var user api.UserDetails
+		requesturl := fmt.Sprintf("%s/users/%s", s.usersvcurl, userid)
+		err := s.httpsvclient.Get(ctx, requesturl, &user)
+		if err != nil && err.Error() == "404" {
+			err = errors.New("user:404")
+		}
+		return user, err
+	})
+	user := value.(api.UserDetails)
+	if err == nil && user.Deactivated {
+		err = errors.New(user_deactivated)
+	}
+	return user, err
 }
 
 // Get recipients for the reply to message identified by given message id
@@ -156,7 +482,7 @@ func (s *service) getReplyRecipient(ctx context.Context, msgid string) (*replyMe
 }
 
 // Store reply message by deriving recipient from original message
-func (s *service) storeReply(ctx context.Context, msg message) (string, error) {
+func (s *service) storeReply(ctx context.Context, msg Message, sender api.UserDetails) (string, error) {
 
 	_, iderr := s.repository.GetMessage(ctx, msg.Re)
 	if iderr != nil {
@@ -170,26 +496,71 @@ func (s *service) storeReply(ctx context.Context, msg message) (string, error) {
 
 	var recipients []string
 	if len(recipient.group) > 0 {
-		var err error
-		recipients, err = s.getGroupUsers(ctx, recipient.group)
+		group, err := s.getGroup(ctx, recipient.group)
 		if err != nil {
 			return "", s.mapError(err)
 		}
+		// Replies reach the whole group, so they are subject to its policy
+		if err := authorizeGroupPost(sender, group); err != nil {
+			return "", err
+		}
+		// Members and the original sender that can no longer receive
+		// messages are left out, so that the thread goes on without them
+		for _, user := range append(group.Usernames, recipient.sender) {
+			if _, err := s.getUser(ctx, user); err != nil {
+				if err := s.mapError(err); err != ErrUserDeactivated && err != ErrUserNotFound {
+					return "", err
+				}
+				continue
+			}
+			recipients = appendunique(recipients, user)
+		}
+	} else {
+		// Sender of original message must still be able to receive messages
+		if _, err := s.getUser(ctx, recipient.sender); err != nil {
+			return "", s.mapError(err)
+		}
+		recipients = []string{recipient.sender}
 	}
 
-	recipients = appendunique(recipients, recipient.sender)
-
 	record := &Record{
 		ReplyToMsgId: msg.Re,
 		Sender:       msg.Sender,
+		SenderName:   sender.DisplayName,
 		Recipients:   recipients,
 		GroupId:      recipient.group,
 		Subject:      msg.Subject,
 		Body:         msg.Body,
 	}
 
-	return s.repository.StoreMessage(ctx, record)
+	return s.storeRecord(ctx, record)
+
+}
+
+// Store message record and publish events about it
+func (s *service) storeRecord(ctx context.Context, record *Record) (string, error) {
+	msgid, err := s.repository.StoreMessage(ctx, record)
+	if err != nil {
+		return "", err
+	}
+	record.Id = msgid
+	s.publish(ctx, record)
+	return msgid, nil
+}
 
+// Publish events about a stored message to the users who may see it, which
+// are its recipients and its sender. Others taking part in the thread of a
+// reply are not told, as the reply may not be addressed to them.
+func (s *service) publish(ctx context.Context, record *Record) {
+	eventType := eventMessage
+	if len(record.ReplyToMsgId) > 0 {
+		eventType = eventReply
+	}
+	for _, user := range appendunique(append([]string{}, record.Recipients...), record.Sender) {
+		msg := mapRecord(*record, user)
+		msg.Unread = contains(record.Recipients, user)
+		s.events.publish(user, eventType, msg)
+	}
 }
 
 // Map DB Error to Service Error
@@ -197,6 +568,9 @@ func (s *service) mapError(err error) error {
 	if err == nil {
 		return nil
 	}
+	if err == svcclient.ErrUnavailable {
+		return ErrUpstreamUnavailable
+	}
 	msg := err.Error()
 	if strings.Contains(msg, no_docs_in_result) {
 		return ErrMsgNotFound
@@ -204,9 +578,15 @@ func (s *service) mapError(err error) error {
 	if strings.Contains(msg, user_not_found) {
 		return ErrUserNotFound
 	}
+	if strings.Contains(msg, user_deactivated) {
+		return ErrUserDeactivated
+	}
 	if strings.Contains(msg, group_not_found) {
 		return ErrGroupNotFound
 	}
+	if strings.Contains(msg, invalid_cursor) {
+		return ErrBadRequest
+	}
 	return ErrSystemError
 }
 
@@ -220,29 +600,93 @@ func appendunique(collection []string, element string) []string {
 	return append(collection, element)
 }
 
+// Build conversation tree rooted at given record from replies keyed by id of
+// the message they reply to.
+func buildThread(root Record, replies map[string][]Record, viewer string, depth int) Thread {
+	children := replies[root.Id]
+	sort.Slice(children, func(i, j int) bool {
+		if children[i].Timestamp.Equal(children[j].Timestamp) {
+			return children[i].Id < children[j].Id
+		}
+		return children[i].Timestamp.Before(children[j].Timestamp)
+	})
+	node := Thread{Message: Message{Id: root.Id, Re: root.ReplyToMsgId}, Depth: depth, Replies: []Thread{}}
+	if canView(root, viewer) {
+		node.Message = mapRecord(root, viewer)
+	}
+	for _, child := range children {
+		node.Replies = append(node.Replies, buildThread(child, replies, viewer, depth+1))
+	}
+	return node
+}
+
 // Map repository records to transport message structure.
-func mapRecords(records []Record) []message {
-	var messages []message = []message{}
+func mapRecords(records []Record, viewer string) []Message {
+	var messages []Message = []Message{}
+	for _, record := range records {
+		messages = append(messages, mapRecord(record, viewer))
+	}
+	return messages
+}
+
+// Map repository records in mailbox of given user to transport message
+// structure, including state of the message for the user.
+func mapMailboxRecords(records []Record, userid string) []Message {
+	var messages []Message = []Message{}
 	for _, record := range records {
-		messages = append(messages, mapRecord(record))
+		msg := mapRecord(record, userid)
+		msg.Unread = !contains(record.ReadBy, userid)
+		messages = append(messages, msg)
 	}
 	return messages
 }
 
-// Map repository record to transport message structure.
-func mapRecord(record Record) message {
-	msg := message{
-		Id:        record.Id,
-		Re:        record.ReplyToMsgId,
-		Sender:    record.Sender,
-		Subject:   record.Subject,
-		Body:      record.Body,
-		Timestamp: record.Timestamp.Format(time.RFC3339),
+// Map repository record to transport message structure as seen by given
+// viewer. Bcc addressees are seen only by the sender.
+func mapRecord(record Record, viewer string) Message {
+	msg := Message{
+		Id:         record.Id,
+		Re:         record.ReplyToMsgId,
+		Sender:     record.Sender,
+		SenderName: record.SenderName,
+		Subject:    record.Subject,
+		Body:       record.Body,
+		Timestamp:  record.Timestamp.Format(time.RFC3339),
 	}
-	if len(record.GroupId) > 0 {
+	if len(record.To) > 0 || len(record.Cc) > 0 || len(record.Bcc) > 0 {
+		msg.To = mapAddressees(record.To)
+		msg.Cc = mapAddressees(record.Cc)
+		if viewer == record.Sender {
+			msg.Bcc = mapAddressees(record.Bcc)
+		}
+	} else if len(record.GroupId) > 0 {
 		msg.Recipient.Groupname = record.GroupId
 	} else {
 		msg.Recipient.Username = record.Recipients[0]
 	}
 	return msg
 }
+
+// Map transport receivers to repository addressees.
+func mapReceivers(receivers []Receiver) []Addressee {
+	if len(receivers) == 0 {
+		return nil
+	}
+	addressees := make([]Addressee, 0, len(receivers))
+	for _, rcv := range receivers {
+		addressees = append(addressees, Addressee{Username: rcv.Username, Groupname: rcv.Groupname})
+	}
+	return addressees
+}
+
+// Map repository addressees to transport receivers.
+func mapAddressees(addressees []Addressee) []Receiver {
+	if len(addressees) == 0 {
+		return nil
+	}
+	receivers := make([]Receiver, 0, len(addressees))
+	for _, addressee := range addressees {
+		receivers = append(receivers, Receiver{Groupname: addressee.Groupname, Username: addressee.Username})
+	}
+	return receivers
+}
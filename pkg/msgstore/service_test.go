@@ -3,9 +3,14 @@ package msgstore
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/ghsbhatia/msgbox/pkg/middleware"
+	"github.com/ghsbhatia/msgbox/pkg/svcclient"
+	"github.com/ghsbhatia/msgbox/pkg/useradmin/api"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -15,7 +20,7 @@ type MockedSvcClient struct {
 	Usernames []string
 }
 
-func (m *MockedSvcClient) Get(url string, v interface{}) error {
+func (m *MockedSvcClient) Get(ctx context.Context, url string, v interface{}) error {
 	bytearray, _ := json.Marshal(m)
 	err := json.Unmarshal(bytearray, v)
 	return err
@@ -25,12 +30,54 @@ type MockedUserSvcClient struct {
 	Id string
 }
 
-func (m *MockedUserSvcClient) Get(url string, v interface{}) error {
+func (m *MockedUserSvcClient) Get(ctx context.Context, url string, v interface{}) error {
 	bytearray, _ := json.Marshal(m)
 	err := json.Unmarshal(bytearray, v)
 	return err
 }
 
+type MockedUsersSvcClient struct {
+	users map[string]api.UserDetails
+}
+
+func (m *MockedUsersSvcClient) Get(ctx context.Context, url string, v interface{}) error {
+	user, ok := m.users[url[strings.LastIndex(url, "/")+1:]]
+	if !ok {
+		return errors.New("404")
+	}
+	bytearray, _ := json.Marshal(user)
+	return json.Unmarshal(bytearray, v)
+}
+
+type MockedDirectorySvcClient struct {
+	users  map[string]api.UserDetails
+	groups map[string]api.GroupDetails
+}
+
+func (m *MockedDirectorySvcClient) Get(ctx context.Context, url string, v interface{}) error {
+	id := url[strings.LastIndex(url, "/")+1:]
+	var entry interface{}
+	var ok bool
+	if strings.Contains(url, "/groups/") {
+		entry, ok = m.groups[id]
+	} else {
+		entry, ok = m.users[id]
+	}
+	if !ok {
+		return errors.New("404")
+	}
+	bytearray, _ := json.Marshal(entry)
+	return json.Unmarshal(bytearray, v)
+}
+
+type MockedFailingSvcClient struct {
+	err error
+}
+
+func (m *MockedFailingSvcClient) Get(ctx context.Context, url string, v interface{}) error {
+	return m.err
+}
+
 type MockedRepository struct {
 	mock.Mock
 }
@@ -45,16 +92,46 @@ func (m *MockedRepository) GetUserMessages(ctx context.Context, user string) (re
 	return args.Get(0).([]Record), args.Error(1)
 }
 
+func (m *MockedRepository) GetUserMessagesPage(ctx context.Context, user string, query MailboxQuery) (results []Record, next string, err error) {
+	args := m.Called(ctx, user, query)
+	return args.Get(0).([]Record), args.String(1), args.Error(2)
+}
+
+func (m *MockedRepository) GetSentMessagesPage(ctx context.Context, user string, query MailboxQuery) (results []Record, next string, err error) {
+	args := m.Called(ctx, user, query)
+	return args.Get(0).([]Record), args.String(1), args.Error(2)
+}
+
+func (m *MockedRepository) SearchUserMessages(ctx context.Context, user string, query SearchQuery) ([]SearchResult, error) {
+	args := m.Called(ctx, user, query)
+	return args.Get(0).([]SearchResult), args.Error(1)
+}
+
 func (m *MockedRepository) GetMessage(ctx context.Context, msgid string) (result Record, err error) {
 	args := m.Called(ctx, msgid)
 	return args.Get(0).(Record), args.Error(1)
 }
 
+func (m *MockedRepository) SetRecipientFlag(ctx context.Context, msgid string, user string, flag RecipientFlag, set bool) error {
+	args := m.Called(ctx, msgid, user, flag, set)
+	return args.Error(0)
+}
+
+func (m *MockedRepository) CountUnreadMessages(ctx context.Context, user string) (int64, error) {
+	args := m.Called(ctx, user)
+	return args.Get(0).(int64), args.Error(1)
+}
+
 func (m *MockedRepository) GetReplyMessages(ctx context.Context, msgid string) (results []Record, err error) {
 	args := m.Called(ctx, msgid)
 	return args.Get(0).([]Record), args.Error(1)
 }
 
+func (m *MockedRepository) GetThreadMessages(ctx context.Context, msgid string) (results []Record, err error) {
+	args := m.Called(ctx, msgid)
+	return args.Get(0).([]Record), args.Error(1)
+}
+
 func (m *MockedRepository) Purge(ctx context.Context) error {
 	args := m.Called(ctx)
 	return args.Error(0)
@@ -65,10 +142,33 @@ func TestMessageStoreService(t *testing.T) {
 	s := &serviceTestSuite{}
 	t.Run("StoreMessageForUser", func(t *testing.T) { s.testStoreMessageForUser(t) })
 	t.Run("StoreMessageForGroup", func(t *testing.T) { s.testStoreMessageForGroup(t) })
+	t.Run("StoreMessageUpstreamUnavailable", func(t *testing.T) { s.testStoreMessageUpstreamUnavailable(t) })
+	t.Run("StoreMessageSenderName", func(t *testing.T) { s.testStoreMessageSenderName(t) })
+	t.Run("StoreMessageAuthenticatedSender", func(t *testing.T) { s.testStoreMessageAuthenticatedSender(t) })
+	t.Run("StoreMessageRecipientDeactivated", func(t *testing.T) { s.testStoreMessageRecipientDeactivated(t) })
+	t.Run("StoreMessageGroupPolicy", func(t *testing.T) { s.testStoreMessageGroupPolicy(t) })
+	t.Run("StoreMessageAddressees", func(t *testing.T) { s.testStoreMessageAddressees(t) })
+	t.Run("GetMessageHidesBcc", func(t *testing.T) { s.testGetMessageHidesBcc(t) })
+	t.Run("StoreReplyGroupPolicy", func(t *testing.T) { s.testStoreReplyGroupPolicy(t) })
+	t.Run("StoreReplyRecipientDeactivated", func(t *testing.T) { s.testStoreReplyRecipientDeactivated(t) })
+	t.Run("StoreReplyGroupSenderDeactivated", func(t *testing.T) { s.testStoreReplyGroupSenderDeactivated(t) })
 	t.Run("StoreReply", func(t *testing.T) { s.testStoreReply(t) })
+	t.Run("StoreMessagePublishesEvents", func(t *testing.T) { s.testStoreMessagePublishesEvents(t) })
 	t.Run("GetMessageForId", func(t *testing.T) { s.testGetMessageForId(t) })
 	t.Run("GetMessagesForUser", func(t *testing.T) { s.testGetMessagesForUser(t) })
+	t.Run("GetMessagesPageForUser", func(t *testing.T) { s.testGetMessagesPageForUser(t) })
+	t.Run("GetMessagesPageInvalidCursor", func(t *testing.T) { s.testGetMessagesPageInvalidCursor(t) })
+	t.Run("GetMessagesForbidden", func(t *testing.T) { s.testGetMessagesForbidden(t) })
+	t.Run("GetMessageNotViewer", func(t *testing.T) { s.testGetMessageNotViewer(t) })
+	t.Run("GetSentMessages", func(t *testing.T) { s.testGetSentMessages(t) })
+	t.Run("SearchMessages", func(t *testing.T) { s.testSearchMessages(t) })
 	t.Run("GetReplyMessages", func(t *testing.T) { s.testGetReplyMessages(t) })
+	t.Run("MarkRead", func(t *testing.T) { s.testMarkRead(t) })
+	t.Run("MarkUnreadNotRecipient", func(t *testing.T) { s.testMarkUnreadNotRecipient(t) })
+	t.Run("GetUnreadCount", func(t *testing.T) { s.testGetUnreadCount(t) })
+	t.Run("DeleteMessage", func(t *testing.T) { s.testDeleteMessage(t) })
+	t.Run("ArchiveMessage", func(t *testing.T) { s.testArchiveMessage(t) })
+	t.Run("GetThread", func(t *testing.T) { s.testGetThread(t) })
 }
 
 // Test suite for message store service
@@ -92,8 +192,8 @@ func (s *serviceTestSuite) testStoreMessageForUser(t *testing.T) {
 
 	service := NewService(repository, svcclient, "/foo")
 
-	rcv := receiver{Username: "user1"}
-	msg := message{Sender: "tester", Subject: "test", Body: "body", Recipient: rcv}
+	rcv := Receiver{Username: "user1"}
+	msg := Message{Sender: "tester", Subject: "test", Body: "body", Recipient: rcv}
 
 	msgid, _ := service.StoreMessage(ctx, msg)
 
@@ -120,8 +220,8 @@ func (s *serviceTestSuite) testStoreMessageForGroup(t *testing.T) {
 
 	service := NewService(repository, svcclient, "/foo")
 
-	rcv := receiver{Groupname: "tstgroup"}
-	msg := message{Sender: "tester", Subject: "test", Body: "body", Recipient: rcv}
+	rcv := Receiver{Groupname: "tstgroup"}
+	msg := Message{Sender: "tester", Subject: "test", Body: "body", Recipient: rcv}
 
 	msgid, _ := service.StoreMessage(ctx, msg)
 
@@ -129,6 +229,337 @@ func (s *serviceTestSuite) testStoreMessageForGroup(t *testing.T) {
 	assert.Equal(t, "id:01", msgid)
 }
 
+// Test scenario - Store a message while user service is unavailable
+func (s *serviceTestSuite) testStoreMessageUpstreamUnavailable(t *testing.T) {
+	ctx := context.TODO()
+
+	repository := new(MockedRepository)
+
+	client := &MockedFailingSvcClient{svcclient.ErrUnavailable}
+
+	service := NewService(repository, client, "/foo")
+
+	rcv := Receiver{Username: "user1"}
+	msg := Message{Sender: "tester", Subject: "test", Body: "body", Recipient: rcv}
+
+	_, err := service.StoreMessage(ctx, msg)
+
+	repository.AssertNotCalled(t, "StoreMessage", ctx, mock.Anything)
+	assert.Equal(t, ErrUpstreamUnavailable, err)
+}
+
+// Test scenario - Store a message along with display name of sender
+func (s *serviceTestSuite) testStoreMessageSenderName(t *testing.T) {
+	ctx := context.TODO()
+
+	rec := &Record{
+		Sender:     "tester",
+		SenderName: "Test User",
+		Subject:    "test",
+		Body:       "body",
+		Recipients: []string{"user1"},
+	}
+
+	repository := new(MockedRepository)
+	repository.On("StoreMessage", ctx, rec).Return("id:01", nil)
+	repository.On("GetMessage", ctx, "id:01").Return(*rec, nil)
+
+	client := &MockedUsersSvcClient{map[string]api.UserDetails{
+		"tester": {Id: "tester", DisplayName: "Test User"},
+		"user1":  {Id: "user1"},
+	}}
+
+	service := NewService(repository, client, "/foo")
+
+	rcv := Receiver{Username: "user1"}
+	msg := Message{Sender: "tester", Subject: "test", Body: "body", Recipient: rcv}
+
+	msgid, err := service.StoreMessage(ctx, msg)
+	assert.NoError(t, err)
+
+	stored, err := service.GetMessage(ctx, msgid)
+	assert.NoError(t, err)
+
+	repository.AssertExpectations(t)
+	assert.Equal(t, "Test User", stored.SenderName)
+}
+
+// Test scenario - Store a message on behalf of authenticated subject
+func (s *serviceTestSuite) testStoreMessageAuthenticatedSender(t *testing.T) {
+	ctx := middleware.NewAuthContext(context.TODO(), "alice", "token")
+
+	rec := &Record{
+		Sender:     "alice",
+		Subject:    "test",
+		Body:       "body",
+		Recipients: []string{"user1"},
+	}
+
+	repository := new(MockedRepository)
+	repository.On("StoreMessage", ctx, rec).Return("id:01", nil)
+
+	service := NewService(repository, &MockedUserSvcClient{"user"}, "/foo")
+
+	rcv := Receiver{Username: "user1"}
+	msg := Message{Sender: "mallory", Subject: "test", Body: "body", Recipient: rcv}
+
+	msgid, err := service.StoreMessage(ctx, msg)
+
+	assert.NoError(t, err)
+	repository.AssertExpectations(t)
+	assert.Equal(t, "id:01", msgid)
+}
+
+// Directory of users and groups with each posting policy. Bob moderates all
+// groups he is a member of and alice is an admin.
+var policyDirectory = &MockedDirectorySvcClient{
+	users: map[string]api.UserDetails{
+		"alice": {Id: "alice", Role: "admin"},
+		"bob":   {Id: "bob", Role: "member"},
+		"carol": {Id: "carol", Role: "member"},
+		"dave":  {Id: "dave", Role: "member"},
+	},
+	groups: map[string]api.GroupDetails{
+		"open":     {Groupname: "open", Usernames: []string{"bob", "carol"}, Policy: "open"},
+		"members":  {Groupname: "members", Usernames: []string{"bob", "carol"}, Policy: "members", Moderators: []string{"bob"}},
+		"announce": {Groupname: "announce", Usernames: []string{"bob", "carol"}, Policy: "announce", Moderators: []string{"bob"}},
+	},
+}
+
+// Test scenario - Store messages for groups with each posting policy
+func (s *serviceTestSuite) testStoreMessageGroupPolicy(t *testing.T) {
+	ctx := context.TODO()
+
+	repository := new(MockedRepository)
+	repository.On("StoreMessage", ctx, mock.Anything).Return("id:01", nil)
+
+	service := NewService(repository, policyDirectory, "/foo")
+
+	cases := []struct {
+		sender  string
+		group   string
+		allowed bool
+	}{
+		{"dave", "open", true},
+		{"carol", "members", true},
+		{"dave", "members", false},
+		{"bob", "announce", true},
+		{"carol", "announce", false},
+		{"alice", "announce", true},
+	}
+
+	for _, c := range cases {
+		msg := Message{Sender: c.sender, Subject: "test", Body: "body", Recipient: Receiver{Groupname: c.group}}
+		_, err := service.StoreMessage(ctx, msg)
+		if c.allowed {
+			assert.NoError(t, err, "%s posting to %s", c.sender, c.group)
+		} else {
+			assert.Equal(t, ErrPostingNotPermitted, err, "%s posting to %s", c.sender, c.group)
+		}
+	}
+}
+
+// Test scenario - Store a message for lists of users and groups
+func (s *serviceTestSuite) testStoreMessageAddressees(t *testing.T) {
+	ctx := context.TODO()
+
+	rec := &Record{
+		Sender:     "dave",
+		Recipients: []string{"bob", "carol", "alice"},
+		To:         []Addressee{{Username: "bob"}, {Groupname: "open"}},
+		Cc:         []Addressee{{Username: "carol"}},
+		Bcc:        []Addressee{{Username: "alice"}},
+		Subject:    "test",
+		Body:       "body",
+	}
+
+	repository := new(MockedRepository)
+	repository.On("StoreMessage", ctx, rec).Return("id:01", nil)
+
+	service := NewService(repository, policyDirectory, "/foo")
+
+	msg := Message{
+		Sender:  "dave",
+		To:      []Receiver{{Username: "bob"}, {Groupname: "open"}},
+		Cc:      []Receiver{{Username: "carol"}},
+		Bcc:     []Receiver{{Username: "alice"}},
+		Subject: "test",
+		Body:    "body",
+	}
+
+	msgid, err := service.StoreMessage(ctx, msg)
+
+	assert.NoError(t, err)
+	repository.AssertExpectations(t)
+	assert.Equal(t, "id:01", msgid)
+
+	// each list is subject to posting policy of its groups
+	msg.Cc = []Receiver{{Groupname: "announce"}}
+	_, err = service.StoreMessage(ctx, msg)
+	assert.Equal(t, ErrPostingNotPermitted, err)
+
+	// a single recipient can not be given along with lists
+	msg.Cc = nil
+	msg.Recipient = Receiver{Username: "bob"}
+	_, err = service.StoreMessage(ctx, msg)
+	assert.Equal(t, ErrBadRequest, err)
+	repository.AssertNumberOfCalls(t, "StoreMessage", 1)
+}
+
+// Test scenario - Bcc addressees of a message are seen only by its sender
+func (s *serviceTestSuite) testGetMessageHidesBcc(t *testing.T) {
+	rec := Record{
+		Id:         "id:01",
+		Sender:     "dave",
+		Recipients: []string{"bob", "alice"},
+		To:         []Addressee{{Username: "bob"}},
+		Bcc:        []Addressee{{Username: "alice"}},
+		Subject:    "test",
+		Body:       "body",
+	}
+
+	repository := new(MockedRepository)
+	repository.On("GetMessage", mock.Anything, "id:01").Return(rec, nil)
+	repository.On("GetUserMessages", mock.Anything, "alice").Return([]Record{rec}, nil)
+
+	service := NewService(repository, policyDirectory, "/foo")
+
+	msg, err := service.GetMessage(middleware.NewAuthContext(context.TODO(), "dave", "token"), "id:01")
+	assert.NoError(t, err)
+	assert.Equal(t, []Receiver{{Username: "bob"}}, msg.To)
+	assert.Equal(t, []Receiver{{Username: "alice"}}, msg.Bcc)
+
+	msg, err = service.GetMessage(middleware.NewAuthContext(context.TODO(), "bob", "token"), "id:01")
+	assert.NoError(t, err)
+	assert.Equal(t, []Receiver{{Username: "bob"}}, msg.To)
+	assert.Nil(t, msg.Bcc)
+
+	msg, err = service.GetMessage(context.TODO(), "id:01")
+	assert.NoError(t, err)
+	assert.Nil(t, msg.Bcc)
+
+	msgs, err := service.GetMessages(context.TODO(), "alice")
+	assert.NoError(t, err)
+	assert.Nil(t, msgs[0].Bcc)
+	assert.Equal(t, Receiver{}, msgs[0].Recipient)
+}
+
+// Test scenario - Reply to a message of an announce only group
+func (s *serviceTestSuite) testStoreReplyGroupPolicy(t *testing.T) {
+	ctx := context.TODO()
+
+	original := Record{Id: "id:01", Sender: "bob", GroupId: "announce", Recipients: []string{"bob", "carol"}}
+
+	repository := new(MockedRepository)
+	repository.On("GetMessage", ctx, "id:01").Return(original, nil)
+
+	service := NewService(repository, policyDirectory, "/foo")
+
+	msg := Message{Sender: "carol", Re: "id:01", Subject: "re: test", Body: "body"}
+	_, err := service.StoreMessage(ctx, msg)
+
+	repository.AssertNotCalled(t, "StoreMessage", ctx, mock.Anything)
+	assert.Equal(t, ErrPostingNotPermitted, err)
+}
+
+// Test scenario - Store a message for a deactivated user
+func (s *serviceTestSuite) testStoreMessageRecipientDeactivated(t *testing.T) {
+	ctx := context.TODO()
+
+	repository := new(MockedRepository)
+
+	client := &MockedUsersSvcClient{map[string]api.UserDetails{
+		"tester": {Id: "tester"},
+		"user1":  {Id: "user1", Deactivated: true},
+	}}
+
+	service := NewService(repository, client, "/foo")
+
+	rcv := Receiver{Username: "user1"}
+	msg := Message{Sender: "tester", Subject: "test", Body: "body", Recipient: rcv}
+
+	_, err := service.StoreMessage(ctx, msg)
+	assert.Equal(t, ErrUserDeactivated, err)
+
+	msg = Message{Sender: "user1", Subject: "test", Body: "body", Recipient: Receiver{Username: "tester"}}
+
+	_, err = service.StoreMessage(ctx, msg)
+	assert.Equal(t, ErrUserDeactivated, err)
+
+	repository.AssertNotCalled(t, "StoreMessage", ctx, mock.Anything)
+}
+
+// Test scenario - Store a reply to a message from a deactivated user
+func (s *serviceTestSuite) testStoreReplyRecipientDeactivated(t *testing.T) {
+	ctx := context.TODO()
+
+	rec1 := Record{
+		Id:         "id:01",
+		Sender:     "tester",
+		Subject:    "test",
+		Body:       "body",
+		Recipients: []string{"user1"},
+	}
+
+	repository := new(MockedRepository)
+	repository.On("GetMessage", ctx, "id:01").Return(rec1, nil)
+
+	client := &MockedUsersSvcClient{map[string]api.UserDetails{
+		"tester": {Id: "tester", Deactivated: true},
+		"user1":  {Id: "user1"},
+	}}
+
+	service := NewService(repository, client, "/foo")
+
+	msg := Message{Re: "id:01", Sender: "user1", Subject: "re:test", Body: "body"}
+
+	_, err := service.StoreMessage(ctx, msg)
+
+	repository.AssertNotCalled(t, "StoreMessage", ctx, mock.Anything)
+	assert.Equal(t, ErrUserDeactivated, err)
+}
+
+// Test scenario - Store a reply in a group thread whose starter is no longer
+// active
+func (s *serviceTestSuite) testStoreReplyGroupSenderDeactivated(t *testing.T) {
+	ctx := context.TODO()
+
+	original := Record{Id: "id:01", Sender: "tester", GroupId: "testgroup", Recipients: []string{"user1", "user2", "user3"}}
+	reply := &Record{
+		ReplyToMsgId: "id:01",
+		Sender:       "user1",
+		Recipients:   []string{"user1", "user2"},
+		GroupId:      "testgroup",
+		Subject:      "re:test",
+		Body:         "body",
+	}
+
+	repository := new(MockedRepository)
+	repository.On("GetMessage", ctx, "id:01").Return(original, nil)
+	repository.On("StoreMessage", ctx, reply).Return("id:02", nil)
+
+	client := &MockedDirectorySvcClient{
+		users: map[string]api.UserDetails{
+			"tester": {Id: "tester", Deactivated: true},
+			"user1":  {Id: "user1"},
+			"user2":  {Id: "user2"},
+			"user3":  {Id: "user3", Deactivated: true},
+		},
+		groups: map[string]api.GroupDetails{
+			"testgroup": {Groupname: "testgroup", Usernames: []string{"user1", "user2", "user3"}},
+		},
+	}
+
+	service := NewService(repository, client, "/foo")
+
+	msg := Message{Re: "id:01", Sender: "user1", Subject: "re:test", Body: "body"}
+	msgid, err := service.StoreMessage(ctx, msg)
+
+	assert.NoError(t, err)
+	repository.AssertExpectations(t)
+	assert.Equal(t, "id:02", msgid)
+}
+
 // Test scenario - Store a reply message
 func (s *serviceTestSuite) testStoreReply(t *testing.T) {
 	ctx := context.TODO()
@@ -157,7 +588,7 @@ func (s *serviceTestSuite) testStoreReply(t *testing.T) {
 
 	service := NewService(repository, svcclient, "/foo")
 
-	msg := message{Re: "id:01", Sender: "user1", Subject: "re:test", Body: "body"}
+	msg := Message{Re: "id:01", Sender: "user1", Subject: "re:test", Body: "body"}
 
 	msgid, _ := service.StoreMessage(ctx, msg)
 
@@ -165,6 +596,57 @@ func (s *serviceTestSuite) testStoreReply(t *testing.T) {
 	assert.Equal(t, "id:02", msgid)
 }
 
+// Test scenario - Store messages and replies publishing events to users they concern
+func (s *serviceTestSuite) testStoreMessagePublishesEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	repository := NewInMemoryMessageRepository()
+	hub := NewEventHub(10)
+	service := NewService(repository, &MockedUserSvcClient{"user"}, "/foo", WithEventHub(hub))
+
+	subscribe := func(user string) <-chan Event {
+		events, err := service.SubscribeEvents(ctx, user, 0)
+		assert.NoError(t, err)
+		return events
+	}
+	alice, bob, carol, dave := subscribe("alice"), subscribe("bob"), subscribe("carol"), subscribe("dave")
+
+	rootid, err := service.StoreMessage(ctx, Message{Sender: "alice", Subject: "test", Body: "body",
+		To: []Receiver{{Username: "bob"}}, Bcc: []Receiver{{Username: "carol"}}})
+	assert.NoError(t, err)
+
+	ev := <-bob
+	assert.Equal(t, eventMessage, ev.Type)
+	assert.Equal(t, rootid, ev.Message.Id)
+	assert.True(t, ev.Message.Unread)
+	assert.Empty(t, ev.Message.Bcc)
+	assert.Equal(t, eventMessage, (<-carol).Type)
+
+	// sender is told about its own message, along with its bcc addressees
+	ev = <-alice
+	assert.Equal(t, eventMessage, ev.Type)
+	assert.False(t, ev.Message.Unread)
+	assert.NotEmpty(t, ev.Message.Bcc)
+
+	replyid, err := service.StoreMessage(ctx, Message{Re: rootid, Sender: "bob", Subject: "re:test", Body: "body"})
+	assert.NoError(t, err)
+
+	ev = <-alice
+	assert.Equal(t, eventReply, ev.Type)
+	assert.Equal(t, replyid, ev.Message.Id)
+	assert.True(t, ev.Message.Unread)
+
+	ev = <-bob
+	assert.Equal(t, eventReply, ev.Type)
+	assert.Equal(t, replyid, ev.Message.Id)
+	assert.False(t, ev.Message.Unread)
+
+	// carol takes part in the thread but the reply is not addressed to carol
+	assert.Len(t, carol, 0)
+	assert.Len(t, dave, 0)
+}
+
 // Test scenario - Get a message for given id
 func (s *serviceTestSuite) testGetMessageForId(t *testing.T) {
 	ctx, ts := context.TODO(), time.Now()
@@ -189,8 +671,8 @@ func (s *serviceTestSuite) testGetMessageForId(t *testing.T) {
 
 	repository.AssertExpectations(t)
 
-	recipient := receiver{Username: "user1"}
-	exp := message{
+	recipient := Receiver{Username: "user1"}
+	exp := Message{
 		Id:        "id:01",
 		Sender:    "tester",
 		Subject:   "test",
@@ -213,6 +695,7 @@ func (s *serviceTestSuite) testGetMessagesForUser(t *testing.T) {
 		Body:       "body1",
 		Recipients: []string{"user1"},
 		Timestamp:  ts1,
+		ReadBy:     []string{"user1"},
 	}
 	rec2 := Record{
 		Id:         "id:02",
@@ -253,51 +736,216 @@ func (s *serviceTestSuite) testGetMessagesForUser(t *testing.T) {
 
 	repository.AssertExpectations(t)
 
-	exp := message{
+	exp := Message{
 		Id:        "id:01",
 		Sender:    "tester1",
 		Subject:   "test1",
 		Body:      "body1",
-		Recipient: receiver{Username: "user1"},
+		Recipient: Receiver{Username: "user1"},
 		Timestamp: ts1.Format(time.RFC3339),
 	}
 
 	assert.Equal(t, msgs[0], exp)
 
-	exp = message{
+	exp = Message{
 		Id:        "id:02",
 		Sender:    "tester2",
 		Subject:   "test2",
 		Body:      "body2",
-		Recipient: receiver{Username: "user1"},
+		Recipient: Receiver{Username: "user1"},
 		Timestamp: ts2.Format(time.RFC3339),
+		Unread:    true,
 	}
 
 	assert.Equal(t, msgs[1], exp)
 
-	exp = message{
+	exp = Message{
 		Id:        "id:03",
 		Sender:    "tester3",
 		Subject:   "test3",
 		Body:      "body3",
-		Recipient: receiver{Groupname: "tstgroup"},
+		Recipient: Receiver{Groupname: "tstgroup"},
 		Timestamp: ts3.Format(time.RFC3339),
+		Unread:    true,
 	}
 
 	assert.Equal(t, msgs[2], exp)
-	exp = message{
+	exp = Message{
 		Id:        "id:04",
 		Re:        "id:03",
 		Sender:    "user2",
 		Subject:   "Re:test3",
 		Body:      "body3",
-		Recipient: receiver{Groupname: "tstgroup"},
+		Recipient: Receiver{Groupname: "tstgroup"},
 		Timestamp: ts4.Format(time.RFC3339),
+		Unread:    true,
 	}
 
 	assert.Equal(t, msgs[3], exp)
 }
 
+// Test scenario - Get a page of messages for user
+func (s *serviceTestSuite) testGetMessagesPageForUser(t *testing.T) {
+	ctx, ts := context.TODO(), time.Now()
+
+	rec := Record{
+		Id:         "id:02",
+		Sender:     "tester",
+		Subject:    "test",
+		Body:       "body",
+		Recipients: []string{"user1"},
+		Timestamp:  ts,
+	}
+
+	query := MailboxQuery{Limit: 1, Cursor: "cursor:01"}
+
+	repository := new(MockedRepository)
+	repository.On("GetUserMessagesPage", ctx, "user1", query).Return([]Record{rec}, "cursor:02", nil)
+
+	svcclient := &MockedUserSvcClient{"user"}
+
+	service := NewService(repository, svcclient, "/foo")
+
+	msgs, next, err := service.GetMessagesPage(ctx, "user1", query)
+
+	repository.AssertExpectations(t)
+
+	exp := Message{
+		Id:        "id:02",
+		Sender:    "tester",
+		Subject:   "test",
+		Body:      "body",
+		Recipient: Receiver{Username: "user1"},
+		Timestamp: ts.Format(time.RFC3339),
+		Unread:    true,
+	}
+
+	assert.NoError(t, err)
+	assert.Equal(t, []Message{exp}, msgs)
+	assert.Equal(t, "cursor:02", next)
+}
+
+// Test scenario - Get a page of messages sent by user, including bcc addressees
+func (s *serviceTestSuite) testGetSentMessages(t *testing.T) {
+	ctx, ts := context.TODO(), time.Now()
+
+	rec := Record{
+		Id:         "id:02",
+		Sender:     "user1",
+		Subject:    "test",
+		Body:       "body",
+		Recipients: []string{"bob", "carol"},
+		To:         []Addressee{{Username: "bob"}},
+		Bcc:        []Addressee{{Username: "carol"}},
+		Timestamp:  ts,
+	}
+
+	query := MailboxQuery{Limit: 1, Cursor: "cursor:01"}
+
+	repository := new(MockedRepository)
+	repository.On("GetSentMessagesPage", ctx, "user1", query).Return([]Record{rec}, "cursor:02", nil)
+
+	svcclient := &MockedUserSvcClient{"user"}
+
+	service := NewService(repository, svcclient, "/foo")
+
+	msgs, next, err := service.GetSentMessages(ctx, "user1", query)
+
+	repository.AssertExpectations(t)
+
+	exp := Message{
+		Id:        "id:02",
+		Sender:    "user1",
+		Subject:   "test",
+		Body:      "body",
+		To:        []Receiver{{Username: "bob"}},
+		Bcc:       []Receiver{{Username: "carol"}},
+		Timestamp: ts.Format(time.RFC3339),
+	}
+
+	assert.NoError(t, err)
+	assert.Equal(t, []Message{exp}, msgs)
+	assert.Equal(t, "cursor:02", next)
+}
+
+// Test scenario - Search messages of user with highlights of matching words
+func (s *serviceTestSuite) testSearchMessages(t *testing.T) {
+	ctx, ts := context.TODO(), time.Now()
+
+	rec := Record{
+		Id:         "id:02",
+		Sender:     "tester",
+		Subject:    "Lunch plans",
+		Body:       "Planning lunch, café at noon?",
+		Recipients: []string{"user1"},
+		ReadBy:     []string{"user1"},
+		Timestamp:  ts,
+	}
+
+	query := SearchQuery{Text: "lunch PLAN", Limit: 10}
+
+	repository := new(MockedRepository)
+	repository.On("SearchUserMessages", ctx, "user1", query).Return([]SearchResult{{rec, 1.5}}, nil)
+
+	svcclient := &MockedUserSvcClient{"user"}
+
+	service := NewService(repository, svcclient, "/foo")
+
+	results, err := service.SearchMessages(ctx, "user1", query)
+
+	repository.AssertExpectations(t)
+
+	exp := SearchMatch{
+		Message: Message{
+			Id:        "id:02",
+			Sender:    "tester",
+			Subject:   "Lunch plans",
+			Body:      "Planning lunch, café at noon?",
+			Recipient: Receiver{Username: "user1"},
+			Timestamp: ts.Format(time.RFC3339),
+		},
+		Score: 1.5,
+		Highlights: []Highlight{
+			{"subject", 0, 5},
+			{"subject", 6, 11},
+			{"body", 0, 8},
+			{"body", 9, 14},
+		},
+	}
+
+	assert.NoError(t, err)
+	assert.Equal(t, []SearchMatch{exp}, results)
+
+	// messages found among those sent by the user are never unread
+	rec.ReadBy = nil
+	repository.On("SearchUserMessages", ctx, "tester", query).Return([]SearchResult{{rec, 1.5}}, nil)
+
+	results, err = service.SearchMessages(ctx, "tester", query)
+
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+	assert.False(t, results[0].Unread)
+}
+
+// Test scenario - Get a page of messages with a cursor that can not be decoded
+func (s *serviceTestSuite) testGetMessagesPageInvalidCursor(t *testing.T) {
+	ctx := context.TODO()
+
+	query := MailboxQuery{Limit: 1, Cursor: "bogus"}
+
+	repository := new(MockedRepository)
+	repository.On("GetUserMessagesPage", ctx, "user1", query).Return([]Record(nil), "", errInvalidCursor)
+
+	svcclient := &MockedUserSvcClient{"user"}
+
+	service := NewService(repository, svcclient, "/foo")
+
+	_, _, err := service.GetMessagesPage(ctx, "user1", query)
+
+	repository.AssertExpectations(t)
+	assert.Equal(t, ErrBadRequest, err)
+}
+
 // Test scenario - Get reply messages
 func (s *serviceTestSuite) testGetReplyMessages(t *testing.T) {
 	ctx, ts1, ts2 := context.TODO(), time.Now(), time.Now()
@@ -340,28 +988,252 @@ func (s *serviceTestSuite) testGetReplyMessages(t *testing.T) {
 
 	repository.AssertExpectations(t)
 
-	exp := message{
+	exp := Message{
 		Id:        "id:01",
 		Re:        "idtest",
 		Sender:    "user1",
 		Subject:   "re:test",
 		Body:      "body1",
-		Recipient: receiver{Username: "user2"},
+		Recipient: Receiver{Username: "user2"},
 		Timestamp: ts1.Format(time.RFC3339),
 	}
 
 	assert.Equal(t, msgs[0], exp)
 
-	exp = message{
+	exp = Message{
 		Id:        "id:02",
 		Re:        "idtest",
 		Sender:    "user1",
 		Subject:   "re:re:test",
 		Body:      "body2",
-		Recipient: receiver{Username: "user2"},
+		Recipient: Receiver{Username: "user2"},
 		Timestamp: ts1.Format(time.RFC3339),
 	}
 
 	assert.Equal(t, msgs[1], exp)
 
 }
+
+// Test scenario - Mark a message as read
+func (s *serviceTestSuite) testMarkRead(t *testing.T) {
+	ctx := context.TODO()
+
+	repository := new(MockedRepository)
+	repository.On("SetRecipientFlag", ctx, "id:01", "user1", FlagRead, true).Return(nil)
+
+	svcclient := &MockedUserSvcClient{"user"}
+
+	service := NewService(repository, svcclient, "/foo")
+
+	err := service.MarkRead(ctx, "user1", "id:01")
+
+	repository.AssertExpectations(t)
+	assert.NoError(t, err)
+}
+
+// Test scenario - Mark a message as unread for a user who is not its recipient
+func (s *serviceTestSuite) testMarkUnreadNotRecipient(t *testing.T) {
+	ctx := context.TODO()
+
+	repository := new(MockedRepository)
+	repository.On("SetRecipientFlag", ctx, "id:01", "user2", FlagRead, false).Return(errNoDocuments)
+
+	svcclient := &MockedUserSvcClient{"user"}
+
+	service := NewService(repository, svcclient, "/foo")
+
+	err := service.MarkUnread(ctx, "user2", "id:01")
+
+	repository.AssertExpectations(t)
+	assert.Equal(t, ErrMsgNotFound, err)
+}
+
+// Test scenario - Get number of unread messages
+func (s *serviceTestSuite) testGetUnreadCount(t *testing.T) {
+	ctx := context.TODO()
+
+	repository := new(MockedRepository)
+	repository.On("CountUnreadMessages", ctx, "user1").Return(int64(3), nil)
+
+	svcclient := &MockedUserSvcClient{"user"}
+
+	service := NewService(repository, svcclient, "/foo")
+
+	count, err := service.GetUnreadCount(ctx, "user1")
+
+	repository.AssertExpectations(t)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), count)
+}
+
+// Test scenario - Delete a message from mailbox
+func (s *serviceTestSuite) testDeleteMessage(t *testing.T) {
+	ctx := context.TODO()
+
+	repository := new(MockedRepository)
+	repository.On("SetRecipientFlag", ctx, "id:01", "user1", FlagDeleted, true).Return(nil)
+
+	svcclient := &MockedUserSvcClient{"user"}
+
+	service := NewService(repository, svcclient, "/foo")
+
+	err := service.DeleteMessage(ctx, "user1", "id:01")
+
+	repository.AssertExpectations(t)
+	assert.NoError(t, err)
+}
+
+// Test scenario - Archive a message and move it back to mailbox
+func (s *serviceTestSuite) testArchiveMessage(t *testing.T) {
+	ctx := context.TODO()
+
+	repository := new(MockedRepository)
+	repository.On("SetRecipientFlag", ctx, "id:01", "user1", FlagArchived, true).Return(nil)
+	repository.On("SetRecipientFlag", ctx, "id:01", "user1", FlagArchived, false).Return(nil)
+
+	svcclient := &MockedUserSvcClient{"user"}
+
+	service := NewService(repository, svcclient, "/foo")
+
+	assert.NoError(t, service.ArchiveMessage(ctx, "user1", "id:01"))
+	assert.NoError(t, service.UnarchiveMessage(ctx, "user1", "id:01"))
+
+	repository.AssertExpectations(t)
+}
+
+// Test scenario - Get conversation tree of a reply message
+func (s *serviceTestSuite) testGetThread(t *testing.T) {
+	ctx, ts := context.TODO(), time.Now()
+
+	rec0 := Record{
+		Id:         "id:00",
+		Sender:     "user1",
+		Subject:    "test",
+		Body:       "body",
+		Recipients: []string{"user2"},
+		Timestamp:  ts,
+	}
+	rec1 := Record{
+		Id:           "id:01",
+		ReplyToMsgId: "id:00",
+		Sender:       "user2",
+		Subject:      "re:test",
+		Body:         "body1",
+		Recipients:   []string{"user1"},
+		Timestamp:    ts.Add(2 * time.Second),
+	}
+	rec2 := Record{
+		Id:           "id:02",
+		ReplyToMsgId: "id:00",
+		Sender:       "user2",
+		Subject:      "re:test",
+		Body:         "body2",
+		Recipients:   []string{"user1"},
+		Timestamp:    ts.Add(time.Second),
+	}
+	rec3 := Record{
+		Id:           "id:03",
+		ReplyToMsgId: "id:01",
+		Sender:       "user1",
+		Subject:      "re:re:test",
+		Body:         "body3",
+		Recipients:   []string{"user2"},
+		Timestamp:    ts.Add(3 * time.Second),
+	}
+
+	repository := new(MockedRepository)
+	repository.On("GetMessage", ctx, "id:03").Return(rec3, nil)
+	repository.On("GetMessage", ctx, "id:01").Return(rec1, nil)
+	repository.On("GetMessage", ctx, "id:00").Return(rec0, nil)
+	repository.On("GetThreadMessages", ctx, "id:00").Return([]Record{rec1, rec2, rec3}, nil)
+
+	svcclient := &MockedUserSvcClient{"user"}
+
+	service := NewService(repository, svcclient, "/foo")
+
+	root, err := service.GetThread(ctx, "id:03")
+
+	repository.AssertExpectations(t)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "id:00", root.Id)
+	assert.Equal(t, 0, root.Depth)
+	assert.Equal(t, 2, len(root.Replies))
+
+	// replies are ordered by timestamp
+	assert.Equal(t, "id:02", root.Replies[0].Id)
+	assert.Equal(t, 0, len(root.Replies[0].Replies))
+	assert.Equal(t, "id:01", root.Replies[1].Id)
+	assert.Equal(t, 1, root.Replies[1].Depth)
+	assert.Equal(t, 1, len(root.Replies[1].Replies))
+	assert.Equal(t, "id:03", root.Replies[1].Replies[0].Id)
+	assert.Equal(t, 2, root.Replies[1].Replies[0].Depth)
+}
+
+// Test scenario - Access mailbox of another user
+func (s *serviceTestSuite) testGetMessagesForbidden(t *testing.T) {
+	ctx := middleware.NewAuthContext(context.TODO(), "alice", "token")
+
+	repository := new(MockedRepository)
+
+	service := NewService(repository, &MockedUserSvcClient{"user"}, "/foo")
+
+	_, err := service.GetMessages(ctx, "bob")
+	assert.Equal(t, ErrForbidden, err)
+
+	_, _, err = service.GetMessagesPage(ctx, "bob", MailboxQuery{Limit: 10})
+	assert.Equal(t, ErrForbidden, err)
+
+	_, err = service.GetUnreadCount(ctx, "bob")
+	assert.Equal(t, ErrForbidden, err)
+
+	err = service.MarkRead(ctx, "bob", "id:01")
+	assert.Equal(t, ErrForbidden, err)
+
+	assert.Empty(t, repository.Calls)
+}
+
+// Test scenario - Messages are seen only by their sender and recipients
+func (s *serviceTestSuite) testGetMessageNotViewer(t *testing.T) {
+	ctx := context.TODO()
+
+	service := NewService(NewInMemoryMessageRepository(), &MockedUserSvcClient{"user"}, "/foo")
+
+	rootid, err := service.StoreMessage(ctx, Message{Sender: "alice", Subject: "test", Body: "body",
+		To: []Receiver{{Username: "bob"}, {Username: "carol"}}})
+	assert.NoError(t, err)
+	// reply reaches alice only
+	replyid, err := service.StoreMessage(ctx, Message{Re: rootid, Sender: "bob", Subject: "re:test", Body: "secret"})
+	assert.NoError(t, err)
+
+	dave := middleware.NewAuthContext(ctx, "dave", "token")
+	_, err = service.GetMessage(dave, rootid)
+	assert.Equal(t, ErrForbidden, err)
+	_, err = service.GetReplies(dave, rootid)
+	assert.Equal(t, ErrForbidden, err)
+	_, err = service.GetThread(dave, replyid)
+	assert.Equal(t, ErrForbidden, err)
+
+	carol := middleware.NewAuthContext(ctx, "carol", "token")
+	_, err = service.GetMessage(carol, replyid)
+	assert.Equal(t, ErrForbidden, err)
+
+	replies, err := service.GetReplies(carol, rootid)
+	assert.NoError(t, err)
+	assert.Empty(t, replies)
+
+	// reply is shown by its id only in the thread
+	thread, err := service.GetThread(carol, rootid)
+	assert.NoError(t, err)
+	assert.Equal(t, "body", thread.Body)
+	assert.Equal(t, 1, len(thread.Replies))
+	assert.Equal(t, replyid, thread.Replies[0].Id)
+	assert.Empty(t, thread.Replies[0].Body)
+	assert.Empty(t, thread.Replies[0].Sender)
+
+	alice := middleware.NewAuthContext(ctx, "alice", "token")
+	replies, err = service.GetReplies(alice, rootid)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(replies))
+	assert.Equal(t, "secret", replies[0].Body)
+}
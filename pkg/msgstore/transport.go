@@ -3,7 +3,11 @@ package msgstore
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 
@@ -61,6 +65,78 @@ func MakeHandler(service Service, logger kitlog.Logger) http.Handler {
 
 	r.Handle("/users/{userid}/mailbox", getUserMessagesHandler).Methods("GET")
 
+	searchMessagesHandler := kithttp.NewServer(
+		makeSearchMessagesEndpoint(service),
+		decodeSearchMessagesRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	r.Handle("/users/{userid}/mailbox/search", searchMessagesHandler).Methods("GET")
+
+	getSentMessagesHandler := kithttp.NewServer(
+		makeQuerySentMessagesEndpoint(service),
+		decodeSentMessagesQueryRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	r.Handle("/users/{userid}/sent", getSentMessagesHandler).Methods("GET")
+
+	markReadHandler := kithttp.NewServer(
+		makeMarkReadEndpoint(service),
+		decodeMailboxMessageRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	r.Handle("/users/{userid}/mailbox/{msgid}/read", markReadHandler).Methods("POST")
+
+	markUnreadHandler := kithttp.NewServer(
+		makeMarkUnreadEndpoint(service),
+		decodeMailboxMessageRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	r.Handle("/users/{userid}/mailbox/{msgid}/unread", markUnreadHandler).Methods("POST")
+
+	archiveHandler := kithttp.NewServer(
+		makeArchiveEndpoint(service),
+		decodeMailboxMessageRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	r.Handle("/users/{userid}/mailbox/{msgid}/archive", archiveHandler).Methods("POST")
+
+	unarchiveHandler := kithttp.NewServer(
+		makeUnarchiveEndpoint(service),
+		decodeMailboxMessageRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	r.Handle("/users/{userid}/mailbox/{msgid}/unarchive", unarchiveHandler).Methods("POST")
+
+	deleteHandler := kithttp.NewServer(
+		makeDeleteEndpoint(service),
+		decodeMailboxMessageRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	r.Handle("/users/{userid}/mailbox/{msgid}", deleteHandler).Methods("DELETE")
+
+	getUnreadCountHandler := kithttp.NewServer(
+		makeQueryUnreadCountEndpoint(service),
+		decodeUnreadCountQueryRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	r.Handle("/users/{userid}/mailbox/unread-count", getUnreadCountHandler).Methods("GET")
+
 	getRepliesHandler := kithttp.NewServer(
 		makeQueryReplyEndpoint(service),
 		decodeReplyQueryRequest,
@@ -70,22 +146,100 @@ func MakeHandler(service Service, logger kitlog.Logger) http.Handler {
 
 	r.Handle("/messages/{msgid}/replies", getRepliesHandler).Methods("GET")
 
+	getThreadHandler := kithttp.NewServer(
+		makeQueryThreadEndpoint(service),
+		decodeThreadQueryRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	r.Handle("/messages/{msgid}/thread", getThreadHandler).Methods("GET")
+
+	r.Handle("/users/{userid}/events", &eventsHandler{service, eventsKeepAlive}).Methods("GET")
+
+	r.Handle("/users/{userid}/ws", newWebsocketHandler(service, eventsKeepAlive)).Methods("GET")
+
+	return middleware.NewHTTPInterceptor(r, logger)
+}
+
+// Make handler to invalidate lookups held in given cache
+func MakeLookupCacheHandler(cache *LookupCache, logger kitlog.Logger) http.Handler {
+
+	r := mux.NewRouter()
+
+	opts := []kithttp.ServerOption{
+		kithttp.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
+		kithttp.ServerErrorEncoder(encodeError),
+	}
+
+	invalidateHandler := kithttp.NewServer(
+		makeInvalidateLookupEndpoint(cache),
+		decodeInvalidateLookupRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	r.Handle("/lookups", invalidateHandler).Methods("DELETE")
+	r.Handle("/lookups/users/{userid}", invalidateHandler).Methods("DELETE")
+	r.Handle("/lookups/groups/{groupid}", invalidateHandler).Methods("DELETE")
+
 	return middleware.NewHTTPInterceptor(r, logger)
 }
 
-type receiver struct {
+const (
+	// number of messages in a mailbox page when client does not specify limit
+	defaultPageLimit = 50
+	// maximum number of messages in a mailbox page
+	maxPageLimit = 500
+	// maximum number of users and groups a message is addressed to
+	maxAddressees = 100
+	// interval of comments sent to keep idle event streams open
+	eventsKeepAlive = 30 * time.Second
+)
+
+// Receiver of a message, naming either a user or a group
+type Receiver struct {
 	Groupname string `json:"groupname,omitempty"`
 	Username  string `json:"username,omitempty"`
 }
 
-type message struct {
-	Id        string   `json:"id"`
-	Re        string   `json:"re,omitempty"`
-	Sender    string   `json:"sender"`
-	Recipient receiver `json:"recipient"`
-	Subject   string   `json:"subject"`
-	Body      string   `json:"body"`
-	Timestamp string   `json:"sentAt"`
+// Message as sent by a user and as seen by its sender and recipients
+type Message struct {
+	Id         string     `json:"id"`
+	Re         string     `json:"re,omitempty"`
+	Sender     string     `json:"sender"`
+	SenderName string     `json:"senderName,omitempty"`
+	Recipient  Receiver   `json:"recipient"`
+	To         []Receiver `json:"to,omitempty"`
+	Cc         []Receiver `json:"cc,omitempty"`
+	Bcc        []Receiver `json:"bcc,omitempty"`
+	Subject    string     `json:"subject"`
+	Body       string     `json:"body"`
+	Timestamp  string     `json:"sentAt"`
+	Unread     bool       `json:"unread,omitempty"`
+}
+
+// Thread holds a message in a conversation tree along with replies to it
+type Thread struct {
+	Message
+	Depth   int      `json:"depth"`
+	Replies []Thread `json:"replies"`
+}
+
+// SearchMatch holds a message matching a search along with its relevance and
+// the words that match
+type SearchMatch struct {
+	Message
+	Score      float64     `json:"score"`
+	Highlights []Highlight `json:"highlights"`
+}
+
+// Highlight is the position of a matching word in a field of message, counted
+// in characters from start of the field with end exclusive
+type Highlight struct {
+	Field string `json:"field"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
 }
 
 type contentHolder interface {
@@ -93,7 +247,7 @@ type contentHolder interface {
 }
 
 type messageCreateRequest struct {
-	Content message
+	Content Message
 }
 
 type messageCreateResponse struct {
@@ -105,7 +259,7 @@ func (m *messageCreateResponse) StatusCode() int {
 }
 
 type replyCreateRequest struct {
-	Content message
+	Content Message
 }
 
 type replyCreateResponse struct {
@@ -121,7 +275,7 @@ type messageForIdQueryRequest struct {
 }
 
 type messageForIdQueryResponse struct {
-	Content message
+	Content Message
 }
 
 func (m *messageForIdQueryResponse) StatusCode() int {
@@ -134,10 +288,12 @@ func (m *messageForIdQueryResponse) body() interface{} {
 
 type messagesForUserQueryRequest struct {
 	Username string
+	Paged    bool         // true for http requests, grpc requests get the whole mailbox
+	Query    MailboxQuery // page selection if request is paged
 }
 
 type messagesForUserQueryResponse struct {
-	Content []message
+	Content []Message
 }
 
 func (m *messagesForUserQueryResponse) StatusCode() int {
@@ -148,12 +304,73 @@ func (m *messagesForUserQueryResponse) body() interface{} {
 	return m.Content
 }
 
+type messagesPageResponse struct {
+	Messages   []Message `json:"messages"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+func (m *messagesPageResponse) StatusCode() int {
+	return http.StatusOK
+}
+
+type sentMessagesQueryRequest struct {
+	Username string
+	Query    MailboxQuery // page selection, only limit and cursor apply
+}
+
+type searchMessagesRequest struct {
+	Username string
+	Query    SearchQuery
+}
+
+type searchMessagesResponse struct {
+	Results []SearchMatch `json:"results"`
+}
+
+func (m *searchMessagesResponse) StatusCode() int {
+	return http.StatusOK
+}
+
+type mailboxMessageRequest struct {
+	Username string
+	Id       string
+}
+
+type mailboxUpdateResponse struct{}
+
+func (m *mailboxUpdateResponse) StatusCode() int {
+	return http.StatusNoContent
+}
+
+type invalidateLookupRequest struct {
+	Userid  string
+	Groupid string
+}
+
+type invalidateLookupResponse struct{}
+
+func (m *invalidateLookupResponse) StatusCode() int {
+	return http.StatusNoContent
+}
+
+type unreadCountQueryRequest struct {
+	Username string
+}
+
+type unreadCountQueryResponse struct {
+	Unread int64 `json:"unread"`
+}
+
+func (m *unreadCountQueryResponse) StatusCode() int {
+	return http.StatusOK
+}
+
 type replyQueryRequest struct {
 	Id string
 }
 
 type replyQueryResponse struct {
-	Content []message
+	Content []Message
 }
 
 func (m *replyQueryResponse) StatusCode() int {
@@ -164,6 +381,22 @@ func (m *replyQueryResponse) body() interface{} {
 	return m.Content
 }
 
+type threadQueryRequest struct {
+	Id string
+}
+
+type threadQueryResponse struct {
+	Content Thread
+}
+
+func (m *threadQueryResponse) StatusCode() int {
+	return http.StatusOK
+}
+
+func (m *threadQueryResponse) body() interface{} {
+	return m.Content
+}
+
 func makeCreateMessageEndpoint(s Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		req := request.(messageCreateRequest)
@@ -191,11 +424,94 @@ func makeQueryMessageForIdEndpoint(s Service) endpoint.Endpoint {
 func makeQueryMessagesForUserEndpoint(s Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		req := request.(messagesForUserQueryRequest)
+		if req.Paged {
+			msgs, next, err := s.GetMessagesPage(ctx, req.Username, req.Query)
+			return &messagesPageResponse{msgs, next}, err
+		}
 		msgs, err := s.GetMessages(ctx, req.Username)
 		return &messagesForUserQueryResponse{msgs}, err
 	}
 }
 
+func makeQuerySentMessagesEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(sentMessagesQueryRequest)
+		msgs, next, err := s.GetSentMessages(ctx, req.Username, req.Query)
+		return &messagesPageResponse{msgs, next}, err
+	}
+}
+
+func makeSearchMessagesEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(searchMessagesRequest)
+		results, err := s.SearchMessages(ctx, req.Username, req.Query)
+		return &searchMessagesResponse{results}, err
+	}
+}
+
+func makeMarkReadEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(mailboxMessageRequest)
+		err := s.MarkRead(ctx, req.Username, req.Id)
+		return &mailboxUpdateResponse{}, err
+	}
+}
+
+func makeMarkUnreadEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(mailboxMessageRequest)
+		err := s.MarkUnread(ctx, req.Username, req.Id)
+		return &mailboxUpdateResponse{}, err
+	}
+}
+
+func makeArchiveEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(mailboxMessageRequest)
+		err := s.ArchiveMessage(ctx, req.Username, req.Id)
+		return &mailboxUpdateResponse{}, err
+	}
+}
+
+func makeUnarchiveEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(mailboxMessageRequest)
+		err := s.UnarchiveMessage(ctx, req.Username, req.Id)
+		return &mailboxUpdateResponse{}, err
+	}
+}
+
+func makeDeleteEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(mailboxMessageRequest)
+		err := s.DeleteMessage(ctx, req.Username, req.Id)
+		return &mailboxUpdateResponse{}, err
+	}
+}
+
+func makeInvalidateLookupEndpoint(cache *LookupCache) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(invalidateLookupRequest)
+		switch {
+		case len(req.Userid) > 0:
+			cache.InvalidateUser(req.Userid)
+		case len(req.Groupid) > 0:
+			cache.InvalidateGroup(req.Groupid)
+		default:
+			cache.InvalidateAll()
+		}
+		return &invalidateLookupResponse{}, nil
+	}
+}
+
+func makeQueryUnreadCountEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(unreadCountQueryRequest)
+		count, err := s.GetUnreadCount(ctx, req.Username)
+		return &unreadCountQueryResponse{count}, err
+	}
+}
+
 func makeQueryReplyEndpoint(s Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		req := request.(replyQueryRequest)
@@ -204,7 +520,15 @@ func makeQueryReplyEndpoint(s Service) endpoint.Endpoint {
 	}
 }
 
-func decodeMessageCreateRequest(_ context.Context, r *http.Request) (interface{}, error) {
+func makeQueryThreadEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(threadQueryRequest)
+		t, err := s.GetThread(ctx, req.Id)
+		return &threadQueryResponse{t}, err
+	}
+}
+
+func decodeMessageCreateRequest(ctx context.Context, r *http.Request) (interface{}, error) {
 
 	mcRequest := messageCreateRequest{}
 
@@ -214,11 +538,12 @@ func decodeMessageCreateRequest(_ context.Context, r *http.Request) (interface{}
 
 	msg := &mcRequest.Content
 
-	if msg.Recipient.Groupname == "" && msg.Recipient.Username == "" {
-		return nil, ErrBadRequest
+	// Authenticated requests are always sent by the subject of their token
+	if subject, ok := middleware.Subject(ctx); ok {
+		msg.Sender = subject
 	}
 
-	if msg.Sender == "" || msg.Subject == "" || msg.Body == "" {
+	if !validMessage(msg) {
 		return nil, ErrBadRequest
 	}
 
@@ -226,6 +551,36 @@ func decodeMessageCreateRequest(_ context.Context, r *http.Request) (interface{}
 
 }
 
+// Check that a new message has sender, subject and body and is addressed
+// properly.
+func validMessage(msg *Message) bool {
+	if msg.Sender == "" || msg.Subject == "" || msg.Body == "" {
+		return false
+	}
+	return validAddressees(msg)
+}
+
+// Check that message has either a single recipient or up to maxAddressees
+// users and groups in its to, cc and bcc lists, each naming either a user or a
+// group.
+func validAddressees(msg *Message) bool {
+	lists := len(msg.To) + len(msg.Cc) + len(msg.Bcc)
+	if msg.Recipient.Groupname != "" || msg.Recipient.Username != "" {
+		return lists == 0
+	}
+	if lists == 0 || lists > maxAddressees {
+		return false
+	}
+	for _, list := range [][]Receiver{msg.To, msg.Cc, msg.Bcc} {
+		for _, rcv := range list {
+			if (rcv.Groupname == "") == (rcv.Username == "") {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 func decodeReplyCreateRequest(ctx context.Context, r *http.Request) (interface{}, error) {
 
 	rcRequest := replyCreateRequest{}
@@ -236,11 +591,11 @@ func decodeReplyCreateRequest(ctx context.Context, r *http.Request) (interface{}
 
 	msg := &rcRequest.Content
 
-	if msg.Sender == "" || msg.Subject == "" || msg.Body == "" {
-		return nil, ErrBadRequest
+	if subject, ok := middleware.Subject(ctx); ok {
+		msg.Sender = subject
 	}
 
-	if len(msg.Recipient.Groupname) > 0 || len(msg.Recipient.Username) > 0 {
+	if !validReply(msg) {
 		return nil, ErrBadRequest
 	}
 
@@ -250,6 +605,15 @@ func decodeReplyCreateRequest(ctx context.Context, r *http.Request) (interface{}
 
 }
 
+// Check that a reply has sender, subject and body and no recipient, which is
+// derived from the original message.
+func validReply(msg *Message) bool {
+	if msg.Sender == "" || msg.Subject == "" || msg.Body == "" {
+		return false
+	}
+	return len(msg.Recipient.Groupname) == 0 && len(msg.Recipient.Username) == 0
+}
+
 func decodeMessageForIdQueryRequest(_ context.Context, r *http.Request) (interface{}, error) {
 	msgid := mux.Vars(r)["msgid"]
 	mqRequest := messageForIdQueryRequest{msgid}
@@ -258,16 +622,141 @@ func decodeMessageForIdQueryRequest(_ context.Context, r *http.Request) (interfa
 
 func decodeMessagesForUserQueryRequest(_ context.Context, r *http.Request) (interface{}, error) {
 	userid := mux.Vars(r)["userid"]
-	mqRequest := messagesForUserQueryRequest{userid}
+	// Mailbox is always returned in pages, so that a large mailbox is never
+	// returned at once
+	mqRequest := messagesForUserQueryRequest{Username: userid, Paged: true}
+
+	params := r.URL.Query()
+	if err := decodePageParams(params, &mqRequest.Query); err != nil {
+		return nil, err
+	}
+	if err := decodeBoolParam(params, "unread", &mqRequest.Query.Unread); err != nil {
+		return nil, err
+	}
+	if err := decodeBoolParam(params, "archived", &mqRequest.Query.Archived); err != nil {
+		return nil, err
+	}
+	mqRequest.Query.From = params.Get("from")
+	mqRequest.Query.Group = params.Get("group")
+	if err := decodeTimeParam(params, "since", &mqRequest.Query.Since); err != nil {
+		return nil, err
+	}
+	if err := decodeTimeParam(params, "until", &mqRequest.Query.Until); err != nil {
+		return nil, err
+	}
+	if err := decodeBoolParam(params, "replies_only", &mqRequest.Query.RepliesOnly); err != nil {
+		return nil, err
+	}
+	if err := decodeBoolParam(params, "roots_only", &mqRequest.Query.RootsOnly); err != nil {
+		return nil, err
+	}
+	if mqRequest.Query.RepliesOnly && mqRequest.Query.RootsOnly {
+		return nil, ErrBadRequest
+	}
+
 	return mqRequest, nil
 }
 
+func decodeSentMessagesQueryRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	userid := mux.Vars(r)["userid"]
+	sqRequest := sentMessagesQueryRequest{Username: userid}
+	if err := decodePageParams(r.URL.Query(), &sqRequest.Query); err != nil {
+		return nil, err
+	}
+	return sqRequest, nil
+}
+
+func decodeSearchMessagesRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	userid := mux.Vars(r)["userid"]
+	params := r.URL.Query()
+	smRequest := searchMessagesRequest{Username: userid}
+	smRequest.Query.Text = params.Get("q")
+	if len(searchTerms(smRequest.Query.Text)) == 0 {
+		return nil, ErrBadRequest
+	}
+	smRequest.Query.Limit = defaultPageLimit
+	if limit := params.Get("limit"); len(limit) > 0 {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 || n > maxPageLimit {
+			return nil, ErrBadRequest
+		}
+		smRequest.Query.Limit = n
+	}
+	return smRequest, nil
+}
+
+// Decode optional limit and cursor query parameters into given query
+func decodePageParams(params url.Values, query *MailboxQuery) error {
+	query.Limit = defaultPageLimit
+	if limit := params.Get("limit"); len(limit) > 0 {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 || n > maxPageLimit {
+			return ErrBadRequest
+		}
+		query.Limit = n
+	}
+	query.Cursor = params.Get("cursor")
+	return nil
+}
+
+// Decode optional boolean query parameter into given value
+func decodeBoolParam(params url.Values, name string, value *bool) error {
+	param := params.Get(name)
+	if len(param) == 0 {
+		return nil
+	}
+	b, err := strconv.ParseBool(param)
+	if err != nil {
+		return ErrBadRequest
+	}
+	*value = b
+	return nil
+}
+
+// Decode optional RFC 3339 time query parameter into given value
+func decodeTimeParam(params url.Values, name string, value *time.Time) error {
+	param := params.Get(name)
+	if len(param) == 0 {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, param)
+	if err != nil {
+		return ErrBadRequest
+	}
+	*value = t
+	return nil
+}
+
+func decodeMailboxMessageRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	vars := mux.Vars(r)
+	mmRequest := mailboxMessageRequest{vars["userid"], vars["msgid"]}
+	return mmRequest, nil
+}
+
+func decodeInvalidateLookupRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	vars := mux.Vars(r)
+	ilRequest := invalidateLookupRequest{vars["userid"], vars["groupid"]}
+	return ilRequest, nil
+}
+
+func decodeUnreadCountQueryRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	userid := mux.Vars(r)["userid"]
+	ucRequest := unreadCountQueryRequest{userid}
+	return ucRequest, nil
+}
+
 func decodeReplyQueryRequest(_ context.Context, r *http.Request) (interface{}, error) {
 	msgid := mux.Vars(r)["msgid"]
 	rqRequest := replyQueryRequest{msgid}
 	return rqRequest, nil
 }
 
+func decodeThreadQueryRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	msgid := mux.Vars(r)["msgid"]
+	tqRequest := threadQueryRequest{msgid}
+	return tqRequest, nil
+}
+
 // encode response
 func encodeResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
 	if e, ok := response.(errorer); ok && e.error() != nil {
@@ -289,6 +778,69 @@ func encodeResponse(ctx context.Context, w http.ResponseWriter, response interfa
 	return json.NewEncoder(w).Encode(response)
 }
 
+// Handler streaming events of a user as server-sent events. A client that
+// reconnects with the id of last event it received in Last-Event-ID header
+// gets the events it missed, as long as the hub still has them.
+type eventsHandler struct {
+	service   Service
+	keepalive time.Duration
+}
+
+func (h *eventsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var after uint64
+	if id := r.Header.Get("Last-Event-ID"); len(id) > 0 {
+		n, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			encodeError(ctx, ErrBadRequest, w)
+			return
+		}
+		after = n
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		encodeError(ctx, ErrSystemError, w)
+		return
+	}
+
+	events, err := h.service.SubscribeEvents(ctx, mux.Vars(r)["userid"], after)
+	if err != nil {
+		encodeError(ctx, err, w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(h.keepalive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				// subscriber has been dropped, client has to reconnect
+				return
+			}
+			data, err := json.Marshal(ev.Message)
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.Id, ev.Type, data)
+		case <-ticker.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+		case <-ctx.Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
 type errorer interface {
 	error() error
 }
@@ -296,19 +848,32 @@ type errorer interface {
 // encode request execution error
 func encodeError(_ context.Context, err error, w http.ResponseWriter) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(errorStatus(err))
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": err.Error(),
+	})
+}
+
+// Get http status code for request execution error
+func errorStatus(err error) int {
 	switch err {
 	case ErrMsgNotFound:
-		w.WriteHeader(http.StatusNotFound)
+		return http.StatusNotFound
 	case ErrUserNotFound:
-		w.WriteHeader(http.StatusNotFound)
+		return http.StatusNotFound
 	case ErrGroupNotFound:
-		w.WriteHeader(http.StatusNotFound)
+		return http.StatusNotFound
+	case ErrUserDeactivated:
+		return http.StatusForbidden
+	case ErrForbidden:
+		return http.StatusForbidden
+	case ErrPostingNotPermitted:
+		return http.StatusForbidden
 	case ErrSystemError:
-		w.WriteHeader(http.StatusInternalServerError)
+		return http.StatusInternalServerError
+	case ErrUpstreamUnavailable:
+		return http.StatusServiceUnavailable
 	default:
-		w.WriteHeader(http.StatusBadRequest)
+		return http.StatusBadRequest
 	}
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"error": err.Error(),
-	})
 }
@@ -1,15 +1,19 @@
 package msgstore
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
-	_ "fmt"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/ghsbhatia/msgbox/pkg/middleware"
 	kitlog "github.com/go-kit/kit/log"
 	_ "github.com/matryer/is"
 	"github.com/stretchr/testify/assert"
@@ -20,32 +24,103 @@ type MockedService struct {
 	mock.Mock
 }
 
-func (m *MockedService) StoreMessage(ctx context.Context, msg message) (string, error) {
+func (m *MockedService) StoreMessage(ctx context.Context, msg Message) (string, error) {
 	args := m.Called(msg)
 	return args.String(0), args.Error(1)
 }
 
-func (m *MockedService) GetMessage(ctx context.Context, msgid string) (message, error) {
+func (m *MockedService) GetMessage(ctx context.Context, msgid string) (Message, error) {
 	args := m.Called(msgid)
-	return args.Get(0).(message), args.Error(1)
+	return args.Get(0).(Message), args.Error(1)
 }
 
-func (m *MockedService) GetMessages(ctx context.Context, userid string) ([]message, error) {
+func (m *MockedService) GetMessages(ctx context.Context, userid string) ([]Message, error) {
 	args := m.Called(userid)
-	_, ok := args.Get(0).([]message)
+	_, ok := args.Get(0).([]Message)
 	if !ok {
 		return nil, args.Error(1)
 	}
-	return args.Get(0).([]message), args.Error(1)
+	return args.Get(0).([]Message), args.Error(1)
 }
 
-func (m *MockedService) GetReplies(ctx context.Context, msgid string) ([]message, error) {
+func (m *MockedService) GetMessagesPage(ctx context.Context, userid string, query MailboxQuery) ([]Message, string, error) {
+	args := m.Called(userid, query)
+	_, ok := args.Get(0).([]Message)
+	if !ok {
+		return nil, "", args.Error(2)
+	}
+	return args.Get(0).([]Message), args.String(1), args.Error(2)
+}
+
+func (m *MockedService) GetSentMessages(ctx context.Context, userid string, query MailboxQuery) ([]Message, string, error) {
+	args := m.Called(userid, query)
+	_, ok := args.Get(0).([]Message)
+	if !ok {
+		return nil, "", args.Error(2)
+	}
+	return args.Get(0).([]Message), args.String(1), args.Error(2)
+}
+
+func (m *MockedService) SearchMessages(ctx context.Context, userid string, query SearchQuery) ([]SearchMatch, error) {
+	args := m.Called(userid, query)
+	_, ok := args.Get(0).([]SearchMatch)
+	if !ok {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]SearchMatch), args.Error(1)
+}
+
+func (m *MockedService) MarkRead(ctx context.Context, userid string, msgid string) error {
+	args := m.Called(userid, msgid)
+	return args.Error(0)
+}
+
+func (m *MockedService) MarkUnread(ctx context.Context, userid string, msgid string) error {
+	args := m.Called(userid, msgid)
+	return args.Error(0)
+}
+
+func (m *MockedService) GetUnreadCount(ctx context.Context, userid string) (int64, error) {
+	args := m.Called(userid)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockedService) ArchiveMessage(ctx context.Context, userid string, msgid string) error {
+	args := m.Called(userid, msgid)
+	return args.Error(0)
+}
+
+func (m *MockedService) UnarchiveMessage(ctx context.Context, userid string, msgid string) error {
+	args := m.Called(userid, msgid)
+	return args.Error(0)
+}
+
+func (m *MockedService) DeleteMessage(ctx context.Context, userid string, msgid string) error {
+	args := m.Called(userid, msgid)
+	return args.Error(0)
+}
+
+func (m *MockedService) GetReplies(ctx context.Context, msgid string) ([]Message, error) {
+	args := m.Called(msgid)
+	_, ok := args.Get(0).([]Message)
+	if !ok {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]Message), args.Error(1)
+}
+
+func (m *MockedService) GetThread(ctx context.Context, msgid string) (Thread, error) {
 	args := m.Called(msgid)
-	_, ok := args.Get(0).([]message)
+	return args.Get(0).(Thread), args.Error(1)
+}
+
+func (m *MockedService) SubscribeEvents(ctx context.Context, userid string, after uint64) (<-chan Event, error) {
+	args := m.Called(userid, after)
+	_, ok := args.Get(0).(chan Event)
 	if !ok {
 		return nil, args.Error(1)
 	}
-	return args.Get(0).([]message), args.Error(1)
+	return args.Get(0).(chan Event), args.Error(1)
 }
 
 // Test executor for message transport
@@ -58,15 +133,43 @@ func TestMessageTransport(t *testing.T) {
 	t.Run("StoreMessageInvalidGroup", func(t *testing.T) { s.testStoreMessageInvalidGroup(t) })
 	t.Run("StoreMessageNoSender", func(t *testing.T) { s.testStoreMessageNoSender(t) })
 	t.Run("StoreMessageNoRecipient", func(t *testing.T) { s.testStoreMessageNoRecipient(t) })
+	t.Run("StoreMessageAddressees", func(t *testing.T) { s.testStoreMessageAddressees(t) })
+	t.Run("StoreMessageInvalidAddressees", func(t *testing.T) { s.testStoreMessageInvalidAddressees(t) })
 	t.Run("StoreMessageSystemException", func(t *testing.T) { s.testStoreMessageSystemException(t) })
+	t.Run("StoreMessageUpstreamUnavailable", func(t *testing.T) { s.testStoreMessageUpstreamUnavailable(t) })
+	t.Run("StoreMessageUserDeactivated", func(t *testing.T) { s.testStoreMessageUserDeactivated(t) })
+	t.Run("StoreMessagePostingNotPermitted", func(t *testing.T) { s.testStoreMessagePostingNotPermitted(t) })
 	t.Run("StoreReply", func(t *testing.T) { s.testStoreReply(t) })
 	t.Run("StoreReplyInvalidId", func(t *testing.T) { s.testStoreReplyInvalidId(t) })
 	t.Run("GetReplies", func(t *testing.T) { s.testGetReplies(t) })
 	t.Run("GetRepliesInvalidId", func(t *testing.T) { s.testGetRepliesInvalidId(t) })
 	t.Run("GetMessage", func(t *testing.T) { s.testGetMessage(t) })
 	t.Run("GetMessageInvalidId", func(t *testing.T) { s.testGetMessageInvalidId(t) })
+	t.Run("GetMessageForbidden", func(t *testing.T) { s.testGetMessageForbidden(t) })
 	t.Run("GetMessagesForUser", func(t *testing.T) { s.testGetMessagesForUser(t) })
 	t.Run("GetMessagesInvalidUser", func(t *testing.T) { s.testGetMessagesInvalidUser(t) })
+	t.Run("GetMessagesForbidden", func(t *testing.T) { s.testGetMessagesForbidden(t) })
+	t.Run("GetMessagesPage", func(t *testing.T) { s.testGetMessagesPage(t) })
+	t.Run("GetMessagesPageDefaultLimit", func(t *testing.T) { s.testGetMessagesPageDefaultLimit(t) })
+	t.Run("GetMessagesPageInvalidLimit", func(t *testing.T) { s.testGetMessagesPageInvalidLimit(t) })
+	t.Run("GetUnreadMessages", func(t *testing.T) { s.testGetUnreadMessages(t) })
+	t.Run("GetFilteredMessages", func(t *testing.T) { s.testGetFilteredMessages(t) })
+	t.Run("GetFilteredMessagesInvalid", func(t *testing.T) { s.testGetFilteredMessagesInvalid(t) })
+	t.Run("GetSentMessages", func(t *testing.T) { s.testGetSentMessages(t) })
+	t.Run("GetSentMessagesInvalidLimit", func(t *testing.T) { s.testGetSentMessagesInvalidLimit(t) })
+	t.Run("SearchMessages", func(t *testing.T) { s.testSearchMessages(t) })
+	t.Run("SearchMessagesNoTerms", func(t *testing.T) { s.testSearchMessagesNoTerms(t) })
+	t.Run("MarkRead", func(t *testing.T) { s.testMarkRead(t) })
+	t.Run("MarkUnreadInvalidId", func(t *testing.T) { s.testMarkUnreadInvalidId(t) })
+	t.Run("GetUnreadCount", func(t *testing.T) { s.testGetUnreadCount(t) })
+	t.Run("DeleteMessage", func(t *testing.T) { s.testDeleteMessage(t) })
+	t.Run("ArchiveMessage", func(t *testing.T) { s.testArchiveMessage(t) })
+	t.Run("GetArchivedMessages", func(t *testing.T) { s.testGetArchivedMessages(t) })
+	t.Run("GetThread", func(t *testing.T) { s.testGetThread(t) })
+	t.Run("GetThreadInvalidId", func(t *testing.T) { s.testGetThreadInvalidId(t) })
+	t.Run("SubscribeEvents", func(t *testing.T) { s.testSubscribeEvents(t) })
+	t.Run("SubscribeEventsInvalidLastEventId", func(t *testing.T) { s.testSubscribeEventsInvalidLastEventId(t) })
+	t.Run("SubscribeEventsForbidden", func(t *testing.T) { s.testSubscribeEventsForbidden(t) })
 }
 
 // Test suite for message creation
@@ -75,10 +178,10 @@ type messageTestSuite struct{}
 // Test scenario - Store New Message
 func (s *messageTestSuite) testStoreMessage(t *testing.T) {
 
-	msg := message{
+	msg := Message{
 		Id:        "id1",
 		Sender:    "tester",
-		Recipient: receiver{Groupname: "testgroup"},
+		Recipient: Receiver{Groupname: "testgroup"},
 		Subject:   "test",
 		Body:      "test message",
 	}
@@ -110,10 +213,10 @@ func (s *messageTestSuite) testStoreMessage(t *testing.T) {
 // Test scenario - Store New Message with Invalid User recipient
 func (s *messageTestSuite) testStoreMessageInvalidUser(t *testing.T) {
 
-	msg := message{
+	msg := Message{
 		Id:        "id1",
 		Sender:    "tester",
-		Recipient: receiver{Username: "unknown"},
+		Recipient: Receiver{Username: "unknown"},
 		Subject:   "test",
 		Body:      "test message",
 	}
@@ -145,10 +248,10 @@ func (s *messageTestSuite) testStoreMessageInvalidUser(t *testing.T) {
 // Test scenario - Store New Message with Invalid Group recipient
 func (s *messageTestSuite) testStoreMessageInvalidGroup(t *testing.T) {
 
-	msg := message{
+	msg := Message{
 		Id:        "id1",
 		Sender:    "tester",
-		Recipient: receiver{Groupname: "unknown"},
+		Recipient: Receiver{Groupname: "unknown"},
 		Subject:   "test",
 		Body:      "test message",
 	}
@@ -180,10 +283,10 @@ func (s *messageTestSuite) testStoreMessageInvalidGroup(t *testing.T) {
 // Test scenario - Store New Message System Exception
 func (s *messageTestSuite) testStoreMessageSystemException(t *testing.T) {
 
-	msg := message{
+	msg := Message{
 		Id:        "id1",
 		Sender:    "tester",
-		Recipient: receiver{Groupname: "testgroup"},
+		Recipient: Receiver{Groupname: "testgroup"},
 		Subject:   "test",
 		Body:      "test message",
 	}
@@ -212,12 +315,117 @@ func (s *messageTestSuite) testStoreMessageSystemException(t *testing.T) {
 
 }
 
+// Test scenario - Store New Message while user service is unavailable
+func (s *messageTestSuite) testStoreMessageUpstreamUnavailable(t *testing.T) {
+
+	msg := Message{
+		Id:        "id1",
+		Sender:    "tester",
+		Recipient: Receiver{Username: "user1"},
+		Subject:   "test",
+		Body:      "test message",
+	}
+
+	service := new(MockedService)
+	service.On("StoreMessage", msg).Return("", ErrUpstreamUnavailable)
+
+	data, _ := json.Marshal(msg)
+	body := strings.NewReader(string(data))
+
+	req := httptest.NewRequest("POST", "http://foo.com/messages", body)
+
+	w := httptest.NewRecorder()
+
+	MakeHandler(service, kitlog.NewNopLogger()).ServeHTTP(w, req)
+
+	service.AssertExpectations(t)
+
+	{
+		resp := w.Result()
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		body, _ := ioutil.ReadAll(resp.Body)
+		content := strings.Trim(string(body), "\n")
+		assert.Equal(t, `{"error":"upstream service unavailable"}`, content)
+	}
+
+}
+
+// Test scenario - Store New Message for a deactivated user
+func (s *messageTestSuite) testStoreMessageUserDeactivated(t *testing.T) {
+
+	msg := Message{
+		Id:        "id1",
+		Sender:    "tester",
+		Recipient: Receiver{Username: "user1"},
+		Subject:   "test",
+		Body:      "test message",
+	}
+
+	service := new(MockedService)
+	service.On("StoreMessage", msg).Return("", ErrUserDeactivated)
+
+	data, _ := json.Marshal(msg)
+	body := strings.NewReader(string(data))
+
+	req := httptest.NewRequest("POST", "http://foo.com/messages", body)
+
+	w := httptest.NewRecorder()
+
+	MakeHandler(service, kitlog.NewNopLogger()).ServeHTTP(w, req)
+
+	service.AssertExpectations(t)
+
+	{
+		resp := w.Result()
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		body, _ := ioutil.ReadAll(resp.Body)
+		content := strings.Trim(string(body), "\n")
+		assert.Equal(t, `{"error":"user is deactivated"}`, content)
+	}
+
+}
+
+// Test scenario - Store New Message for a group the sender may not post to
+func (s *messageTestSuite) testStoreMessagePostingNotPermitted(t *testing.T) {
+
+	msg := Message{
+		Id:        "id1",
+		Sender:    "tester",
+		Recipient: Receiver{Groupname: "announcements"},
+		Subject:   "test",
+		Body:      "test message",
+	}
+
+	service := new(MockedService)
+	service.On("StoreMessage", msg).Return("", ErrPostingNotPermitted)
+
+	data, _ := json.Marshal(msg)
+	body := strings.NewReader(string(data))
+
+	req := httptest.NewRequest("POST", "http://foo.com/messages", body)
+
+	w := httptest.NewRecorder()
+
+	MakeHandler(service, kitlog.NewNopLogger()).ServeHTTP(w, req)
+
+	service.AssertExpectations(t)
+
+	{
+		resp := w.Result()
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		body, _ := ioutil.ReadAll(resp.Body)
+		content := strings.Trim(string(body), "\n")
+		assert.Equal(t, `{"error":"not permitted to post to group"}`, content)
+	}
+
+}
+
 // Test scenario - Store New Message with sender missing
 func (s *messageTestSuite) testStoreMessageNoSender(t *testing.T) {
 
-	msg := message{
+	msg := Message{
 		Id:        "id1",
-		Recipient: receiver{Groupname: "testgroup"},
+		Recipient: Receiver{Groupname: "testgroup"},
 		Subject:   "test",
 		Body:      "test message",
 	}
@@ -248,7 +456,7 @@ func (s *messageTestSuite) testStoreMessageNoSender(t *testing.T) {
 // Test scenario - Store New Message with recipient missing
 func (s *messageTestSuite) testStoreMessageNoRecipient(t *testing.T) {
 
-	msg := message{
+	msg := Message{
 		Id:      "id1",
 		Sender:  "tester",
 		Subject: "test",
@@ -278,13 +486,77 @@ func (s *messageTestSuite) testStoreMessageNoRecipient(t *testing.T) {
 
 }
 
+// Test scenario - Store New Message for lists of users and groups
+func (s *messageTestSuite) testStoreMessageAddressees(t *testing.T) {
+
+	msg := Message{
+		Sender:  "tester",
+		To:      []Receiver{{Username: "user1"}, {Groupname: "group1"}},
+		Cc:      []Receiver{{Username: "user2"}},
+		Bcc:     []Receiver{{Username: "user3"}},
+		Subject: "test",
+		Body:    "test message",
+	}
+
+	service := new(MockedService)
+	service.On("StoreMessage", msg).Return("id1", nil)
+
+	body := strings.NewReader(`{"sender":"tester","to":[{"username":"user1"},{"groupname":"group1"}],` +
+		`"cc":[{"username":"user2"}],"bcc":[{"username":"user3"}],"subject":"test","body":"test message"}`)
+
+	req := httptest.NewRequest("POST", "http://foo.com/messages", body)
+
+	w := httptest.NewRecorder()
+
+	MakeHandler(service, kitlog.NewNopLogger()).ServeHTTP(w, req)
+
+	service.AssertExpectations(t)
+
+	assert.Equal(t, http.StatusCreated, w.Result().StatusCode)
+
+}
+
+// Test scenario - Store New Message with invalid lists of addressees
+func (s *messageTestSuite) testStoreMessageInvalidAddressees(t *testing.T) {
+
+	many := make([]Receiver, maxAddressees+1)
+	for i := range many {
+		many[i] = Receiver{Username: fmt.Sprintf("user%d", i)}
+	}
+
+	invalid := []Message{
+		{Recipient: Receiver{Username: "user1"}, To: []Receiver{{Username: "user2"}}},
+		{To: []Receiver{{}}},
+		{Cc: []Receiver{{Username: "user1", Groupname: "group1"}}},
+		{Bcc: many},
+	}
+
+	service := new(MockedService)
+
+	for _, msg := range invalid {
+		msg.Sender, msg.Subject, msg.Body = "tester", "test", "test message"
+
+		data, _ := json.Marshal(msg)
+		req := httptest.NewRequest("POST", "http://foo.com/messages", strings.NewReader(string(data)))
+
+		w := httptest.NewRecorder()
+
+		MakeHandler(service, kitlog.NewNopLogger()).ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+	}
+
+	service.AssertNotCalled(t, "StoreMessage", mock.Anything)
+
+}
+
 // Test scenario - Get Message
 func (s *messageTestSuite) testGetMessage(t *testing.T) {
 
-	msg := message{
+	msg := Message{
 		Id:        "id1",
 		Sender:    "tester",
-		Recipient: receiver{Groupname: "testgroup"},
+		Recipient: Receiver{Groupname: "testgroup"},
 		Subject:   "test",
 		Body:      "test message",
 		Timestamp: "2019-09-03T18:32:01Z",
@@ -316,7 +588,7 @@ func (s *messageTestSuite) testGetMessage(t *testing.T) {
 func (s *messageTestSuite) testGetMessageInvalidId(t *testing.T) {
 
 	service := new(MockedService)
-	service.On("GetMessage", "id1").Return(message{}, ErrMsgNotFound)
+	service.On("GetMessage", "id1").Return(Message{}, ErrMsgNotFound)
 
 	req := httptest.NewRequest("GET", "http://foo.com/messages/id1", nil)
 
@@ -339,26 +611,26 @@ func (s *messageTestSuite) testGetMessageInvalidId(t *testing.T) {
 // Test scenario - Get Messages for User
 func (s *messageTestSuite) testGetMessagesForUser(t *testing.T) {
 
-	msg1 := message{
+	msg1 := Message{
 		Id:        "id1",
 		Sender:    "user1",
-		Recipient: receiver{Username: "tester"},
+		Recipient: Receiver{Username: "tester"},
 		Subject:   "test",
 		Body:      "test message",
 		Timestamp: "2019-09-03T18:32:01Z",
 	}
 
-	msg2 := message{
+	msg2 := Message{
 		Id:        "id2",
 		Sender:    "user2",
-		Recipient: receiver{Username: "tester"},
+		Recipient: Receiver{Username: "tester"},
 		Subject:   "test",
 		Body:      "test message",
 		Timestamp: "2019-09-03T18:40:32Z",
 	}
 
 	service := new(MockedService)
-	service.On("GetMessages", "tester").Return([]message{msg1, msg2}, nil)
+	service.On("GetMessagesPage", "tester", MailboxQuery{Limit: defaultPageLimit}).Return([]Message{msg1, msg2}, "", nil)
 
 	req := httptest.NewRequest("GET", "http://foo.com/users/tester/mailbox", nil)
 
@@ -373,8 +645,8 @@ func (s *messageTestSuite) testGetMessagesForUser(t *testing.T) {
 		assert.Equal(t, http.StatusOK, resp.StatusCode)
 		body, _ := ioutil.ReadAll(resp.Body)
 		content := strings.Trim(string(body), "\n")
-		exp, _ := json.Marshal([]message{msg1, msg2})
-		assert.Equal(t, exp, []byte(content))
+		exp, _ := json.Marshal(map[string]interface{}{"messages": []Message{msg1, msg2}})
+		assert.Equal(t, string(exp), content)
 	}
 
 }
@@ -383,7 +655,7 @@ func (s *messageTestSuite) testGetMessagesForUser(t *testing.T) {
 func (s *messageTestSuite) testGetMessagesInvalidUser(t *testing.T) {
 
 	service := new(MockedService)
-	service.On("GetMessages", "unknown").Return(nil, ErrUserNotFound)
+	service.On("GetMessagesPage", "unknown", MailboxQuery{Limit: defaultPageLimit}).Return(nil, "", ErrUserNotFound)
 
 	req := httptest.NewRequest("GET", "http://foo.com/users/unknown/mailbox", nil)
 
@@ -403,29 +675,13 @@ func (s *messageTestSuite) testGetMessagesInvalidUser(t *testing.T) {
 
 }
 
-// Test scenario - Store Reply
-func (s *messageTestSuite) testStoreReply(t *testing.T) {
-
-	msg := message{
-		Sender:  "tester",
-		Subject: "test",
-		Body:    "test message",
-	}
-
-	rep := message{
-		Re:      "id:01",
-		Sender:  "tester",
-		Subject: "test",
-		Body:    "test message",
-	}
+// Test scenario - Get Messages for User other than authenticated subject
+func (s *messageTestSuite) testGetMessagesForbidden(t *testing.T) {
 
 	service := new(MockedService)
-	service.On("StoreMessage", rep).Return("id:02", nil)
-
-	data, _ := json.Marshal(msg)
-	body := strings.NewReader(string(data))
+	service.On("GetMessagesPage", "bob", MailboxQuery{Limit: defaultPageLimit}).Return(nil, "", ErrForbidden)
 
-	req := httptest.NewRequest("POST", "http://foo.com/messages/id:01/replies", body)
+	req := httptest.NewRequest("GET", "http://foo.com/users/bob/mailbox", nil)
 
 	w := httptest.NewRecorder()
 
@@ -435,37 +691,61 @@ func (s *messageTestSuite) testStoreReply(t *testing.T) {
 
 	{
 		resp := w.Result()
-		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
 		body, _ := ioutil.ReadAll(resp.Body)
 		content := strings.Trim(string(body), "\n")
-		assert.Equal(t, `{"id":"id:02"}`, content)
+		assert.Equal(t, `{"error":"operation not permitted"}`, content)
 	}
 
 }
 
-// Test scenario - Store Reply with Invalid Message Id
-func (s *messageTestSuite) testStoreReplyInvalidId(t *testing.T) {
+// Test scenario - Get message, its replies and thread as a user who neither
+// sent nor received it
+func (s *messageTestSuite) testGetMessageForbidden(t *testing.T) {
 
-	msg := message{
-		Sender:  "tester",
-		Subject: "test",
-		Body:    "test message",
+	service := NewService(NewInMemoryMessageRepository(), &MockedUserSvcClient{"user"}, "/foo")
+
+	msgid, err := service.StoreMessage(context.TODO(), Message{Sender: "alice", Subject: "test", Body: "body",
+		Recipient: Receiver{Username: "bob"}})
+	assert.NoError(t, err)
+
+	handler := MakeHandler(service, kitlog.NewNopLogger())
+	get := func(user string, path string) *http.Response {
+		req := httptest.NewRequest("GET", "http://foo.com"+path, nil)
+		req = req.WithContext(middleware.NewAuthContext(req.Context(), user, "token"))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Result()
 	}
 
-	rep := message{
-		Re:      "unknown",
-		Sender:  "tester",
-		Subject: "test",
-		Body:    "test message",
+	for _, path := range []string{"/messages/" + msgid, "/messages/" + msgid + "/replies", "/messages/" + msgid + "/thread"} {
+		resp := get("carol", path)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode, path)
+		body, _ := ioutil.ReadAll(resp.Body)
+		content := strings.Trim(string(body), "\n")
+		assert.Equal(t, `{"error":"operation not permitted"}`, content)
+
+		assert.Equal(t, http.StatusOK, get("bob", path).StatusCode, path)
 	}
 
-	service := new(MockedService)
-	service.On("StoreMessage", rep).Return("", ErrMsgNotFound)
+}
 
-	data, _ := json.Marshal(msg)
-	body := strings.NewReader(string(data))
+// Test scenario - Get a page of Messages for User
+func (s *messageTestSuite) testGetMessagesPage(t *testing.T) {
 
-	req := httptest.NewRequest("POST", "http://foo.com/messages/unknown/replies", body)
+	msg1 := Message{
+		Id:        "id2",
+		Sender:    "user2",
+		Recipient: Receiver{Username: "tester"},
+		Subject:   "test",
+		Body:      "test message",
+		Timestamp: "2019-09-03T18:40:32Z",
+	}
+
+	service := new(MockedService)
+	service.On("GetMessagesPage", "tester", MailboxQuery{Limit: 1, Cursor: "abc"}).Return([]Message{msg1}, "def", nil)
+
+	req := httptest.NewRequest("GET", "http://foo.com/users/tester/mailbox?limit=1&cursor=abc", nil)
 
 	w := httptest.NewRecorder()
 
@@ -475,41 +755,22 @@ func (s *messageTestSuite) testStoreReplyInvalidId(t *testing.T) {
 
 	{
 		resp := w.Result()
-		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
 		body, _ := ioutil.ReadAll(resp.Body)
 		content := strings.Trim(string(body), "\n")
-		assert.Equal(t, `{"error":"message not found"}`, content)
+		exp, _ := json.Marshal(map[string]interface{}{"messages": []Message{msg1}, "next_cursor": "def"})
+		assert.Equal(t, string(exp), content)
 	}
 
 }
 
-// Test scenario - Get Replies for Given Message Id
-func (s *messageTestSuite) testGetReplies(t *testing.T) {
-
-	msg1 := message{
-		Id:        "id1",
-		Re:        "id0",
-		Sender:    "user1",
-		Recipient: receiver{Username: "tester"},
-		Subject:   "re:test",
-		Body:      "test message",
-		Timestamp: "2019-09-03T18:32:01Z",
-	}
-
-	msg2 := message{
-		Id:        "id2",
-		Re:        "id0",
-		Sender:    "user2",
-		Recipient: receiver{Username: "tester"},
-		Subject:   "re:test",
-		Body:      "test message",
-		Timestamp: "2019-09-03T18:40:32Z",
-	}
+// Test scenario - Get first page of Messages for User without a limit
+func (s *messageTestSuite) testGetMessagesPageDefaultLimit(t *testing.T) {
 
 	service := new(MockedService)
-	service.On("GetReplies", "id0").Return([]message{msg1, msg2}, nil)
+	service.On("GetMessagesPage", "tester", MailboxQuery{Limit: defaultPageLimit}).Return([]Message{}, "", nil)
 
-	req := httptest.NewRequest("GET", "http://foo.com/messages/id0/replies", nil)
+	req := httptest.NewRequest("GET", "http://foo.com/users/tester/mailbox?cursor=", nil)
 
 	w := httptest.NewRecorder()
 
@@ -522,19 +783,17 @@ func (s *messageTestSuite) testGetReplies(t *testing.T) {
 		assert.Equal(t, http.StatusOK, resp.StatusCode)
 		body, _ := ioutil.ReadAll(resp.Body)
 		content := strings.Trim(string(body), "\n")
-		exp, _ := json.Marshal([]message{msg1, msg2})
-		assert.Equal(t, exp, []byte(content))
+		assert.Equal(t, `{"messages":[]}`, content)
 	}
 
 }
 
-// Test scenario - Get Replies Invalid Message Id
-func (s *messageTestSuite) testGetRepliesInvalidId(t *testing.T) {
+// Test scenario - Get a page of Messages for User with invalid limit
+func (s *messageTestSuite) testGetMessagesPageInvalidLimit(t *testing.T) {
 
 	service := new(MockedService)
-	service.On("GetReplies", "unknown").Return(nil, ErrMsgNotFound)
 
-	req := httptest.NewRequest("GET", "http://foo.com/messages/unknown/replies", nil)
+	req := httptest.NewRequest("GET", "http://foo.com/users/tester/mailbox?limit=-1", nil)
 
 	w := httptest.NewRecorder()
 
@@ -544,58 +803,608 @@ func (s *messageTestSuite) testGetRepliesInvalidId(t *testing.T) {
 
 	{
 		resp := w.Result()
-		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
 		body, _ := ioutil.ReadAll(resp.Body)
 		content := strings.Trim(string(body), "\n")
-		assert.Equal(t, `{"error":"message not found"}`, content)
+		assert.Equal(t, `{"error":"invalid request"}`, content)
 	}
 
 }
 
-// Test scenrio - Marshal message instance into json string
-func (s *messageTestSuite) testMessageMarshal(t *testing.T) {
+// Test scenario - Get a page of Messages sent by User
+func (s *messageTestSuite) testGetSentMessages(t *testing.T) {
 
-	msg := &message{
-		Id:        "id1",
-		Re:        "id2",
-		Sender:    "bob",
-		Recipient: receiver{Groupname: "testgroup"},
+	msg1 := Message{
+		Id:        "id2",
+		Sender:    "tester",
+		To:        []Receiver{{Username: "user2"}},
+		Cc:        []Receiver{{Groupname: "friends"}},
 		Subject:   "test",
 		Body:      "test message",
-		Timestamp: "2019-09-03T18:32:01Z",
+		Timestamp: "2019-09-03T18:40:32Z",
 	}
 
-	data, err := json.Marshal(msg)
+	service := new(MockedService)
+	service.On("GetSentMessages", "tester", MailboxQuery{Limit: defaultPageLimit, Cursor: "abc"}).Return([]Message{msg1}, "def", nil)
 
-	assert.NotNil(t, data)
-	assert.NoError(t, err)
-	assert.Equal(t, data, []byte(`{"id":"id1","re":"id2","sender":"bob","recipient":{"groupname":"testgroup"},"subject":"test","body":"test message","sentAt":"2019-09-03T18:32:01Z"}`))
+	req := httptest.NewRequest("GET", "http://foo.com/users/tester/sent?cursor=abc", nil)
 
-}
+	w := httptest.NewRecorder()
 
-// Test scenrio - Marshal messages into json string
-func (s *messageTestSuite) testMessagesMarshal(t *testing.T) {
+	MakeHandler(service, kitlog.NewNopLogger()).ServeHTTP(w, req)
 
-	msg1 := message{
-		Id:        "id1",
+	service.AssertExpectations(t)
+
+	{
+		resp := w.Result()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		body, _ := ioutil.ReadAll(resp.Body)
+		content := strings.Trim(string(body), "\n")
+		exp, _ := json.Marshal(map[string]interface{}{"messages": []Message{msg1}, "next_cursor": "def"})
+		assert.Equal(t, string(exp), content)
+	}
+
+}
+
+// Test scenario - Get a page of Messages sent by User with invalid limit
+func (s *messageTestSuite) testGetSentMessagesInvalidLimit(t *testing.T) {
+
+	service := new(MockedService)
+
+	req := httptest.NewRequest("GET", "http://foo.com/users/tester/sent?limit=1000", nil)
+
+	w := httptest.NewRecorder()
+
+	MakeHandler(service, kitlog.NewNopLogger()).ServeHTTP(w, req)
+
+	service.AssertExpectations(t)
+
+	{
+		resp := w.Result()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		body, _ := ioutil.ReadAll(resp.Body)
+		content := strings.Trim(string(body), "\n")
+		assert.Equal(t, `{"error":"invalid request"}`, content)
+	}
+
+}
+
+// Test scenario - Search Messages of User
+func (s *messageTestSuite) testSearchMessages(t *testing.T) {
+
+	result := SearchMatch{
+		Message: Message{
+			Id:        "id2",
+			Sender:    "user2",
+			Recipient: Receiver{Username: "tester"},
+			Subject:   "lunch",
+			Body:      "test message",
+			Timestamp: "2019-09-03T18:40:32Z",
+		},
+		Score:      1,
+		Highlights: []Highlight{{"subject", 0, 5}},
+	}
+
+	service := new(MockedService)
+	service.On("SearchMessages", "tester", SearchQuery{Text: "lunch", Limit: 10}).Return([]SearchMatch{result}, nil)
+
+	req := httptest.NewRequest("GET", "http://foo.com/users/tester/mailbox/search?q=lunch&limit=10", nil)
+
+	w := httptest.NewRecorder()
+
+	MakeHandler(service, kitlog.NewNopLogger()).ServeHTTP(w, req)
+
+	service.AssertExpectations(t)
+
+	{
+		resp := w.Result()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		body, _ := ioutil.ReadAll(resp.Body)
+		content := strings.Trim(string(body), "\n")
+		exp := `{"results":[{"id":"id2","sender":"user2","recipient":{"username":"tester"},` +
+			`"subject":"lunch","body":"test message","sentAt":"2019-09-03T18:40:32Z",` +
+			`"score":1,"highlights":[{"field":"subject","start":0,"end":5}]}]}`
+		assert.Equal(t, exp, content)
+	}
+
+}
+
+// Test scenario - Search Messages of User without any words to search
+func (s *messageTestSuite) testSearchMessagesNoTerms(t *testing.T) {
+
+	service := new(MockedService)
+
+	req := httptest.NewRequest("GET", "http://foo.com/users/tester/mailbox/search?q=+-+", nil)
+
+	w := httptest.NewRecorder()
+
+	MakeHandler(service, kitlog.NewNopLogger()).ServeHTTP(w, req)
+
+	service.AssertExpectations(t)
+
+	{
+		resp := w.Result()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		body, _ := ioutil.ReadAll(resp.Body)
+		content := strings.Trim(string(body), "\n")
+		assert.Equal(t, `{"error":"invalid request"}`, content)
+	}
+
+}
+
+// Test scenario - Get unread Messages for User
+func (s *messageTestSuite) testGetUnreadMessages(t *testing.T) {
+
+	service := new(MockedService)
+	service.On("GetMessagesPage", "tester", MailboxQuery{Limit: defaultPageLimit, Unread: true}).Return([]Message{}, "", nil)
+
+	req := httptest.NewRequest("GET", "http://foo.com/users/tester/mailbox?unread=true", nil)
+
+	w := httptest.NewRecorder()
+
+	MakeHandler(service, kitlog.NewNopLogger()).ServeHTTP(w, req)
+
+	service.AssertExpectations(t)
+
+	{
+		resp := w.Result()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+}
+
+// Test scenario - Get Messages for User filtered by sender, group, period and reply status
+func (s *messageTestSuite) testGetFilteredMessages(t *testing.T) {
+
+	query := MailboxQuery{
+		Limit:     defaultPageLimit,
+		From:      "user2",
+		Group:     "friends",
+		Since:     time.Date(2019, 9, 1, 0, 0, 0, 0, time.UTC),
+		Until:     time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC),
+		RootsOnly: true,
+	}
+
+	service := new(MockedService)
+	service.On("GetMessagesPage", "tester", query).Return([]Message{}, "", nil)
+
+	req := httptest.NewRequest("GET", "http://foo.com/users/tester/mailbox?from=user2&group=friends"+
+		"&since=2019-09-01T00:00:00Z&until=2019-10-01T00:00:00Z&roots_only=true", nil)
+
+	w := httptest.NewRecorder()
+
+	MakeHandler(service, kitlog.NewNopLogger()).ServeHTTP(w, req)
+
+	service.AssertExpectations(t)
+
+	{
+		resp := w.Result()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+}
+
+// Test scenario - Get Messages for User with invalid filters
+func (s *messageTestSuite) testGetFilteredMessagesInvalid(t *testing.T) {
+
+	for _, filter := range []string{"since=yesterday", "until=2019-10-01", "replies_only=true&roots_only=true", "roots_only=maybe"} {
+
+		service := new(MockedService)
+
+		req := httptest.NewRequest("GET", "http://foo.com/users/tester/mailbox?"+filter, nil)
+
+		w := httptest.NewRecorder()
+
+		MakeHandler(service, kitlog.NewNopLogger()).ServeHTTP(w, req)
+
+		service.AssertExpectations(t)
+
+		{
+			resp := w.Result()
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode, filter)
+		}
+	}
+
+}
+
+// Test scenario - Mark Message as read
+func (s *messageTestSuite) testMarkRead(t *testing.T) {
+
+	service := new(MockedService)
+	service.On("MarkRead", "tester", "id1").Return(nil)
+
+	req := httptest.NewRequest("POST", "http://foo.com/users/tester/mailbox/id1/read", nil)
+
+	w := httptest.NewRecorder()
+
+	MakeHandler(service, kitlog.NewNopLogger()).ServeHTTP(w, req)
+
+	service.AssertExpectations(t)
+
+	{
+		resp := w.Result()
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+		body, _ := ioutil.ReadAll(resp.Body)
+		assert.Equal(t, 0, len(body))
+	}
+
+}
+
+// Test scenario - Mark Message as unread with Invalid Message Id
+func (s *messageTestSuite) testMarkUnreadInvalidId(t *testing.T) {
+
+	service := new(MockedService)
+	service.On("MarkUnread", "tester", "unknown").Return(ErrMsgNotFound)
+
+	req := httptest.NewRequest("POST", "http://foo.com/users/tester/mailbox/unknown/unread", nil)
+
+	w := httptest.NewRecorder()
+
+	MakeHandler(service, kitlog.NewNopLogger()).ServeHTTP(w, req)
+
+	service.AssertExpectations(t)
+
+	{
+		resp := w.Result()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		body, _ := ioutil.ReadAll(resp.Body)
+		content := strings.Trim(string(body), "\n")
+		assert.Equal(t, `{"error":"message not found"}`, content)
+	}
+
+}
+
+// Test scenario - Get number of unread Messages for User
+func (s *messageTestSuite) testGetUnreadCount(t *testing.T) {
+
+	service := new(MockedService)
+	service.On("GetUnreadCount", "tester").Return(int64(7), nil)
+
+	req := httptest.NewRequest("GET", "http://foo.com/users/tester/mailbox/unread-count", nil)
+
+	w := httptest.NewRecorder()
+
+	MakeHandler(service, kitlog.NewNopLogger()).ServeHTTP(w, req)
+
+	service.AssertExpectations(t)
+
+	{
+		resp := w.Result()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		body, _ := ioutil.ReadAll(resp.Body)
+		content := strings.Trim(string(body), "\n")
+		assert.Equal(t, `{"unread":7}`, content)
+	}
+
+}
+
+// Test scenario - Delete Message from mailbox
+func (s *messageTestSuite) testDeleteMessage(t *testing.T) {
+
+	service := new(MockedService)
+	service.On("DeleteMessage", "tester", "id1").Return(nil)
+
+	req := httptest.NewRequest("DELETE", "http://foo.com/users/tester/mailbox/id1", nil)
+
+	w := httptest.NewRecorder()
+
+	MakeHandler(service, kitlog.NewNopLogger()).ServeHTTP(w, req)
+
+	service.AssertExpectations(t)
+
+	{
+		resp := w.Result()
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	}
+
+}
+
+// Test scenario - Archive Message
+func (s *messageTestSuite) testArchiveMessage(t *testing.T) {
+
+	service := new(MockedService)
+	service.On("ArchiveMessage", "tester", "id1").Return(nil)
+
+	req := httptest.NewRequest("POST", "http://foo.com/users/tester/mailbox/id1/archive", nil)
+
+	w := httptest.NewRecorder()
+
+	MakeHandler(service, kitlog.NewNopLogger()).ServeHTTP(w, req)
+
+	service.AssertExpectations(t)
+
+	{
+		resp := w.Result()
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	}
+
+}
+
+// Test scenario - Get archived Messages for User
+func (s *messageTestSuite) testGetArchivedMessages(t *testing.T) {
+
+	service := new(MockedService)
+	service.On("GetMessagesPage", "tester", MailboxQuery{Limit: 10, Archived: true}).Return([]Message{}, "", nil)
+
+	req := httptest.NewRequest("GET", "http://foo.com/users/tester/mailbox?archived=true&limit=10", nil)
+
+	w := httptest.NewRecorder()
+
+	MakeHandler(service, kitlog.NewNopLogger()).ServeHTTP(w, req)
+
+	service.AssertExpectations(t)
+
+	{
+		resp := w.Result()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+}
+
+// Test scenario - Get conversation tree for Given Message Id
+func (s *messageTestSuite) testGetThread(t *testing.T) {
+
+	root := Thread{
+		Message: Message{
+			Id:        "id0",
+			Sender:    "tester",
+			Recipient: Receiver{Username: "user1"},
+			Subject:   "test",
+			Body:      "test message",
+			Timestamp: "2019-09-03T18:32:01Z",
+		},
+		Replies: []Thread{
+			{
+				Message: Message{
+					Id:        "id1",
+					Re:        "id0",
+					Sender:    "user1",
+					Recipient: Receiver{Username: "tester"},
+					Subject:   "re:test",
+					Body:      "reply",
+					Timestamp: "2019-09-03T18:40:32Z",
+				},
+				Depth:   1,
+				Replies: []Thread{},
+			},
+		},
+	}
+
+	service := new(MockedService)
+	service.On("GetThread", "id0").Return(root, nil)
+
+	req := httptest.NewRequest("GET", "http://foo.com/messages/id0/thread", nil)
+
+	w := httptest.NewRecorder()
+
+	MakeHandler(service, kitlog.NewNopLogger()).ServeHTTP(w, req)
+
+	service.AssertExpectations(t)
+
+	{
+		resp := w.Result()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		body, _ := ioutil.ReadAll(resp.Body)
+		content := strings.Trim(string(body), "\n")
+		assert.Equal(t, `{"id":"id0","sender":"tester","recipient":{"username":"user1"},"subject":"test","body":"test message","sentAt":"2019-09-03T18:32:01Z","depth":0,"replies":[{"id":"id1","re":"id0","sender":"user1","recipient":{"username":"tester"},"subject":"re:test","body":"reply","sentAt":"2019-09-03T18:40:32Z","depth":1,"replies":[]}]}`, content)
+	}
+
+}
+
+// Test scenario - Get conversation tree for Invalid Message Id
+func (s *messageTestSuite) testGetThreadInvalidId(t *testing.T) {
+
+	service := new(MockedService)
+	service.On("GetThread", "unknown").Return(Thread{}, ErrMsgNotFound)
+
+	req := httptest.NewRequest("GET", "http://foo.com/messages/unknown/thread", nil)
+
+	w := httptest.NewRecorder()
+
+	MakeHandler(service, kitlog.NewNopLogger()).ServeHTTP(w, req)
+
+	service.AssertExpectations(t)
+
+	{
+		resp := w.Result()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	}
+
+}
+
+// Test scenario - Store Reply
+func (s *messageTestSuite) testStoreReply(t *testing.T) {
+
+	msg := Message{
+		Sender:  "tester",
+		Subject: "test",
+		Body:    "test message",
+	}
+
+	rep := Message{
+		Re:      "id:01",
+		Sender:  "tester",
+		Subject: "test",
+		Body:    "test message",
+	}
+
+	service := new(MockedService)
+	service.On("StoreMessage", rep).Return("id:02", nil)
+
+	data, _ := json.Marshal(msg)
+	body := strings.NewReader(string(data))
+
+	req := httptest.NewRequest("POST", "http://foo.com/messages/id:01/replies", body)
+
+	w := httptest.NewRecorder()
+
+	MakeHandler(service, kitlog.NewNopLogger()).ServeHTTP(w, req)
+
+	service.AssertExpectations(t)
+
+	{
+		resp := w.Result()
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		body, _ := ioutil.ReadAll(resp.Body)
+		content := strings.Trim(string(body), "\n")
+		assert.Equal(t, `{"id":"id:02"}`, content)
+	}
+
+}
+
+// Test scenario - Store Reply with Invalid Message Id
+func (s *messageTestSuite) testStoreReplyInvalidId(t *testing.T) {
+
+	msg := Message{
+		Sender:  "tester",
+		Subject: "test",
+		Body:    "test message",
+	}
+
+	rep := Message{
+		Re:      "unknown",
+		Sender:  "tester",
+		Subject: "test",
+		Body:    "test message",
+	}
+
+	service := new(MockedService)
+	service.On("StoreMessage", rep).Return("", ErrMsgNotFound)
+
+	data, _ := json.Marshal(msg)
+	body := strings.NewReader(string(data))
+
+	req := httptest.NewRequest("POST", "http://foo.com/messages/unknown/replies", body)
+
+	w := httptest.NewRecorder()
+
+	MakeHandler(service, kitlog.NewNopLogger()).ServeHTTP(w, req)
+
+	service.AssertExpectations(t)
+
+	{
+		resp := w.Result()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		body, _ := ioutil.ReadAll(resp.Body)
+		content := strings.Trim(string(body), "\n")
+		assert.Equal(t, `{"error":"message not found"}`, content)
+	}
+
+}
+
+// Test scenario - Get Replies for Given Message Id
+func (s *messageTestSuite) testGetReplies(t *testing.T) {
+
+	msg1 := Message{
+		Id:        "id1",
+		Re:        "id0",
+		Sender:    "user1",
+		Recipient: Receiver{Username: "tester"},
+		Subject:   "re:test",
+		Body:      "test message",
+		Timestamp: "2019-09-03T18:32:01Z",
+	}
+
+	msg2 := Message{
+		Id:        "id2",
+		Re:        "id0",
+		Sender:    "user2",
+		Recipient: Receiver{Username: "tester"},
+		Subject:   "re:test",
+		Body:      "test message",
+		Timestamp: "2019-09-03T18:40:32Z",
+	}
+
+	service := new(MockedService)
+	service.On("GetReplies", "id0").Return([]Message{msg1, msg2}, nil)
+
+	req := httptest.NewRequest("GET", "http://foo.com/messages/id0/replies", nil)
+
+	w := httptest.NewRecorder()
+
+	MakeHandler(service, kitlog.NewNopLogger()).ServeHTTP(w, req)
+
+	service.AssertExpectations(t)
+
+	{
+		resp := w.Result()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		body, _ := ioutil.ReadAll(resp.Body)
+		content := strings.Trim(string(body), "\n")
+		exp, _ := json.Marshal([]Message{msg1, msg2})
+		assert.Equal(t, exp, []byte(content))
+	}
+
+}
+
+// Test scenario - Get Replies Invalid Message Id
+func (s *messageTestSuite) testGetRepliesInvalidId(t *testing.T) {
+
+	service := new(MockedService)
+	service.On("GetReplies", "unknown").Return(nil, ErrMsgNotFound)
+
+	req := httptest.NewRequest("GET", "http://foo.com/messages/unknown/replies", nil)
+
+	w := httptest.NewRecorder()
+
+	MakeHandler(service, kitlog.NewNopLogger()).ServeHTTP(w, req)
+
+	service.AssertExpectations(t)
+
+	{
+		resp := w.Result()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		body, _ := ioutil.ReadAll(resp.Body)
+		content := strings.Trim(string(body), "\n")
+		assert.Equal(t, `{"error":"message not found"}`, content)
+	}
+
+}
+
+// Test scenrio - Marshal message instance into json string
+func (s *messageTestSuite) testMessageMarshal(t *testing.T) {
+
+	msg := &Message{
+		Id:        "id1",
 		Re:        "id2",
 		Sender:    "bob",
-		Recipient: receiver{Groupname: "testgroup"},
+		Recipient: Receiver{Groupname: "testgroup"},
 		Subject:   "test",
 		Body:      "test message",
 		Timestamp: "2019-09-03T18:32:01Z",
 	}
 
-	msg2 := message{
+	data, err := json.Marshal(msg)
+
+	assert.NotNil(t, data)
+	assert.NoError(t, err)
+	assert.Equal(t, data, []byte(`{"id":"id1","re":"id2","sender":"bob","recipient":{"groupname":"testgroup"},"subject":"test","body":"test message","sentAt":"2019-09-03T18:32:01Z"}`))
+
+}
+
+// Test scenrio - Marshal messages into json string
+func (s *messageTestSuite) testMessagesMarshal(t *testing.T) {
+
+	msg1 := Message{
+		Id:        "id1",
+		Re:        "id2",
+		Sender:    "bob",
+		Recipient: Receiver{Groupname: "testgroup"},
+		Subject:   "test",
+		Body:      "test message",
+		Timestamp: "2019-09-03T18:32:01Z",
+	}
+
+	msg2 := Message{
 		Id:        "id2",
 		Sender:    "bob",
-		Recipient: receiver{Groupname: "testgroup"},
+		Recipient: Receiver{Groupname: "testgroup"},
 		Subject:   "test",
 		Body:      "test message",
 		Timestamp: "2019-09-03T16:32:01Z",
 	}
 
-	messages := []message{msg1, msg2}
+	messages := []Message{msg1, msg2}
 
 	response := replyQueryResponse{}
 	response.Content = messages
@@ -605,3 +1414,96 @@ func (s *messageTestSuite) testMessagesMarshal(t *testing.T) {
 	assert.NotNil(t, data)
 	assert.NoError(t, err)
 }
+
+// Test scenario - Stream events of User resuming after last event id
+func (s *messageTestSuite) testSubscribeEvents(t *testing.T) {
+
+	events := make(chan Event, 1)
+	events <- Event{Id: 43, Type: eventReply, Message: Message{Id: "id2", Sender: "user2", Subject: "re:test"}}
+
+	service := new(MockedService)
+	service.On("SubscribeEvents", "tester", uint64(42)).Return(events, nil)
+
+	server := httptest.NewServer(MakeHandler(service, kitlog.NewNopLogger()))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL+"/users/tester/events", nil)
+	req.Header.Set("Last-Event-ID", "42")
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	reader := bufio.NewReader(resp.Body)
+	var lines []string
+	for i := 0; i < 4; i++ {
+		line, err := reader.ReadString('\n')
+		assert.NoError(t, err)
+		lines = append(lines, line)
+	}
+	exp := []string{
+		"id: 43\n",
+		"event: reply\n",
+		`data: {"id":"id2","sender":"user2","recipient":{},"subject":"re:test","body":"","sentAt":""}` + "\n",
+		"\n",
+	}
+	assert.Equal(t, exp, lines)
+
+	// stream ends when subscriber is dropped
+	close(events)
+	_, err = reader.ReadString('\n')
+	assert.Equal(t, io.EOF, err)
+
+	service.AssertExpectations(t)
+}
+
+// Test scenario - Stream events of User with invalid last event id
+func (s *messageTestSuite) testSubscribeEventsInvalidLastEventId(t *testing.T) {
+
+	service := new(MockedService)
+
+	req := httptest.NewRequest("GET", "http://foo.com/users/tester/events", nil)
+	req.Header.Set("Last-Event-ID", "abc")
+
+	w := httptest.NewRecorder()
+
+	MakeHandler(service, kitlog.NewNopLogger()).ServeHTTP(w, req)
+
+	service.AssertExpectations(t)
+
+	{
+		resp := w.Result()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		body, _ := ioutil.ReadAll(resp.Body)
+		content := strings.Trim(string(body), "\n")
+		assert.Equal(t, `{"error":"invalid request"}`, content)
+	}
+
+}
+
+// Test scenario - Stream events of another User
+func (s *messageTestSuite) testSubscribeEventsForbidden(t *testing.T) {
+
+	service := new(MockedService)
+	service.On("SubscribeEvents", "tester", uint64(0)).Return(nil, ErrForbidden)
+
+	req := httptest.NewRequest("GET", "http://foo.com/users/tester/events", nil)
+
+	w := httptest.NewRecorder()
+
+	MakeHandler(service, kitlog.NewNopLogger()).ServeHTTP(w, req)
+
+	service.AssertExpectations(t)
+
+	{
+		resp := w.Result()
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		body, _ := ioutil.ReadAll(resp.Body)
+		content := strings.Trim(string(body), "\n")
+		assert.Equal(t, `{"error":"operation not permitted"}`, content)
+	}
+
+}
@@ -0,0 +1,225 @@
+package msgstore
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+// Types of frames exchanged over websocket connection
+const (
+	// Client sends a new message, server pushes a message event
+	frameMessage = "message"
+	// Client sends a reply, server pushes a reply event
+	frameReply = "reply"
+	// Server reports message or reply of client has been stored
+	frameCreated = "created"
+	// Server reports message or reply of client has failed
+	frameError = "error"
+)
+
+// Maximum size of a frame sent by client
+const maxFrameSize = 1 << 20
+
+// Time allowed to write a frame to client
+const frameWriteWait = 10 * time.Second
+
+// frame sent by client over websocket connection. Id is chosen by client and
+// is returned in the response to the frame.
+type wsRequest struct {
+	Id      string  `json:"id"`
+	Type    string  `json:"type"`
+	Message Message `json:"message"`
+}
+
+// frame sent by server over websocket connection, either in response to a
+// frame of client or to push an event.
+type wsResponse struct {
+	Id      string   `json:"id,omitempty"`
+	Type    string   `json:"type"`
+	MsgId   string   `json:"msgid,omitempty"`
+	Status  int      `json:"status,omitempty"`
+	Error   string   `json:"error,omitempty"`
+	Event   uint64   `json:"event,omitempty"`
+	Message *Message `json:"message,omitempty"`
+}
+
+// Handler serving websocket connections of a user, over which the user sends
+// messages and replies and gets the events of its mailbox pushed. Messages
+// and replies are stored through the same endpoints as http requests and
+// failures are reported with the same status codes. A client that reconnects
+// with the id of the last event it got in last_event_id query parameter first
+// gets the events it missed.
+type websocketHandler struct {
+	service       Service
+	createMessage endpoint.Endpoint
+	createReply   endpoint.Endpoint
+	upgrader      websocket.Upgrader
+	keepalive     time.Duration
+}
+
+func newWebsocketHandler(service Service, keepalive time.Duration) *websocketHandler {
+	return &websocketHandler{
+		service:       service,
+		createMessage: makeCreateMessageEndpoint(service),
+		createReply:   makeCreateReplyEndpoint(service),
+		keepalive:     keepalive,
+	}
+}
+
+func (h *websocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	userid := mux.Vars(r)["userid"]
+
+	var after uint64
+	if id := r.URL.Query().Get("last_event_id"); len(id) > 0 {
+		n, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			encodeError(ctx, ErrBadRequest, w)
+			return
+		}
+		after = n
+	}
+
+	events, err := h.service.SubscribeEvents(ctx, userid, after)
+	if err != nil {
+		encodeError(ctx, err, w)
+		return
+	}
+
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// upgrader has replied with an error
+		return
+	}
+	defer conn.Close()
+
+	c := &wsConnection{conn: conn}
+
+	go func() {
+		defer cancel()
+		c.push(ctx, events, h.keepalive)
+	}()
+
+	conn.SetReadLimit(maxFrameSize)
+	conn.SetReadDeadline(time.Now().Add(2 * h.keepalive))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(2 * h.keepalive))
+	})
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var req wsRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			c.write(errorFrame("", ErrBadRequest))
+			continue
+		}
+		if err := c.write(h.handle(ctx, userid, req)); err != nil {
+			return
+		}
+	}
+}
+
+// Store message or reply sent by user in given frame and get the response
+// frame.
+func (h *websocketHandler) handle(ctx context.Context, userid string, req wsRequest) wsResponse {
+	msg := req.Message
+	msg.Sender = userid
+
+	var (
+		e       endpoint.Endpoint
+		request interface{}
+	)
+	switch {
+	case req.Type == frameMessage && len(msg.Re) == 0 && validMessage(&msg):
+		e, request = h.createMessage, messageCreateRequest{msg}
+	case req.Type == frameReply && len(msg.Re) > 0 && validReply(&msg):
+		e, request = h.createReply, replyCreateRequest{msg}
+	default:
+		return errorFrame(req.Id, ErrBadRequest)
+	}
+
+	response, err := e(ctx, request)
+	if err != nil {
+		return errorFrame(req.Id, err)
+	}
+
+	var msgid string
+	switch r := response.(type) {
+	case *messageCreateResponse:
+		msgid = r.Id
+	case *replyCreateResponse:
+		msgid = r.Id
+	}
+	return wsResponse{Id: req.Id, Type: frameCreated, MsgId: msgid}
+}
+
+// Get response frame reporting given error
+func errorFrame(id string, err error) wsResponse {
+	return wsResponse{Id: id, Type: frameError, Status: errorStatus(err), Error: err.Error()}
+}
+
+// websocket connection that may be written concurrently
+type wsConnection struct {
+	mtx  sync.Mutex
+	conn *websocket.Conn
+}
+
+// Write a frame to client
+func (c *wsConnection) write(frame wsResponse) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(frameWriteWait))
+	return c.conn.WriteJSON(frame)
+}
+
+// Write a control message to client
+func (c *wsConnection) control(messageType int, data []byte) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.conn.WriteControl(messageType, data, time.Now().Add(frameWriteWait))
+}
+
+// Push events to client and ping it to keep the connection open, until
+// context is done or the subscriber is dropped.
+func (c *wsConnection) push(ctx context.Context, events <-chan Event, keepalive time.Duration) {
+	ticker := time.NewTicker(keepalive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				// subscriber has been dropped, client has to reconnect
+				c.control(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "events dropped"))
+				c.conn.Close()
+				return
+			}
+			msg := ev.Message
+			if err := c.write(wsResponse{Type: ev.Type, Event: ev.Id, Message: &msg}); err != nil {
+				c.conn.Close()
+				return
+			}
+		case <-ticker.C:
+			if err := c.control(websocket.PingMessage, nil); err != nil {
+				c.conn.Close()
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
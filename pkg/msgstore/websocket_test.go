@@ -0,0 +1,218 @@
+package msgstore
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/ghsbhatia/msgbox/pkg/middleware"
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// Test executor for websocket transport
+func TestWebsocketTransport(t *testing.T) {
+	s := &websocketTestSuite{}
+	t.Run("StoreMessage", func(t *testing.T) { s.testStoreMessage(t) })
+	t.Run("StoreReply", func(t *testing.T) { s.testStoreReply(t) })
+	t.Run("StoreMessageFailure", func(t *testing.T) { s.testStoreMessageFailure(t) })
+	t.Run("InvalidFrames", func(t *testing.T) { s.testInvalidFrames(t) })
+	t.Run("PushEvents", func(t *testing.T) { s.testPushEvents(t) })
+	t.Run("Forbidden", func(t *testing.T) { s.testForbidden(t) })
+	t.Run("AuthenticatedUpgrade", func(t *testing.T) { s.testAuthenticatedUpgrade(t) })
+}
+
+// Test suite for websocket transport
+type websocketTestSuite struct{}
+
+// Connect to websocket endpoint of given user served by given service. The
+// returned function closes the connection and the server.
+func (s *websocketTestSuite) dial(t *testing.T, service Service, path string) (*websocket.Conn, *http.Response, func()) {
+	server := httptest.NewServer(MakeHandler(service, kitlog.NewNopLogger()))
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + path
+	conn, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		server.Close()
+		return nil, resp, func() {}
+	}
+	return conn, resp, func() {
+		conn.Close()
+		server.Close()
+	}
+}
+
+// Test scenario - Send a message over websocket connection
+func (s *websocketTestSuite) testStoreMessage(t *testing.T) {
+
+	msg := Message{
+		Sender:    "tester",
+		Recipient: Receiver{Username: "user1"},
+		Subject:   "test",
+		Body:      "test message",
+	}
+
+	service := new(MockedService)
+	service.On("SubscribeEvents", "tester", uint64(0)).Return(make(chan Event), nil)
+	service.On("StoreMessage", msg).Return("id:01", nil)
+
+	conn, _, done := s.dial(t, service, "/users/tester/ws")
+	defer done()
+
+	// sender is always the user of the connection
+	sent := msg
+	sent.Sender = "other"
+	assert.NoError(t, conn.WriteJSON(wsRequest{Id: "1", Type: frameMessage, Message: sent}))
+
+	var resp wsResponse
+	assert.NoError(t, conn.ReadJSON(&resp))
+	assert.Equal(t, wsResponse{Id: "1", Type: frameCreated, MsgId: "id:01"}, resp)
+
+	service.AssertExpectations(t)
+}
+
+// Test scenario - Send a reply over websocket connection
+func (s *websocketTestSuite) testStoreReply(t *testing.T) {
+
+	msg := Message{Re: "id:01", Sender: "tester", Subject: "re:test", Body: "test reply"}
+
+	service := new(MockedService)
+	service.On("SubscribeEvents", "tester", uint64(0)).Return(make(chan Event), nil)
+	service.On("StoreMessage", msg).Return("id:02", nil)
+
+	conn, _, done := s.dial(t, service, "/users/tester/ws")
+	defer done()
+
+	assert.NoError(t, conn.WriteJSON(wsRequest{Id: "2", Type: frameReply, Message: msg}))
+
+	var resp wsResponse
+	assert.NoError(t, conn.ReadJSON(&resp))
+	assert.Equal(t, wsResponse{Id: "2", Type: frameCreated, MsgId: "id:02"}, resp)
+
+	service.AssertExpectations(t)
+}
+
+// Test scenario - Message that service fails to store is reported with http status
+func (s *websocketTestSuite) testStoreMessageFailure(t *testing.T) {
+
+	service := new(MockedService)
+	service.On("SubscribeEvents", "tester", uint64(0)).Return(make(chan Event), nil)
+	service.On("StoreMessage", mock.Anything).Return("", ErrPostingNotPermitted)
+
+	conn, _, done := s.dial(t, service, "/users/tester/ws")
+	defer done()
+
+	msg := Message{Recipient: Receiver{Groupname: "news"}, Subject: "test", Body: "test message"}
+	assert.NoError(t, conn.WriteJSON(wsRequest{Id: "3", Type: frameMessage, Message: msg}))
+
+	var resp wsResponse
+	assert.NoError(t, conn.ReadJSON(&resp))
+	exp := wsResponse{Id: "3", Type: frameError, Status: http.StatusForbidden, Error: ErrPostingNotPermitted.Error()}
+	assert.Equal(t, exp, resp)
+
+	service.AssertExpectations(t)
+}
+
+// Test scenario - Frames that are not valid messages or replies are rejected
+func (s *websocketTestSuite) testInvalidFrames(t *testing.T) {
+
+	service := new(MockedService)
+	service.On("SubscribeEvents", "tester", uint64(0)).Return(make(chan Event), nil)
+
+	conn, _, done := s.dial(t, service, "/users/tester/ws")
+	defer done()
+
+	valid := Message{Recipient: Receiver{Username: "user1"}, Subject: "test", Body: "test message"}
+	noBody := Message{Recipient: Receiver{Username: "user1"}, Subject: "test"}
+	reply := Message{Re: "id:01", Subject: "re:test", Body: "test reply"}
+
+	frames := []wsRequest{
+		{Id: "1", Type: "unknown", Message: valid},
+		{Id: "2", Type: frameMessage, Message: noBody},
+		{Id: "3", Type: frameMessage, Message: reply},
+		{Id: "4", Type: frameReply, Message: valid},
+	}
+	for _, frame := range frames {
+		assert.NoError(t, conn.WriteJSON(frame))
+		var resp wsResponse
+		assert.NoError(t, conn.ReadJSON(&resp))
+		assert.Equal(t, errorFrame(frame.Id, ErrBadRequest), resp)
+	}
+
+	assert.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte("not json")))
+	var resp wsResponse
+	assert.NoError(t, conn.ReadJSON(&resp))
+	assert.Equal(t, errorFrame("", ErrBadRequest), resp)
+
+	service.AssertExpectations(t)
+}
+
+// Test scenario - Events of user are pushed resuming after last event id
+func (s *websocketTestSuite) testPushEvents(t *testing.T) {
+
+	events := make(chan Event, 1)
+	events <- Event{Id: 43, Type: eventMessage, Message: Message{Id: "id:01", Sender: "user2", Unread: true}}
+
+	service := new(MockedService)
+	service.On("SubscribeEvents", "tester", uint64(42)).Return(events, nil)
+
+	conn, _, done := s.dial(t, service, "/users/tester/ws?last_event_id=42")
+	defer done()
+
+	var resp wsResponse
+	assert.NoError(t, conn.ReadJSON(&resp))
+	exp := wsResponse{Type: frameMessage, Event: 43, Message: &Message{Id: "id:01", Sender: "user2", Unread: true}}
+	assert.Equal(t, exp, resp)
+
+	// connection is closed when subscriber is dropped
+	close(events)
+	_, _, err := conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseTryAgainLater))
+
+	service.AssertExpectations(t)
+}
+
+// Test scenario - Connection for mailbox of another user is refused
+func (s *websocketTestSuite) testForbidden(t *testing.T) {
+
+	service := new(MockedService)
+	service.On("SubscribeEvents", "tester", uint64(0)).Return(nil, ErrForbidden)
+
+	conn, resp, done := s.dial(t, service, "/users/tester/ws")
+	defer done()
+
+	assert.Nil(t, conn)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	service.AssertExpectations(t)
+}
+
+// Test scenario - Connect with the token in the url, as browsers do, when
+// requests are authenticated
+func (s *websocketTestSuite) testAuthenticatedUpgrade(t *testing.T) {
+
+	key := []byte("secret")
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{Subject: "tester"}).SignedString(key)
+
+	service := new(MockedService)
+	service.On("SubscribeEvents", "tester", uint64(0)).Return(make(chan Event), nil)
+
+	handler := middleware.NewHTTPAuthenticator(MakeHandler(service, kitlog.NewNopLogger()), key, kitlog.NewNopLogger())
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/users/tester/ws"
+
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	conn, resp, err := websocket.DefaultDialer.Dial(url+"?access_token="+token, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	conn.Close()
+
+	service.AssertExpectations(t)
+}
@@ -8,49 +8,134 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"time"
 
+	"github.com/ghsbhatia/msgbox/pkg/middleware"
+	"github.com/go-kit/kit/endpoint"
 	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/sony/gobreaker"
 )
 
+// Error reported when the service can not be reached, fails with a server
+// error after all attempts or is cut off by the circuit breaker. Requests
+// abandoned because their context is done report the error of the context.
+var ErrUnavailable = errors.New("upstream service unavailable")
+
 // Abstraction for HTTP Service Access for json content
 type HttpServiceClient interface {
 	// Send Http Get Request to given endpoint and unmarshal the Response
-	// to given type.
-	Get(string, interface{}) error
+	// to given type. The request is abandoned when the context is done.
+	Get(context.Context, string, interface{}) error
+}
+
+// Option to configure HttpServiceClient
+type ClientOption func(*httpserviceClient)
+
+// Timeout applied to each attempt of a request in addition to the deadline of
+// request context. Zero means requests are bound only by their context.
+func Timeout(timeout time.Duration) ClientOption {
+	return func(c *httpserviceClient) {
+		c.timeout = timeout
+	}
+}
+
+// Retry a failed request up to given number of attempts in total. The wait
+// before each retry starts at given backoff and doubles with every attempt.
+// Only requests that could not be sent or failed with a server error are
+// retried.
+func Retry(attempts int, backoff time.Duration) ClientOption {
+	return func(c *httpserviceClient) {
+		c.attempts = attempts
+		c.backoff = backoff
+	}
+}
+
+// Circuit breaker that opens after given number of consecutive failed requests
+// and rejects requests without sending them until given timeout has passed.
+func CircuitBreaker(failures uint32, timeout time.Duration) ClientOption {
+	return func(c *httpserviceClient) {
+		c.breaker = gobreaker.NewTwoStepCircuitBreaker(gobreaker.Settings{
+			Name:    "svcclient",
+			Timeout: timeout,
+			ReadyToTrip: func(counts gobreaker.Counts) bool {
+				return counts.ConsecutiveFailures >= failures
+			},
+		})
+	}
 }
 
 // Get a new instance of HttpServiceClient
-func NewHttpClient() HttpServiceClient {
-	return &httpserviceClient{}
+func NewHttpClient(options ...ClientOption) HttpServiceClient {
+	client := &httpserviceClient{attempts: 1}
+	for _, option := range options {
+		option(client)
+	}
+	return client
 }
 
 // HttpServiceClient implementation
 type httpserviceClient struct {
+	timeout  time.Duration
+	attempts int
+	backoff  time.Duration
+	breaker  *gobreaker.TwoStepCircuitBreaker
 }
 
-func (s *httpserviceClient) Get(svcurl string, v interface{}) error {
-	encode := func(context.Context, *http.Request, interface{}) error {
+// Response of service that was reached, with status code and content
+type httpResponse struct {
+	status int
+	body   []byte
+}
+
+func (s *httpserviceClient) Get(ctx context.Context, svcurl string, v interface{}) error {
+	// Calls made on behalf of an authenticated request carry its token
+	encode := func(ctx context.Context, r *http.Request, _ interface{}) error {
+		if token := middleware.Token(ctx); len(token) > 0 {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
 		return nil
 	}
 
+	// Only server errors fail the endpoint, so that a missing resource
+	// neither trips the breaker nor is retried.
 	decode := func(_ context.Context, r *http.Response) (interface{}, error) {
-		if r.StatusCode != http.StatusOK {
+		if r.StatusCode >= http.StatusInternalServerError {
 			return nil, errors.New(fmt.Sprintf("%d", r.StatusCode))
 		}
 		body, err := ioutil.ReadAll(r.Body)
-		return body, err
+		return httpResponse{r.StatusCode, body}, err
 	}
 
-	endpoint, _ := url.Parse(svcurl)
-	client := kithttp.NewClient("GET", endpoint, encode, decode)
-
-	res, err := client.Endpoint()(context.Background(), struct{}{})
+	target, err := url.Parse(svcurl)
 	if err != nil {
 		return err
 	}
+	client := kithttp.NewClient("GET", target, encode, decode)
+
+	res, err := s.endpoint(client.Endpoint())(ctx, struct{}{})
+	if err != nil {
+		// A request abandoned by its caller says nothing about the service
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return ErrUnavailable
+	}
+
+	response, _ := res.(httpResponse)
+	if response.status != http.StatusOK {
+		return errors.New(fmt.Sprintf("%d", response.status))
+	}
 
-	bytearray, _ := res.([]byte)
-	err = json.Unmarshal(bytearray, v)
+	return json.Unmarshal(response.body, v)
+}
 
-	return err
+// Wrap endpoint with timeout of each attempt, circuit breaker and retries.
+func (s *httpserviceClient) endpoint(e endpoint.Endpoint) endpoint.Endpoint {
+	if s.timeout > 0 {
+		e = timeout(s.timeout)(e)
+	}
+	if s.breaker != nil {
+		e = breaker(s.breaker)(e)
+	}
+	return retry(s.attempts, s.backoff)(e)
 }
@@ -0,0 +1,256 @@
+package svcclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sony/gobreaker"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test executor for http service client
+func TestHttpServiceClient(t *testing.T) {
+	s := &clientTestSuite{}
+	t.Run("Get", func(t *testing.T) { s.testGet(t) })
+	t.Run("GetNotFound", func(t *testing.T) { s.testGetNotFound(t) })
+	t.Run("GetTimeout", func(t *testing.T) { s.testGetTimeout(t) })
+	t.Run("GetCancelled", func(t *testing.T) { s.testGetCancelled(t) })
+	t.Run("GetRetry", func(t *testing.T) { s.testGetRetry(t) })
+	t.Run("GetUnavailable", func(t *testing.T) { s.testGetUnavailable(t) })
+	t.Run("GetNotFoundNotRetried", func(t *testing.T) { s.testGetNotFoundNotRetried(t) })
+	t.Run("GetCircuitOpen", func(t *testing.T) { s.testGetCircuitOpen(t) })
+	t.Run("GetCancelledNotCounted", func(t *testing.T) { s.testGetCancelledNotCounted(t) })
+	t.Run("GetCancelledProbe", func(t *testing.T) { s.testGetCancelledProbe(t) })
+}
+
+// Test suite for http service client
+type clientTestSuite struct{}
+
+// Test scenario - Get json content
+func (s *clientTestSuite) testGet(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":"alice"}`))
+	}))
+	defer server.Close()
+
+	var user struct {
+		Id string `json:"id"`
+	}
+	err := NewHttpClient().Get(context.TODO(), server.URL+"/users/alice", &user)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", user.Id)
+}
+
+// Test scenario - Get content that does not exist
+func (s *clientTestSuite) testGetNotFound(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	var user struct{}
+	err := NewHttpClient().Get(context.TODO(), server.URL+"/users/alice", &user)
+
+	assert.EqualError(t, err, "404")
+}
+
+// Test scenario - Get content from a service that does not respond in time
+func (s *clientTestSuite) testGetTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	var user struct{}
+	begin := time.Now()
+	err := NewHttpClient(Timeout(50*time.Millisecond)).Get(context.TODO(), server.URL+"/users/alice", &user)
+
+	assert.Error(t, err)
+	assert.True(t, time.Since(begin) < time.Second)
+}
+
+// Test scenario - Get content with a request context that is cancelled
+func (s *clientTestSuite) testGetCancelled(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+	defer cancel()
+
+	var user struct{}
+	begin := time.Now()
+	err := NewHttpClient().Get(ctx, server.URL+"/users/alice", &user)
+
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, time.Since(begin) < time.Second)
+}
+
+// Test scenario - Get content from a service that recovers after server errors
+func (s *clientTestSuite) testGetRetry(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"id":"alice"}`))
+	}))
+	defer server.Close()
+
+	var user struct {
+		Id string `json:"id"`
+	}
+	err := NewHttpClient(Retry(3, time.Millisecond)).Get(context.TODO(), server.URL+"/users/alice", &user)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", user.Id)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+// Test scenario - Get content from a service that keeps failing
+func (s *clientTestSuite) testGetUnavailable(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	var user struct{}
+	err := NewHttpClient(Retry(3, time.Millisecond)).Get(context.TODO(), server.URL+"/users/alice", &user)
+
+	assert.Equal(t, ErrUnavailable, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+// Test scenario - Get content that does not exist is not attempted again
+func (s *clientTestSuite) testGetNotFoundNotRetried(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	client := NewHttpClient(Retry(3, time.Millisecond), CircuitBreaker(1, time.Minute))
+
+	var user struct{}
+	for i := 0; i < 2; i++ {
+		err := client.Get(context.TODO(), server.URL+"/users/alice", &user)
+		assert.EqualError(t, err, "404")
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+// Test scenario - Get content from a failing service once the breaker is open
+func (s *clientTestSuite) testGetCircuitOpen(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	client := NewHttpClient(Retry(5, time.Millisecond), CircuitBreaker(2, time.Minute))
+
+	var user struct{}
+	err := client.Get(context.TODO(), server.URL+"/users/alice", &user)
+	assert.Equal(t, ErrUnavailable, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	err = client.Get(context.TODO(), server.URL+"/users/alice", &user)
+	assert.Equal(t, ErrUnavailable, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+// Test scenario - Get content with cancelled requests neither retries them nor
+// opens the breaker
+func (s *clientTestSuite) testGetCancelledNotCounted(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= 2 {
+			<-release
+		}
+		w.Write([]byte(`{"id":"alice"}`))
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := NewHttpClient(Retry(3, time.Millisecond), CircuitBreaker(2, time.Minute))
+
+	var user struct {
+		Id string `json:"id"`
+	}
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithCancel(context.TODO())
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			cancel()
+		}()
+		err := client.Get(ctx, server.URL+"/users/alice", &user)
+		assert.Equal(t, context.Canceled, err)
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	err := client.Get(context.TODO(), server.URL+"/users/alice", &user)
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", user.Id)
+}
+
+// Test scenario - Get content with a request cancelled while the breaker is
+// half-open neither closes nor opens the breaker
+func (s *clientTestSuite) testGetCancelledProbe(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&calls, 1) {
+		case 1:
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		case 2:
+			<-release
+		}
+		w.Write([]byte(`{"id":"alice"}`))
+	}))
+	defer server.Close()
+
+	client := NewHttpClient(CircuitBreaker(1, 10*time.Millisecond))
+	cb := client.(*httpserviceClient).breaker
+
+	var user struct {
+		Id string `json:"id"`
+	}
+	err := client.Get(context.TODO(), server.URL+"/users/alice", &user)
+	assert.Equal(t, ErrUnavailable, err)
+	assert.Equal(t, gobreaker.StateOpen, cb.State())
+
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, gobreaker.StateHalfOpen, cb.State())
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	err = client.Get(ctx, server.URL+"/users/alice", &user)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, gobreaker.StateHalfOpen, cb.State())
+
+	// the probe is decided by the answer of service, not by its caller
+	close(release)
+	assert.Eventually(t, func() bool { return cb.State() == gobreaker.StateClosed }, time.Second, 5*time.Millisecond)
+
+	err = client.Get(context.TODO(), server.URL+"/users/alice", &user)
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", user.Id)
+}
@@ -0,0 +1,102 @@
+package svcclient
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/sony/gobreaker"
+)
+
+// Endpoint middleware that bounds each call by given timeout.
+func timeout(d time.Duration) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			ctx, cancel := context.WithTimeout(ctx, d)
+			defer cancel()
+			return next(ctx, request)
+		}
+	}
+}
+
+// Endpoint middleware that calls the endpoint up to given number of attempts
+// until it succeeds, waiting with exponential backoff between attempts. It
+// gives up early when the circuit breaker is open or the context of caller is
+// done.
+func retry(attempts int, backoff time.Duration) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			wait := backoff
+			for attempt := 1; ; attempt++ {
+				response, err = next(ctx, request)
+				if err == nil || attempt >= attempts || !retryable(err) || ctx.Err() != nil {
+					return response, err
+				}
+				select {
+				case <-time.After(wait):
+					wait *= 2
+				case <-ctx.Done():
+					return nil, err
+				}
+			}
+		}
+	}
+}
+
+// Endpoint middleware that guards calls with given circuit breaker. Calls that
+// fail because the context of caller is done are not held against the service,
+// nor taken as a sign that it recovered.
+func breaker(cb *gobreaker.TwoStepCircuitBreaker) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			done, err := cb.Allow()
+			if err != nil {
+				return nil, err
+			}
+			// A half-open breaker lets no other call through until its probe
+			// reports back, so the probe runs to the end even when its caller
+			// gives up.
+			if cb.State() == gobreaker.StateHalfOpen {
+				return probe(ctx, next, request, done)
+			}
+			response, err := next(ctx, request)
+			if ctx.Err() == nil {
+				done(err == nil)
+			}
+			return response, err
+		}
+	}
+}
+
+// Call endpoint apart from the context of caller and report its outcome to the
+// breaker. Caller gets the error of its context when it is done first.
+func probe(ctx context.Context, next endpoint.Endpoint, request interface{}, done func(bool)) (interface{}, error) {
+	type result struct {
+		response interface{}
+		err      error
+	}
+	results := make(chan result, 1)
+	go func() {
+		response, err := next(detachedContext{ctx}, request)
+		done(err == nil)
+		results <- result{response, err}
+	}()
+	select {
+	case r := <-results:
+		return r.response, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Context that carries the values of its parent but is never done
+type detachedContext struct{ context.Context }
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+// Check if a failed call may succeed when attempted again.
+func retryable(err error) bool {
+	return err != gobreaker.ErrOpenState && err != gobreaker.ErrTooManyRequests
+}
@@ -0,0 +1,39 @@
+// Package api holds the types and values of user admin service requests and
+// responses that other services decode. It has no dependencies, so that they
+// need not link the user admin service itself.
+package api
+
+// UserDetails of a registered user as returned by the service
+type UserDetails struct {
+	Id          string            `json:"id"`
+	DisplayName string            `json:"displayName,omitempty"`
+	Email       string            `json:"email,omitempty"`
+	CreatedAt   string            `json:"createdAt,omitempty"`
+	Attributes  map[string]string `json:"attributes,omitempty"`
+	Deactivated bool              `json:"deactivated,omitempty"`
+	Role        string            `json:"role,omitempty"`
+}
+
+// GroupDetails of a registered group with its users and posting policy
+type GroupDetails struct {
+	Groupname  string   `json:"groupname"`
+	Usernames  []string `json:"usernames"`
+	Policy     string   `json:"policy,omitempty"`
+	Moderators []string `json:"moderators,omitempty"`
+}
+
+// Roles of users. Admins manage users and groups and may post to any group.
+const (
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+)
+
+// Posting policies of groups
+const (
+	// any registered user may post to the group
+	PolicyOpen = "open"
+	// only members of the group may post to it
+	PolicyMembers = "members"
+	// only moderators of the group may post to it
+	PolicyAnnounce = "announce"
+)
@@ -0,0 +1,62 @@
+package useradmin
+
+import (
+	"encoding/base64"
+	"strings"
+)
+
+// Query of a page of users or groups listed by name
+type ListQuery struct {
+	Prefix     string // only names starting with prefix are listed
+	Limit      int    // maximum number of names on page, all when zero
+	Cursor     string // cursor of page as returned with previous page
+	Descending bool   // list names in descending instead of ascending order
+}
+
+// Encode last name on a page into an opaque page cursor.
+func encodeCursor(name string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(name))
+}
+
+// Decode an opaque page cursor into last name on the previous page.
+func decodeCursor(cursor string) (string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(data) == 0 {
+		return "", ErrBadRequest
+	}
+	return string(data), nil
+}
+
+// Check if name is selected by query, given the last name on previous page.
+func inListing(name string, query ListQuery, after string) bool {
+	if !strings.HasPrefix(name, query.Prefix) {
+		return false
+	}
+	if len(after) == 0 {
+		return true
+	}
+	if query.Descending {
+		return name < after
+	}
+	return name > after
+}
+
+// Trim users fetched as one more than limit to a page and get the cursor of
+// next page, which is empty on the last page.
+func userPageOf(users []User, limit int) ([]User, string) {
+	if limit <= 0 || len(users) <= limit {
+		return users, ""
+	}
+	users = users[:limit]
+	return users, encodeCursor(users[limit-1].Name)
+}
+
+// Trim names fetched as one more than limit to a page and get the cursor of
+// next page, which is empty on the last page.
+func pageOf(names []string, limit int) ([]string, string) {
+	if limit <= 0 || len(names) <= limit {
+		return names, ""
+	}
+	names = names[:limit]
+	return names, encodeCursor(names[limit-1])
+}
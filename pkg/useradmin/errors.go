@@ -10,3 +10,5 @@ var ErrUserNotFound = errors.New("user not found")
 var ErrGroupExists = errors.New("group with the same groupname already registered")
 var ErrGroupNotFound = errors.New("group not found")
 var ErrGroupEmpty = errors.New("group has no users")
+var ErrNotGroupMember = errors.New("user is not a member of the group")
+var ErrForbidden = errors.New("operation not permitted")
@@ -0,0 +1,176 @@
+package useradmin
+
+import (
+	"context"
+	"net/http"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/transport"
+	kitgrpc "github.com/go-kit/kit/transport/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/ghsbhatia/msgbox/pkg/useradmin/pb"
+)
+
+// Create grpc server for servicing useradmin requests. Requests are served by
+// the same endpoints as http requests and failures are reported with grpc
+// status codes corresponding to their http status codes.
+func MakeGRPCServer(service Service, logger kitlog.Logger) pb.UserAdminServer {
+
+	opts := []kitgrpc.ServerOption{
+		kitgrpc.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
+	}
+
+	return &grpcServer{
+		registerUser: kitgrpc.NewServer(
+			makeUserRegistrationEndpoint(service),
+			decodeGRPCRegisterUserRequest,
+			encodeGRPCRegisterUserResponse,
+			opts...,
+		),
+		getUser: kitgrpc.NewServer(
+			makeUserQueryEndpoint(service),
+			decodeGRPCGetUserRequest,
+			encodeGRPCGetUserResponse,
+			opts...,
+		),
+		registerGroup: kitgrpc.NewServer(
+			makeGroupRegistrationEndpoint(service),
+			decodeGRPCRegisterGroupRequest,
+			encodeGRPCRegisterGroupResponse,
+			opts...,
+		),
+		getGroupUsers: kitgrpc.NewServer(
+			makeGroupQueryEndpoint(service),
+			decodeGRPCGetGroupUsersRequest,
+			encodeGRPCGetGroupUsersResponse,
+			opts...,
+		),
+	}
+}
+
+type grpcServer struct {
+	registerUser  kitgrpc.Handler
+	getUser       kitgrpc.Handler
+	registerGroup kitgrpc.Handler
+	getGroupUsers kitgrpc.Handler
+}
+
+func (s *grpcServer) RegisterUser(ctx context.Context, req *pb.RegisterUserRequest) (*pb.RegisterUserReply, error) {
+	_, rep, err := s.registerUser.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return rep.(*pb.RegisterUserReply), nil
+}
+
+func (s *grpcServer) GetUser(ctx context.Context, req *pb.GetUserRequest) (*pb.GetUserReply, error) {
+	_, rep, err := s.getUser.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return rep.(*pb.GetUserReply), nil
+}
+
+func (s *grpcServer) RegisterGroup(ctx context.Context, req *pb.RegisterGroupRequest) (*pb.RegisterGroupReply, error) {
+	_, rep, err := s.registerGroup.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return rep.(*pb.RegisterGroupReply), nil
+}
+
+func (s *grpcServer) GetGroupUsers(ctx context.Context, req *pb.GetGroupUsersRequest) (*pb.GetGroupUsersReply, error) {
+	_, rep, err := s.getGroupUsers.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return rep.(*pb.GetGroupUsersReply), nil
+}
+
+func decodeGRPCRegisterUserRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.RegisterUserRequest)
+	registration := userRegistrationRequest{
+		Username:    req.Username,
+		DisplayName: req.DisplayName,
+		Email:       req.Email,
+		Attributes:  req.Attributes,
+	}
+	if !validRegistration(&registration) {
+		return nil, ErrBadRequest
+	}
+	return registration, nil
+}
+
+func encodeGRPCRegisterUserResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(*userRegistrationResponse)
+	return &pb.RegisterUserReply{User: pbUserOf(resp.UserDetails)}, nil
+}
+
+func decodeGRPCGetUserRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.GetUserRequest)
+	return userQueryRequest{req.Username}, nil
+}
+
+func encodeGRPCGetUserResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(*userQueryResponse)
+	return &pb.GetUserReply{User: pbUserOf(resp.UserDetails)}, nil
+}
+
+func decodeGRPCRegisterGroupRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.RegisterGroupRequest)
+	if req.Groupname == "" || len(req.Usernames) == 0 {
+		return nil, ErrBadRequest
+	}
+	return groupRegistrationRequest{req.Groupname, req.Usernames}, nil
+}
+
+func encodeGRPCRegisterGroupResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(*groupRegistrationResponse)
+	return &pb.RegisterGroupReply{Id: resp.Id}, nil
+}
+
+func decodeGRPCGetGroupUsersRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.GetGroupUsersRequest)
+	return groupQueryRequest{req.Groupname}, nil
+}
+
+func encodeGRPCGetGroupUsersResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(*groupQueryResponse)
+	return &pb.GetGroupUsersReply{
+		Groupname:  resp.Groupname,
+		Usernames:  resp.Usernames,
+		Policy:     resp.Policy,
+		Moderators: resp.Moderators,
+	}, nil
+}
+
+// Get grpc status error for request execution error
+func grpcError(err error) error {
+	var code codes.Code
+	switch errorStatus(err) {
+	case http.StatusConflict:
+		code = codes.AlreadyExists
+	case http.StatusNotFound:
+		code = codes.NotFound
+	case http.StatusForbidden:
+		code = codes.PermissionDenied
+	default:
+		code = codes.InvalidArgument
+	}
+	return status.Error(code, err.Error())
+}
+
+// Map transport user structure to protobuf user
+func pbUserOf(u UserDetails) *pb.User {
+	return &pb.User{
+		Id:          u.Id,
+		DisplayName: u.DisplayName,
+		Email:       u.Email,
+		CreatedAt:   u.CreatedAt,
+		Attributes:  u.Attributes,
+		Deactivated: u.Deactivated,
+		Role:        u.Role,
+	}
+}
@@ -0,0 +1,162 @@
+package useradmin
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/matryer/is"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/ghsbhatia/msgbox/pkg/middleware"
+	"github.com/ghsbhatia/msgbox/pkg/useradmin/pb"
+)
+
+// Test executor for grpc transport
+func TestGRPC(t *testing.T) {
+	s := &grpcTestSuite{}
+	t.Run("RegisterUser", func(t *testing.T) { s.testRegisterUser(t) })
+	t.Run("RegisterUserInvalid", func(t *testing.T) { s.testRegisterUserInvalid(t) })
+	t.Run("GetUserNotFound", func(t *testing.T) { s.testGetUserNotFound(t) })
+	t.Run("RegisterGroup", func(t *testing.T) { s.testRegisterGroup(t) })
+	t.Run("RegisterGroupForbidden", func(t *testing.T) { s.testRegisterGroupForbidden(t) })
+}
+
+// Test suite for grpc transport
+type grpcTestSuite struct{}
+
+// Connect a client to grpc server over a repository with admin alice and
+// member bob. Requests are made on behalf of given subject, or are
+// unauthenticated when the subject is empty. The returned function closes
+// the connection and the server.
+func (s *grpcTestSuite) dial(t *testing.T, subject string) (pb.UserAdminClient, func()) {
+	ctx := context.TODO()
+	repository := NewInMemoryUserRepository()
+	repository.StoreUser(ctx, User{Name: "alice", Role: RoleAdmin})
+	repository.StoreUser(ctx, User{Name: "bob"})
+
+	authenticated := func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if len(subject) > 0 {
+			ctx = middleware.NewAuthContext(ctx, subject, "token")
+		}
+		return handler(ctx, req)
+	}
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(grpc.UnaryInterceptor(authenticated))
+	pb.RegisterUserAdminServer(server, MakeGRPCServer(NewService(repository), kitlog.NewNopLogger()))
+	go server.Serve(listener)
+
+	dialer := func(context.Context, string) (net.Conn, error) { return listener.Dial() }
+	conn, err := grpc.Dial("bufnet", grpc.WithContextDialer(dialer), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pb.NewUserAdminClient(conn), func() {
+		conn.Close()
+		server.Stop()
+	}
+}
+
+// Test scenario - Register a user and get it
+func (s *grpcTestSuite) testRegisterUser(t *testing.T) {
+
+	is := is.New(t)
+
+	client, done := s.dial(t, "")
+	defer done()
+
+	registered, err := client.RegisterUser(context.TODO(), &pb.RegisterUserRequest{
+		Username:    "carol",
+		DisplayName: "Carol",
+		Email:       "carol@example.com",
+		Attributes:  map[string]string{"team": "sales"},
+	})
+	is.NoErr(err)
+	is.Equal(registered.User.Id, "carol")
+	is.Equal(registered.User.Email, "carol@example.com")
+
+	found, err := client.GetUser(context.TODO(), &pb.GetUserRequest{Username: "carol"})
+	is.NoErr(err)
+	is.Equal(found.User.DisplayName, "Carol")
+	is.Equal(found.User.Attributes["team"], "sales")
+	is.Equal(found.User.Role, RoleMember)
+
+	_, err = client.RegisterUser(context.TODO(), &pb.RegisterUserRequest{Username: "carol"})
+	is.Equal(status.Code(err), codes.AlreadyExists)
+}
+
+// Test scenario - Registrations without username or with invalid email are rejected
+func (s *grpcTestSuite) testRegisterUserInvalid(t *testing.T) {
+
+	is := is.New(t)
+
+	client, done := s.dial(t, "")
+	defer done()
+
+	_, err := client.RegisterUser(context.TODO(), &pb.RegisterUserRequest{})
+	is.Equal(status.Code(err), codes.InvalidArgument)
+
+	_, err = client.RegisterUser(context.TODO(), &pb.RegisterUserRequest{Username: "carol", Email: "carol"})
+	is.Equal(status.Code(err), codes.InvalidArgument)
+}
+
+// Test scenario - User that is not registered is not found
+func (s *grpcTestSuite) testGetUserNotFound(t *testing.T) {
+
+	is := is.New(t)
+
+	client, done := s.dial(t, "")
+	defer done()
+
+	_, err := client.GetUser(context.TODO(), &pb.GetUserRequest{Username: "carol"})
+	is.Equal(status.Code(err), codes.NotFound)
+	is.Equal(status.Convert(err).Message(), ErrUserNotFound.Error())
+}
+
+// Test scenario - Register a group and get its users
+func (s *grpcTestSuite) testRegisterGroup(t *testing.T) {
+
+	is := is.New(t)
+
+	client, done := s.dial(t, "alice")
+	defer done()
+
+	registered, err := client.RegisterGroup(context.TODO(), &pb.RegisterGroupRequest{
+		Groupname: "engineering",
+		Usernames: []string{"alice", "bob"},
+	})
+	is.NoErr(err)
+	is.True(registered.Id != "")
+
+	group, err := client.GetGroupUsers(context.TODO(), &pb.GetGroupUsersRequest{Groupname: "engineering"})
+	is.NoErr(err)
+	is.Equal(group.Groupname, "engineering")
+	is.Equal(group.Usernames, []string{"alice", "bob"})
+
+	_, err = client.RegisterGroup(context.TODO(), &pb.RegisterGroupRequest{Groupname: "sales"})
+	is.Equal(status.Code(err), codes.InvalidArgument)
+
+	_, err = client.GetGroupUsers(context.TODO(), &pb.GetGroupUsersRequest{Groupname: "sales"})
+	is.Equal(status.Code(err), codes.NotFound)
+}
+
+// Test scenario - Only admins register groups
+func (s *grpcTestSuite) testRegisterGroupForbidden(t *testing.T) {
+
+	is := is.New(t)
+
+	client, done := s.dial(t, "bob")
+	defer done()
+
+	_, err := client.RegisterGroup(context.TODO(), &pb.RegisterGroupRequest{
+		Groupname: "engineering",
+		Usernames: []string{"bob"},
+	})
+	is.Equal(status.Code(err), codes.PermissionDenied)
+}
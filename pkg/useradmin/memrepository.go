@@ -0,0 +1,335 @@
+package useradmin
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// Get a new instance of in-memory user repository. The repository enforces the
+// same constraints as the database schema: user and group names are unique and
+// group members must be registered users. Content is lost when the process
+// terminates.
+func NewInMemoryUserRepository() UserRepository {
+	return &inMemoryUserRepository{
+		users:      make(map[string]*User),
+		groups:     make(map[string][]string),
+		policies:   make(map[string]string),
+		moderators: make(map[string][]string),
+	}
+}
+
+type inMemoryUserRepository struct {
+	mtx        sync.RWMutex
+	users      map[string]*User
+	groups     map[string][]string // members keyed by group name
+	policies   map[string]string   // posting policy keyed by group name
+	moderators map[string][]string // moderators keyed by group name
+}
+
+func (r *inMemoryUserRepository) StoreUser(ctx context.Context, user User) (string, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if _, exists := r.users[user.Name]; exists {
+		return "", ErrUserExists
+	}
+	user = copyUser(user)
+	if len(user.Role) == 0 {
+		user.Role = RoleMember
+	}
+	r.users[user.Name] = &user
+	return user.Name, nil
+}
+
+func (r *inMemoryUserRepository) FindUser(ctx context.Context, username string) (bool, error) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	_, exists := r.users[username]
+	return exists, nil
+}
+
+func (r *inMemoryUserRepository) FetchUser(ctx context.Context, username string) (User, error) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	user, exists := r.users[username]
+	if !exists {
+		return User{}, ErrUserNotFound
+	}
+	return copyUser(*user), nil
+}
+
+func (r *inMemoryUserRepository) SetUserDeactivated(ctx context.Context, username string, deactivated bool) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	user, exists := r.users[username]
+	if !exists {
+		return ErrUserNotFound
+	}
+	user.Deactivated = deactivated
+	return nil
+}
+
+func (r *inMemoryUserRepository) SetUserRole(ctx context.Context, username string, role string) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	user, exists := r.users[username]
+	if !exists {
+		return ErrUserNotFound
+	}
+	user.Role = role
+	return nil
+}
+
+func (r *inMemoryUserRepository) DeleteUser(ctx context.Context, username string) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if _, exists := r.users[username]; !exists {
+		return ErrUserNotFound
+	}
+	for groupname, members := range r.groups {
+		r.groups[groupname] = remove(members, username)
+		r.moderators[groupname] = remove(r.moderators[groupname], username)
+	}
+	delete(r.users, username)
+	return nil
+}
+
+func (r *inMemoryUserRepository) ListUsers(ctx context.Context, query ListQuery) ([]User, string, error) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	names := make([]string, 0, len(r.users))
+	for name := range r.users {
+		names = append(names, name)
+	}
+	names, err := listing(names, query)
+	if err != nil {
+		return nil, "", err
+	}
+	users := make([]User, 0, len(names))
+	for _, name := range names {
+		users = append(users, copyUser(*r.users[name]))
+	}
+	users, next := userPageOf(users, query.Limit)
+	return users, next, nil
+}
+
+func (r *inMemoryUserRepository) FetchUserGroups(ctx context.Context, username string) ([]string, error) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	groups := make([]string, 0)
+	for groupname, members := range r.groups {
+		if contains(members, username) {
+			groups = append(groups, groupname)
+		}
+	}
+	sort.Strings(groups)
+	return groups, nil
+}
+
+func (r *inMemoryUserRepository) StoreGroup(ctx context.Context, groupname string, usernames []string) (string, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if _, exists := r.groups[groupname]; exists {
+		return "", ErrGroupExists
+	}
+	for _, username := range usernames {
+		if _, exists := r.users[username]; !exists {
+			return "", ErrUserNotFound
+		}
+	}
+	r.groups[groupname] = append([]string{}, usernames...)
+	r.policies[groupname] = PolicyOpen
+	r.moderators[groupname] = []string{}
+	return groupname, nil
+}
+
+func (r *inMemoryUserRepository) FindGroup(ctx context.Context, groupname string) (bool, error) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	_, exists := r.groups[groupname]
+	return exists, nil
+}
+
+func (r *inMemoryUserRepository) FetchGroupUsers(ctx context.Context, groupname string) ([]string, error) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	users := make([]string, 0)
+	return append(users, r.groups[groupname]...), nil
+}
+
+func (r *inMemoryUserRepository) FetchGroup(ctx context.Context, groupname string) (Group, error) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	members, exists := r.groups[groupname]
+	if !exists {
+		return Group{}, ErrGroupNotFound
+	}
+	return Group{
+		Name:       groupname,
+		Policy:     r.policies[groupname],
+		Members:    append([]string{}, members...),
+		Moderators: append([]string{}, r.moderators[groupname]...),
+	}, nil
+}
+
+func (r *inMemoryUserRepository) SetGroupPolicy(ctx context.Context, groupname string, policy string) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if _, exists := r.groups[groupname]; !exists {
+		return ErrGroupNotFound
+	}
+	r.policies[groupname] = policy
+	return nil
+}
+
+func (r *inMemoryUserRepository) SetGroupModerator(ctx context.Context, groupname string, username string, moderator bool) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	members, exists := r.groups[groupname]
+	if !exists {
+		return ErrGroupNotFound
+	}
+	if !contains(members, username) {
+		return ErrNotGroupMember
+	}
+	moderators := remove(r.moderators[groupname], username)
+	if moderator {
+		moderators = append(moderators, username)
+	}
+	r.moderators[groupname] = moderators
+	return nil
+}
+
+func (r *inMemoryUserRepository) ListGroups(ctx context.Context, query ListQuery) ([]string, string, error) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	names := make([]string, 0, len(r.groups))
+	for name := range r.groups {
+		names = append(names, name)
+	}
+	names, err := listing(names, query)
+	if err != nil {
+		return nil, "", err
+	}
+	names, next := pageOf(names, query.Limit)
+	return names, next, nil
+}
+
+func (r *inMemoryUserRepository) AddGroupUsers(ctx context.Context, groupname string, usernames []string) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	members, exists := r.groups[groupname]
+	if !exists {
+		return ErrGroupNotFound
+	}
+	for _, username := range usernames {
+		if _, exists := r.users[username]; !exists {
+			return ErrUserNotFound
+		}
+	}
+	for _, username := range usernames {
+		if !contains(members, username) {
+			members = append(members, username)
+		}
+	}
+	r.groups[groupname] = members
+	return nil
+}
+
+func (r *inMemoryUserRepository) RemoveGroupUser(ctx context.Context, groupname string, username string) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	members, exists := r.groups[groupname]
+	if !exists {
+		return ErrGroupNotFound
+	}
+	if !contains(members, username) {
+		return ErrNotGroupMember
+	}
+	r.groups[groupname] = remove(members, username)
+	r.moderators[groupname] = remove(r.moderators[groupname], username)
+	return nil
+}
+
+func (r *inMemoryUserRepository) DeleteGroup(ctx context.Context, groupname string) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if _, exists := r.groups[groupname]; !exists {
+		return ErrGroupNotFound
+	}
+	delete(r.groups, groupname)
+	delete(r.policies, groupname)
+	delete(r.moderators, groupname)
+	return nil
+}
+
+func (r *inMemoryUserRepository) Purge(ctx context.Context) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.users = make(map[string]*User)
+	r.groups = make(map[string][]string)
+	r.policies = make(map[string]string)
+	r.moderators = make(map[string][]string)
+	return nil
+}
+
+// Copy a user so that callers do not share attributes with the repository.
+func copyUser(user User) User {
+	if user.Attributes != nil {
+		attributes := make(map[string]string, len(user.Attributes))
+		for name, value := range user.Attributes {
+			attributes[name] = value
+		}
+		user.Attributes = attributes
+	}
+	return user
+}
+
+// Select and sort names for given query, with one more name than limit to tell
+// if there is a next page.
+func listing(names []string, query ListQuery) ([]string, error) {
+	var after string
+	if len(query.Cursor) > 0 {
+		var err error
+		after, err = decodeCursor(query.Cursor)
+		if err != nil {
+			return nil, err
+		}
+	}
+	selected := make([]string, 0, len(names))
+	for _, name := range names {
+		if inListing(name, query, after) {
+			selected = append(selected, name)
+		}
+	}
+	if query.Descending {
+		sort.Sort(sort.Reverse(sort.StringSlice(selected)))
+	} else {
+		sort.Strings(selected)
+	}
+	if query.Limit > 0 && len(selected) > query.Limit+1 {
+		selected = selected[:query.Limit+1]
+	}
+	return selected, nil
+}
+
+// Get a copy of collection without the given element.
+func remove(collection []string, element string) []string {
+	result := make([]string, 0, len(collection))
+	for _, item := range collection {
+		if item != element {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// Check if collection contains the given element.
+func contains(collection []string, element string) bool {
+	for _, item := range collection {
+		if item == element {
+			return true
+		}
+	}
+	return false
+}
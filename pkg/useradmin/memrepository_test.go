@@ -0,0 +1,414 @@
+package useradmin
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+// Test executor for in-memory user repository
+func TestInMemoryUserRepository(t *testing.T) {
+	s := &memRepoTestSuite{context.TODO(), NewInMemoryUserRepository()}
+	t.Run("StoreUser", func(t *testing.T) { s.testStoreUser(t) })
+	t.Run("StoreDupUser", func(t *testing.T) { s.testStoreDupUser(t) })
+	t.Run("StoreUserProfile", func(t *testing.T) { s.testStoreUserProfile(t) })
+	t.Run("StoreGroup", func(t *testing.T) { s.testStoreGroup(t) })
+	t.Run("StoreDupGroup", func(t *testing.T) { s.testStoreDupGroup(t) })
+	t.Run("StoreGroupUnknownUser", func(t *testing.T) { s.testStoreGroupUnknownUser(t) })
+	t.Run("DeactivateUser", func(t *testing.T) { s.testDeactivateUser(t) })
+	t.Run("DeleteUser", func(t *testing.T) { s.testDeleteUser(t) })
+	t.Run("ListUsers", func(t *testing.T) { s.testListUsers(t) })
+	t.Run("ListGroups", func(t *testing.T) { s.testListGroups(t) })
+	t.Run("FetchUserGroups", func(t *testing.T) { s.testFetchUserGroups(t) })
+	t.Run("AddGroupUsers", func(t *testing.T) { s.testAddGroupUsers(t) })
+	t.Run("RemoveGroupUser", func(t *testing.T) { s.testRemoveGroupUser(t) })
+	t.Run("DeleteGroup", func(t *testing.T) { s.testDeleteGroup(t) })
+	t.Run("SetUserRole", func(t *testing.T) { s.testSetUserRole(t) })
+	t.Run("GroupPolicy", func(t *testing.T) { s.testGroupPolicy(t) })
+	t.Run("GroupModerators", func(t *testing.T) { s.testGroupModerators(t) })
+}
+
+// Test suite for in-memory user repository
+type memRepoTestSuite struct {
+	ctx context.Context
+	r   UserRepository
+}
+
+// Test scenario - Store and find a user
+func (s *memRepoTestSuite) testStoreUser(t *testing.T) {
+	s.r.Purge(s.ctx)
+
+	is := is.New(t)
+
+	id, err := s.r.StoreUser(s.ctx, User{Name: "alice"})
+	is.NoErr(err)
+	is.Equal(id, "alice")
+
+	found, err := s.r.FindUser(s.ctx, "alice")
+	is.NoErr(err)
+	is.True(found)
+
+	found, err = s.r.FindUser(s.ctx, "bob")
+	is.NoErr(err)
+	is.True(!found)
+}
+
+// Test scenario - Store a user with profile and fetch it
+func (s *memRepoTestSuite) testStoreUserProfile(t *testing.T) {
+	s.r.Purge(s.ctx)
+
+	is := is.New(t)
+
+	alice := User{
+		Name:        "alice",
+		DisplayName: "Alice Liddell",
+		Email:       "alice@example.com",
+		CreatedAt:   time.Date(2019, 11, 2, 10, 30, 0, 0, time.UTC),
+		Attributes:  map[string]string{"team": "wonderland"},
+		Role:        RoleMember,
+	}
+
+	_, err := s.r.StoreUser(s.ctx, alice)
+	is.NoErr(err)
+
+	user, err := s.r.FetchUser(s.ctx, "alice")
+	is.NoErr(err)
+	is.Equal(user, alice)
+
+	// attributes of fetched user are not shared with the repository
+	user.Attributes["team"] = "looking glass"
+	user, err = s.r.FetchUser(s.ctx, "alice")
+	is.NoErr(err)
+	is.Equal(user.Attributes["team"], "wonderland")
+}
+
+// Test scenario - Store a duplicate user
+func (s *memRepoTestSuite) testStoreDupUser(t *testing.T) {
+	s.r.Purge(s.ctx)
+
+	is := is.New(t)
+
+	_, err := s.r.StoreUser(s.ctx, User{Name: "alice"})
+	is.NoErr(err)
+
+	_, err = s.r.StoreUser(s.ctx, User{Name: "alice"})
+	is.Equal(err, ErrUserExists)
+}
+
+// Test scenario - Store a group and fetch its users
+func (s *memRepoTestSuite) testStoreGroup(t *testing.T) {
+	s.r.Purge(s.ctx)
+
+	is := is.New(t)
+
+	s.r.StoreUser(s.ctx, User{Name: "alice"})
+	s.r.StoreUser(s.ctx, User{Name: "bob"})
+
+	id, err := s.r.StoreGroup(s.ctx, "engineering", []string{"alice", "bob"})
+	is.NoErr(err)
+	is.Equal(id, "engineering")
+
+	found, err := s.r.FindGroup(s.ctx, "engineering")
+	is.NoErr(err)
+	is.True(found)
+
+	users, err := s.r.FetchGroupUsers(s.ctx, "engineering")
+	is.NoErr(err)
+	is.Equal(users, []string{"alice", "bob"})
+}
+
+// Test scenario - Store a duplicate group
+func (s *memRepoTestSuite) testStoreDupGroup(t *testing.T) {
+	s.r.Purge(s.ctx)
+
+	is := is.New(t)
+
+	s.r.StoreUser(s.ctx, User{Name: "alice"})
+
+	_, err := s.r.StoreGroup(s.ctx, "engineering", []string{"alice"})
+	is.NoErr(err)
+
+	_, err = s.r.StoreGroup(s.ctx, "engineering", []string{"alice"})
+	is.Equal(err, ErrGroupExists)
+}
+
+// Test scenario - Store a group with a member who is not a registered user
+func (s *memRepoTestSuite) testStoreGroupUnknownUser(t *testing.T) {
+	s.r.Purge(s.ctx)
+
+	is := is.New(t)
+
+	s.r.StoreUser(s.ctx, User{Name: "alice"})
+
+	_, err := s.r.StoreGroup(s.ctx, "engineering", []string{"alice", "mallory"})
+	is.Equal(err, ErrUserNotFound)
+
+	found, err := s.r.FindGroup(s.ctx, "engineering")
+	is.NoErr(err)
+	is.True(!found)
+}
+
+// Test scenario - Add users to a group
+func (s *memRepoTestSuite) testAddGroupUsers(t *testing.T) {
+	s.r.Purge(s.ctx)
+
+	is := is.New(t)
+
+	s.r.StoreUser(s.ctx, User{Name: "alice"})
+	s.r.StoreUser(s.ctx, User{Name: "bob"})
+	s.r.StoreUser(s.ctx, User{Name: "carol"})
+	s.r.StoreGroup(s.ctx, "engineering", []string{"alice"})
+
+	err := s.r.AddGroupUsers(s.ctx, "engineering", []string{"alice", "bob", "carol"})
+	is.NoErr(err)
+
+	users, err := s.r.FetchGroupUsers(s.ctx, "engineering")
+	is.NoErr(err)
+	is.Equal(users, []string{"alice", "bob", "carol"})
+
+	err = s.r.AddGroupUsers(s.ctx, "engineering", []string{"mallory"})
+	is.Equal(err, ErrUserNotFound)
+
+	err = s.r.AddGroupUsers(s.ctx, "sales", []string{"alice"})
+	is.Equal(err, ErrGroupNotFound)
+}
+
+// Test scenario - Remove a user from a group
+func (s *memRepoTestSuite) testRemoveGroupUser(t *testing.T) {
+	s.r.Purge(s.ctx)
+
+	is := is.New(t)
+
+	s.r.StoreUser(s.ctx, User{Name: "alice"})
+	s.r.StoreUser(s.ctx, User{Name: "bob"})
+	s.r.StoreGroup(s.ctx, "engineering", []string{"alice", "bob"})
+
+	err := s.r.RemoveGroupUser(s.ctx, "engineering", "alice")
+	is.NoErr(err)
+
+	users, err := s.r.FetchGroupUsers(s.ctx, "engineering")
+	is.NoErr(err)
+	is.Equal(users, []string{"bob"})
+
+	err = s.r.RemoveGroupUser(s.ctx, "engineering", "alice")
+	is.Equal(err, ErrNotGroupMember)
+
+	err = s.r.RemoveGroupUser(s.ctx, "sales", "bob")
+	is.Equal(err, ErrGroupNotFound)
+}
+
+// Test scenario - Delete a group
+func (s *memRepoTestSuite) testDeleteGroup(t *testing.T) {
+	s.r.Purge(s.ctx)
+
+	is := is.New(t)
+
+	s.r.StoreUser(s.ctx, User{Name: "alice"})
+	s.r.StoreGroup(s.ctx, "engineering", []string{"alice"})
+
+	err := s.r.DeleteGroup(s.ctx, "engineering")
+	is.NoErr(err)
+
+	found, err := s.r.FindGroup(s.ctx, "engineering")
+	is.NoErr(err)
+	is.True(!found)
+
+	err = s.r.DeleteGroup(s.ctx, "engineering")
+	is.Equal(err, ErrGroupNotFound)
+
+	_, err = s.r.StoreGroup(s.ctx, "engineering", []string{"alice"})
+	is.NoErr(err)
+}
+
+// Test scenario - Deactivate and activate a user
+func (s *memRepoTestSuite) testDeactivateUser(t *testing.T) {
+	s.r.Purge(s.ctx)
+
+	is := is.New(t)
+
+	s.r.StoreUser(s.ctx, User{Name: "alice"})
+
+	err := s.r.SetUserDeactivated(s.ctx, "alice", true)
+	is.NoErr(err)
+
+	user, err := s.r.FetchUser(s.ctx, "alice")
+	is.NoErr(err)
+	is.Equal(user, User{Name: "alice", Deactivated: true, Role: RoleMember})
+
+	err = s.r.SetUserDeactivated(s.ctx, "alice", false)
+	is.NoErr(err)
+
+	user, err = s.r.FetchUser(s.ctx, "alice")
+	is.NoErr(err)
+	is.True(!user.Deactivated)
+
+	err = s.r.SetUserDeactivated(s.ctx, "bob", true)
+	is.Equal(err, ErrUserNotFound)
+
+	_, err = s.r.FetchUser(s.ctx, "bob")
+	is.Equal(err, ErrUserNotFound)
+}
+
+// Test scenario - Delete a user who is a member of a group
+func (s *memRepoTestSuite) testDeleteUser(t *testing.T) {
+	s.r.Purge(s.ctx)
+
+	is := is.New(t)
+
+	s.r.StoreUser(s.ctx, User{Name: "alice"})
+	s.r.StoreUser(s.ctx, User{Name: "bob"})
+	s.r.StoreGroup(s.ctx, "engineering", []string{"alice", "bob"})
+
+	err := s.r.DeleteUser(s.ctx, "alice")
+	is.NoErr(err)
+
+	found, err := s.r.FindUser(s.ctx, "alice")
+	is.NoErr(err)
+	is.True(!found)
+
+	users, err := s.r.FetchGroupUsers(s.ctx, "engineering")
+	is.NoErr(err)
+	is.Equal(users, []string{"bob"})
+
+	err = s.r.DeleteUser(s.ctx, "alice")
+	is.Equal(err, ErrUserNotFound)
+}
+
+// Test scenario - List users by prefix in pages
+func (s *memRepoTestSuite) testListUsers(t *testing.T) {
+	s.r.Purge(s.ctx)
+
+	is := is.New(t)
+
+	for _, name := range []string{"carol", "alice", "bob", "alfred", "albert"} {
+		s.r.StoreUser(s.ctx, User{Name: name})
+	}
+	s.r.SetUserDeactivated(s.ctx, "alfred", true)
+
+	users, next, err := s.r.ListUsers(s.ctx, ListQuery{Prefix: "al", Limit: 2})
+	is.NoErr(err)
+	is.Equal(users, []User{{Name: "albert", Role: RoleMember}, {Name: "alfred", Deactivated: true, Role: RoleMember}})
+	is.True(len(next) > 0)
+
+	users, next, err = s.r.ListUsers(s.ctx, ListQuery{Prefix: "al", Limit: 2, Cursor: next})
+	is.NoErr(err)
+	is.Equal(users, []User{{Name: "alice", Role: RoleMember}})
+	is.Equal(next, "")
+
+	users, _, err = s.r.ListUsers(s.ctx, ListQuery{Limit: 2, Descending: true})
+	is.NoErr(err)
+	is.Equal(users, []User{{Name: "carol", Role: RoleMember}, {Name: "bob", Role: RoleMember}})
+
+	_, _, err = s.r.ListUsers(s.ctx, ListQuery{Cursor: "%%%"})
+	is.Equal(err, ErrBadRequest)
+}
+
+// Test scenario - List groups by prefix in pages
+func (s *memRepoTestSuite) testListGroups(t *testing.T) {
+	s.r.Purge(s.ctx)
+
+	is := is.New(t)
+
+	s.r.StoreUser(s.ctx, User{Name: "alice"})
+	for _, name := range []string{"sales", "engineering", "support"} {
+		s.r.StoreGroup(s.ctx, name, []string{"alice"})
+	}
+
+	groups, next, err := s.r.ListGroups(s.ctx, ListQuery{Prefix: "s", Limit: 1, Descending: true})
+	is.NoErr(err)
+	is.Equal(groups, []string{"support"})
+
+	groups, next, err = s.r.ListGroups(s.ctx, ListQuery{Prefix: "s", Limit: 1, Descending: true, Cursor: next})
+	is.NoErr(err)
+	is.Equal(groups, []string{"sales"})
+	is.Equal(next, "")
+}
+
+// Test scenario - Fetch groups a user is member of
+func (s *memRepoTestSuite) testFetchUserGroups(t *testing.T) {
+	s.r.Purge(s.ctx)
+
+	is := is.New(t)
+
+	s.r.StoreUser(s.ctx, User{Name: "alice"})
+	s.r.StoreUser(s.ctx, User{Name: "bob"})
+	s.r.StoreGroup(s.ctx, "sales", []string{"alice", "bob"})
+	s.r.StoreGroup(s.ctx, "engineering", []string{"alice"})
+	s.r.StoreGroup(s.ctx, "support", []string{"bob"})
+
+	groups, err := s.r.FetchUserGroups(s.ctx, "alice")
+	is.NoErr(err)
+	is.Equal(groups, []string{"engineering", "sales"})
+}
+
+// Test scenario - Users are members until they are made admins
+func (s *memRepoTestSuite) testSetUserRole(t *testing.T) {
+	s.r.Purge(s.ctx)
+
+	is := is.New(t)
+
+	s.r.StoreUser(s.ctx, User{Name: "alice"})
+
+	user, _ := s.r.FetchUser(s.ctx, "alice")
+	is.Equal(user.Role, RoleMember)
+
+	err := s.r.SetUserRole(s.ctx, "alice", RoleAdmin)
+	is.NoErr(err)
+	user, _ = s.r.FetchUser(s.ctx, "alice")
+	is.Equal(user.Role, RoleAdmin)
+
+	err = s.r.SetUserRole(s.ctx, "bob", RoleAdmin)
+	is.Equal(err, ErrUserNotFound)
+}
+
+// Test scenario - Groups are open until their policy is changed
+func (s *memRepoTestSuite) testGroupPolicy(t *testing.T) {
+	s.r.Purge(s.ctx)
+
+	is := is.New(t)
+
+	s.r.StoreUser(s.ctx, User{Name: "alice"})
+	s.r.StoreGroup(s.ctx, "engineering", []string{"alice"})
+
+	group, err := s.r.FetchGroup(s.ctx, "engineering")
+	is.NoErr(err)
+	is.Equal(group, Group{Name: "engineering", Policy: PolicyOpen, Members: []string{"alice"}, Moderators: []string{}})
+
+	err = s.r.SetGroupPolicy(s.ctx, "engineering", PolicyAnnounce)
+	is.NoErr(err)
+	group, _ = s.r.FetchGroup(s.ctx, "engineering")
+	is.Equal(group.Policy, PolicyAnnounce)
+
+	err = s.r.SetGroupPolicy(s.ctx, "sales", PolicyAnnounce)
+	is.Equal(err, ErrGroupNotFound)
+
+	_, err = s.r.FetchGroup(s.ctx, "sales")
+	is.Equal(err, ErrGroupNotFound)
+}
+
+// Test scenario - Only members can moderate a group and leaving a group ends it
+func (s *memRepoTestSuite) testGroupModerators(t *testing.T) {
+	s.r.Purge(s.ctx)
+
+	is := is.New(t)
+
+	s.r.StoreUser(s.ctx, User{Name: "alice"})
+	s.r.StoreUser(s.ctx, User{Name: "bob"})
+	s.r.StoreUser(s.ctx, User{Name: "carol"})
+	s.r.StoreGroup(s.ctx, "engineering", []string{"alice", "bob"})
+
+	is.NoErr(s.r.SetGroupModerator(s.ctx, "engineering", "alice", true))
+	is.NoErr(s.r.SetGroupModerator(s.ctx, "engineering", "bob", true))
+	is.Equal(s.r.SetGroupModerator(s.ctx, "engineering", "carol", true), ErrNotGroupMember)
+
+	group, _ := s.r.FetchGroup(s.ctx, "engineering")
+	is.Equal(group.Moderators, []string{"alice", "bob"})
+
+	is.NoErr(s.r.SetGroupModerator(s.ctx, "engineering", "alice", false))
+	s.r.RemoveGroupUser(s.ctx, "engineering", "bob")
+
+	group, _ = s.r.FetchGroup(s.ctx, "engineering")
+	is.Equal(group.Moderators, []string{})
+}
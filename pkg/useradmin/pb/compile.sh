@@ -0,0 +1,19 @@
+#!/usr/bin/env sh
+
+# Generated code must come from the same tools each time, so that it does not
+# change from one regeneration to the next. Install protoc 3.11.4 from
+# https://github.com/protocolbuffers/protobuf/releases/tag/v3.11.4 and the go
+# plugin of the protobuf release pinned in glide.yaml, which generates grpc
+# service code as well:
+#
+#   GO111MODULE=on go get github.com/golang/protobuf/protoc-gen-go@v1.4.0
+#
+# Then run this script from this directory to regenerate useradmin.pb.go.
+
+version=$(protoc --version)
+if [ "$version" != "libprotoc 3.11.4" ]; then
+  echo "protoc 3.11.4 is required, found: $version" >&2
+  exit 1
+fi
+
+protoc useradmin.proto --go_out=plugins=grpc,paths=source_relative:.
@@ -3,17 +3,73 @@ package useradmin
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/ghsbhatia/msgbox/pkg/useradmin/api"
+	"github.com/go-sql-driver/mysql"
 	"github.com/pkg/errors"
 )
 
+// Registered user
+type User struct {
+	Name        string
+	DisplayName string
+	Email       string
+	CreatedAt   time.Time
+	Attributes  map[string]string
+	Deactivated bool
+	Role        string
+}
+
+// Roles of users. Admins manage users and groups and may post to any group.
+const (
+	RoleAdmin  = api.RoleAdmin
+	RoleMember = api.RoleMember
+)
+
+// Registered group with its posting policy. Moderators are members of the
+// group.
+type Group struct {
+	Name       string
+	Policy     string
+	Members    []string
+	Moderators []string
+}
+
+// Posting policies of groups
+const (
+	// any registered user may post to the group
+	PolicyOpen = api.PolicyOpen
+	// only members of the group may post to it
+	PolicyMembers = api.PolicyMembers
+	// only moderators of the group may post to it
+	PolicyAnnounce = api.PolicyAnnounce
+)
+
+// Columns of users table in the order they are scanned by scanUser
+const userColumns = "name, display_name, email, created_at, attributes, deactivated, role"
+
 type UserRepository interface {
-	StoreUser(context.Context, string) (string, error)
+	StoreUser(context.Context, User) (string, error)
 	FindUser(context.Context, string) (bool, error)
+	FetchUser(context.Context, string) (User, error)
+	SetUserDeactivated(context.Context, string, bool) error
+	SetUserRole(context.Context, string, string) error
+	DeleteUser(context.Context, string) error
+	ListUsers(context.Context, ListQuery) ([]User, string, error)
+	FetchUserGroups(context.Context, string) ([]string, error)
 	StoreGroup(context.Context, string, []string) (string, error)
 	FindGroup(context.Context, string) (bool, error)
 	FetchGroupUsers(context.Context, string) ([]string, error)
+	FetchGroup(context.Context, string) (Group, error)
+	SetGroupPolicy(context.Context, string, string) error
+	SetGroupModerator(context.Context, string, string, bool) error
+	ListGroups(context.Context, ListQuery) ([]string, string, error)
+	AddGroupUsers(context.Context, string, []string) error
+	RemoveGroupUser(context.Context, string, string) error
+	DeleteGroup(context.Context, string) error
 	Purge(context.Context) error
 }
 
@@ -29,7 +85,7 @@ type userRepository struct {
 	db *sql.DB
 }
 
-func (r *userRepository) StoreUser(ctx context.Context, username string) (id string, err error) {
+func (r *userRepository) StoreUser(ctx context.Context, user User) (id string, err error) {
 	tx, txerr := r.startTransaction(ctx)
 	if txerr != nil {
 		return "", errors.Wrap(txerr, "error starting store user transaction")
@@ -37,8 +93,22 @@ func (r *userRepository) StoreUser(ctx context.Context, username string) (id str
 	defer func(tx *sql.Tx) {
 		r.completeTransaction(tx, err)
 	}(tx)
+	var attributes []byte
+	if len(user.Attributes) > 0 {
+		attributes, err = json.Marshal(user.Attributes)
+		if err != nil {
+			err = errors.Wrap(err, "error encoding user attributes")
+			return "", err
+		}
+	}
+	role := user.Role
+	if len(role) == 0 {
+		role = RoleMember
+	}
 	var result sql.Result
-	result, err = r.db.ExecContext(ctx, `INSERT INTO users(name) VALUES ( ? )`, username)
+	result, err = r.db.ExecContext(ctx,
+		`INSERT INTO users(name, display_name, email, created_at, attributes, role) VALUES ( ?, ?, ?, ?, ?, ? )`,
+		user.Name, user.DisplayName, user.Email, user.CreatedAt, attributes, role)
 	if err != nil {
 		err = errors.Wrap(err, "error inserting user")
 		return "", err
@@ -47,7 +117,7 @@ func (r *userRepository) StoreUser(ctx context.Context, username string) (id str
 	if err != nil {
 		err = errors.Wrap(err, "error inserting user")
 	}
-	id = username
+	id = user.Name
 	return id, err
 }
 
@@ -60,6 +130,121 @@ func (r *userRepository) FindUser(ctx context.Context, username string) (bool, e
 	return count > 0, nil
 }
 
+func (r *userRepository) FetchUser(ctx context.Context, username string) (User, error) {
+	row := r.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users where name = ?", username)
+	user, err := scanUser(row)
+	if err == sql.ErrNoRows {
+		return User{}, ErrUserNotFound
+	}
+	if err != nil {
+		return User{}, errors.Wrap(err, "error selecting user")
+	}
+	return user, nil
+}
+
+func (r *userRepository) SetUserDeactivated(ctx context.Context, username string, deactivated bool) (err error) {
+	tx, txerr := r.startTransaction(ctx)
+	if txerr != nil {
+		return errors.Wrap(txerr, "error starting deactivate user transaction")
+	}
+	defer func(tx *sql.Tx) {
+		r.completeTransaction(tx, err)
+	}(tx)
+	err = r.lockUser(ctx, tx, username)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE users SET deactivated = ? WHERE name = ?`, deactivated, username)
+	if err != nil {
+		err = errors.Wrap(err, "error updating user")
+	}
+	return err
+}
+
+func (r *userRepository) SetUserRole(ctx context.Context, username string, role string) (err error) {
+	tx, txerr := r.startTransaction(ctx)
+	if txerr != nil {
+		return errors.Wrap(txerr, "error starting set user role transaction")
+	}
+	defer func(tx *sql.Tx) {
+		r.completeTransaction(tx, err)
+	}(tx)
+	err = r.lockUser(ctx, tx, username)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE users SET role = ? WHERE name = ?`, role, username)
+	if err != nil {
+		err = errors.Wrap(err, "error updating user")
+	}
+	return err
+}
+
+func (r *userRepository) DeleteUser(ctx context.Context, username string) (err error) {
+	tx, txerr := r.startTransaction(ctx)
+	if txerr != nil {
+		return errors.Wrap(txerr, "error starting delete user transaction")
+	}
+	defer func(tx *sql.Tx) {
+		r.completeTransaction(tx, err)
+	}(tx)
+	err = r.lockUser(ctx, tx, username)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM groupusers WHERE username = ?`, username)
+	if err != nil {
+		err = errors.Wrap(err, "error deleting user groups")
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM users WHERE name = ?`, username)
+	if err != nil {
+		err = errors.Wrap(err, "error deleting user")
+	}
+	return err
+}
+
+func (r *userRepository) ListUsers(ctx context.Context, query ListQuery) ([]User, string, error) {
+	statement, args, err := listStatement(userColumns, "users", query)
+	if err != nil {
+		return nil, "", err
+	}
+	results, err := r.db.QueryContext(ctx, statement, args...)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "error selecting users")
+	}
+	defer results.Close()
+	users := make([]User, 0)
+	for results.Next() {
+		var user User
+		user, err = scanUser(results)
+		if err != nil {
+			return nil, "", errors.Wrap(err, "error scanning users")
+		}
+		users = append(users, user)
+	}
+	users, next := userPageOf(users, query.Limit)
+	return users, next, nil
+}
+
+func (r *userRepository) FetchUserGroups(ctx context.Context, username string) ([]string, error) {
+	results, err := r.db.QueryContext(ctx, "SELECT groupname FROM groupusers where username = ? ORDER BY groupname", username)
+	if err != nil {
+		return nil, errors.Wrap(err, "error selecting user groups")
+	}
+	defer results.Close()
+	groups := make([]string, 0)
+	for results.Next() {
+		var group string
+		err = results.Scan(&group)
+		if err != nil {
+			return nil, errors.Wrap(err, "error scanning user groups")
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
 func (r *userRepository) StoreGroup(ctx context.Context, groupname string, usernames []string) (id string, err error) {
 	tx, txerr := r.startTransaction(ctx)
 	if txerr != nil {
@@ -121,6 +306,206 @@ func (r *userRepository) FetchGroupUsers(ctx context.Context, groupname string)
 	return users, nil
 }
 
+func (r *userRepository) FetchGroup(ctx context.Context, groupname string) (Group, error) {
+	group := Group{Name: groupname, Members: []string{}, Moderators: []string{}}
+	err := r.db.QueryRowContext(ctx, "SELECT policy FROM usergroups where name = ?", groupname).Scan(&group.Policy)
+	if err == sql.ErrNoRows {
+		return Group{}, ErrGroupNotFound
+	}
+	if err != nil {
+		return Group{}, errors.Wrap(err, "error selecting group")
+	}
+	results, err := r.db.QueryContext(ctx, "SELECT username, moderator FROM groupusers where groupname = ?", groupname)
+	if err != nil {
+		return Group{}, errors.Wrap(err, "error selecting group users")
+	}
+	defer results.Close()
+	for results.Next() {
+		var (
+			user      string
+			moderator bool
+		)
+		err = results.Scan(&user, &moderator)
+		if err != nil {
+			return Group{}, errors.Wrap(err, "error scanning group users")
+		}
+		group.Members = append(group.Members, user)
+		if moderator {
+			group.Moderators = append(group.Moderators, user)
+		}
+	}
+	return group, nil
+}
+
+func (r *userRepository) SetGroupPolicy(ctx context.Context, groupname string, policy string) (err error) {
+	tx, txerr := r.startTransaction(ctx)
+	if txerr != nil {
+		return errors.Wrap(txerr, "error starting set group policy transaction")
+	}
+	defer func(tx *sql.Tx) {
+		r.completeTransaction(tx, err)
+	}(tx)
+	err = r.lockGroup(ctx, tx, groupname)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE usergroups SET policy = ? WHERE name = ?`, policy, groupname)
+	if err != nil {
+		err = errors.Wrap(err, "error updating group")
+	}
+	return err
+}
+
+func (r *userRepository) SetGroupModerator(ctx context.Context, groupname string, username string, moderator bool) (err error) {
+	tx, txerr := r.startTransaction(ctx)
+	if txerr != nil {
+		return errors.Wrap(txerr, "error starting set group moderator transaction")
+	}
+	defer func(tx *sql.Tx) {
+		r.completeTransaction(tx, err)
+	}(tx)
+	err = r.lockGroup(ctx, tx, groupname)
+	if err != nil {
+		return err
+	}
+	var count int
+	err = tx.QueryRowContext(ctx, `SELECT count(username) FROM groupusers WHERE groupname = ? AND username = ?`, groupname, username).Scan(&count)
+	if err != nil {
+		err = errors.Wrap(err, "error selecting group user count")
+		return err
+	}
+	if count == 0 {
+		err = ErrNotGroupMember
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE groupusers SET moderator = ? WHERE groupname = ? AND username = ?`, moderator, groupname, username)
+	if err != nil {
+		err = errors.Wrap(err, "error updating group user")
+	}
+	return err
+}
+
+func (r *userRepository) ListGroups(ctx context.Context, query ListQuery) ([]string, string, error) {
+	statement, args, err := listStatement("name", "usergroups", query)
+	if err != nil {
+		return nil, "", err
+	}
+	results, err := r.db.QueryContext(ctx, statement, args...)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "error selecting groups")
+	}
+	defer results.Close()
+	groups := make([]string, 0)
+	for results.Next() {
+		var group string
+		err = results.Scan(&group)
+		if err != nil {
+			return nil, "", errors.Wrap(err, "error scanning groups")
+		}
+		groups = append(groups, group)
+	}
+	groups, next := pageOf(groups, query.Limit)
+	return groups, next, nil
+}
+
+func (r *userRepository) AddGroupUsers(ctx context.Context, groupname string, usernames []string) (err error) {
+	tx, txerr := r.startTransaction(ctx)
+	if txerr != nil {
+		return errors.Wrap(txerr, "error starting add group users transaction")
+	}
+	defer func(tx *sql.Tx) {
+		r.completeTransaction(tx, err)
+	}(tx)
+	err = r.lockGroup(ctx, tx, groupname)
+	if err != nil {
+		return err
+	}
+	var results *sql.Rows
+	results, err = tx.QueryContext(ctx, `SELECT username FROM groupusers WHERE groupname = ?`, groupname)
+	if err != nil {
+		err = errors.Wrap(err, "error selecting group users")
+		return err
+	}
+	members := make(map[string]bool)
+	for results.Next() {
+		var user string
+		err = results.Scan(&user)
+		if err != nil {
+			results.Close()
+			err = errors.Wrap(err, "error scanning group users")
+			return err
+		}
+		members[user] = true
+	}
+	results.Close()
+	for _, username := range usernames {
+		if members[username] {
+			continue
+		}
+		_, err = tx.ExecContext(ctx, `INSERT INTO groupusers(groupname,username) VALUES ( ?, ? )`, groupname, username)
+		if err != nil {
+			err = errors.Wrap(err, "error inserting group user")
+			return err
+		}
+		members[username] = true
+	}
+	return err
+}
+
+func (r *userRepository) RemoveGroupUser(ctx context.Context, groupname string, username string) (err error) {
+	tx, txerr := r.startTransaction(ctx)
+	if txerr != nil {
+		return errors.Wrap(txerr, "error starting remove group user transaction")
+	}
+	defer func(tx *sql.Tx) {
+		r.completeTransaction(tx, err)
+	}(tx)
+	err = r.lockGroup(ctx, tx, groupname)
+	if err != nil {
+		return err
+	}
+	var result sql.Result
+	result, err = tx.ExecContext(ctx, `DELETE FROM groupusers WHERE groupname = ? AND username = ?`, groupname, username)
+	if err != nil {
+		err = errors.Wrap(err, "error deleting group user")
+		return err
+	}
+	var count int64
+	count, err = result.RowsAffected()
+	if err != nil {
+		err = errors.Wrap(err, "error deleting group user")
+		return err
+	}
+	if count == 0 {
+		err = ErrNotGroupMember
+	}
+	return err
+}
+
+func (r *userRepository) DeleteGroup(ctx context.Context, groupname string) (err error) {
+	tx, txerr := r.startTransaction(ctx)
+	if txerr != nil {
+		return errors.Wrap(txerr, "error starting delete group transaction")
+	}
+	defer func(tx *sql.Tx) {
+		r.completeTransaction(tx, err)
+	}(tx)
+	err = r.lockGroup(ctx, tx, groupname)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM groupusers WHERE groupname = ?`, groupname)
+	if err != nil {
+		err = errors.Wrap(err, "error deleting group users")
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM usergroups WHERE name = ?`, groupname)
+	if err != nil {
+		err = errors.Wrap(err, "error deleting group")
+	}
+	return err
+}
+
 func (r *userRepository) Purge(ctx context.Context) (err error) {
 	tx, txerr := r.startTransaction(ctx)
 	if txerr != nil {
@@ -144,6 +529,97 @@ func (r *userRepository) Purge(ctx context.Context) (err error) {
 	return err
 }
 
+// Scan row of user columns into a user.
+func scanUser(row interface{ Scan(...interface{}) error }) (User, error) {
+	var (
+		user               User
+		displayName, email sql.NullString
+		createdAt          mysql.NullTime
+		attributes         []byte
+	)
+	err := row.Scan(&user.Name, &displayName, &email, &createdAt, &attributes, &user.Deactivated, &user.Role)
+	if err != nil {
+		return User{}, err
+	}
+	user.DisplayName = displayName.String
+	user.Email = email.String
+	user.CreatedAt = createdAt.Time
+	if len(attributes) > 0 {
+		err = json.Unmarshal(attributes, &user.Attributes)
+	}
+	return user, err
+}
+
+// Build statement selecting given columns of a page of rows of given table by
+// name. One more row than limit is selected to tell if there is a next page.
+func listStatement(columns string, table string, query ListQuery) (string, []interface{}, error) {
+	var (
+		clauses []string
+		args    []interface{}
+	)
+	if len(query.Prefix) > 0 {
+		clauses = append(clauses, "name LIKE ?")
+		args = append(args, likeEscaper.Replace(query.Prefix)+"%")
+	}
+	if len(query.Cursor) > 0 {
+		after, err := decodeCursor(query.Cursor)
+		if err != nil {
+			return "", nil, err
+		}
+		if query.Descending {
+			clauses = append(clauses, "name < ?")
+		} else {
+			clauses = append(clauses, "name > ?")
+		}
+		args = append(args, after)
+	}
+	statement := "SELECT " + columns + " FROM " + table
+	if len(clauses) > 0 {
+		statement += " WHERE " + strings.Join(clauses, " AND ")
+	}
+	if query.Descending {
+		statement += " ORDER BY name DESC"
+	} else {
+		statement += " ORDER BY name ASC"
+	}
+	if query.Limit > 0 {
+		statement += " LIMIT ?"
+		args = append(args, query.Limit+1)
+	}
+	return statement, args, nil
+}
+
+// Escapes wildcards of a LIKE pattern so that they match literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// Lock the user row so that changes of a user are serialized. ErrUserNotFound
+// is returned when the user does not exist.
+func (r *userRepository) lockUser(ctx context.Context, tx *sql.Tx, username string) error {
+	var name string
+	err := tx.QueryRowContext(ctx, `SELECT name FROM users WHERE name = ? FOR UPDATE`, username).Scan(&name)
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return errors.Wrap(err, "error locking user")
+	}
+	return nil
+}
+
+// Lock the group row so that membership changes of a group are serialized.
+// ErrGroupNotFound is returned when the group does not exist.
+func (r *userRepository) lockGroup(ctx context.Context, tx *sql.Tx, groupname string) error {
+	var name string
+	err := tx.QueryRowContext(ctx, `SELECT name FROM usergroups WHERE name = ? FOR UPDATE`, groupname).Scan(&name)
+	if err == sql.ErrNoRows {
+		return ErrGroupNotFound
+	}
+	if err != nil {
+		return errors.Wrap(err, "error locking group")
+	}
+	return nil
+}
+
 func (r *userRepository) startTransaction(ctx context.Context) (*sql.Tx, error) {
 	return r.db.BeginTx(ctx, nil)
 }
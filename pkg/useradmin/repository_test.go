@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/matryer/is"
@@ -16,16 +17,38 @@ func TestUserRepository(t *testing.T) {
 	t.Run("FindKnownUser", func(t *testing.T) { s.testFindKnownUser(t) })
 	t.Run("StoreNewUser", func(t *testing.T) { s.testStoreNewUser(t) })
 	t.Run("StoreDupUser", func(t *testing.T) { s.testStoreDupUser(t) })
+	t.Run("FetchUser", func(t *testing.T) { s.testFetchUser(t) })
+	t.Run("FetchUnknownUser", func(t *testing.T) { s.testFetchUnknownUser(t) })
+	t.Run("DeactivateUser", func(t *testing.T) { s.testDeactivateUser(t) })
+	t.Run("SetUserRole", func(t *testing.T) { s.testSetUserRole(t) })
+	t.Run("DeleteUser", func(t *testing.T) { s.testDeleteUser(t) })
+	t.Run("DeleteUnknownUser", func(t *testing.T) { s.testDeleteUnknownUser(t) })
+	t.Run("ListUsers", func(t *testing.T) { s.testListUsers(t) })
+	t.Run("FetchUserGroups", func(t *testing.T) { s.testFetchUserGroups(t) })
 	t.Run("FindUnknownGroup", func(t *testing.T) { s.testFindUnknownGroup(t) })
 	t.Run("FindKnownGroup", func(t *testing.T) { s.testFindKnownGroup(t) })
 	t.Run("StoreNewGroup", func(t *testing.T) { s.testStoreNewGroup(t) })
 	t.Run("StoreDupGroup", func(t *testing.T) { s.testStoreDupGroup(t) })
 	t.Run("FetchGroupusers", func(t *testing.T) { s.testFetchGroupUsers(t) })
+	t.Run("ListGroups", func(t *testing.T) { s.testListGroups(t) })
+	t.Run("AddGroupUsers", func(t *testing.T) { s.testAddGroupUsers(t) })
+	t.Run("AddUnknownGroupUsers", func(t *testing.T) { s.testAddUnknownGroupUsers(t) })
+	t.Run("RemoveGroupUser", func(t *testing.T) { s.testRemoveGroupUser(t) })
+	t.Run("RemoveNonMemberGroupUser", func(t *testing.T) { s.testRemoveNonMemberGroupUser(t) })
+	t.Run("DeleteGroup", func(t *testing.T) { s.testDeleteGroup(t) })
+	t.Run("FetchGroup", func(t *testing.T) { s.testFetchGroup(t) })
+	t.Run("FetchUnknownGroup", func(t *testing.T) { s.testFetchUnknownGroup(t) })
+	t.Run("SetGroupPolicy", func(t *testing.T) { s.testSetGroupPolicy(t) })
+	t.Run("SetGroupModerator", func(t *testing.T) { s.testSetGroupModerator(t) })
+	t.Run("SetNonMemberGroupModerator", func(t *testing.T) { s.testSetNonMemberGroupModerator(t) })
 }
 
 // Test suite for user repository
 type repoTestSuite struct{}
 
+// Columns of users table as selected by repository
+var userColumnNames = []string{"name", "display_name", "email", "created_at", "attributes", "deactivated", "role"}
+
 // Test scenario - Find a known user
 func (s *repoTestSuite) testFindKnownUser(t *testing.T) {
 
@@ -94,13 +117,24 @@ func (s *repoTestSuite) testStoreNewUser(t *testing.T) {
 
 	result := sqlmock.NewResult(1, 1)
 
+	createdAt := time.Date(2019, 11, 2, 10, 30, 0, 0, time.UTC)
+
 	mock.ExpectBegin()
-	mock.ExpectExec("INSERT INTO users").WithArgs("tstuser").WillReturnResult(result)
+	mock.ExpectExec("INSERT INTO users").
+		WithArgs("tstuser", "Test User", "tstuser@example.com", createdAt, []byte(`{"team":"qa"}`), "member").
+		WillReturnResult(result)
 	mock.ExpectCommit()
 
 	{
 		repository := &userRepository{db}
-		id, err := repository.StoreUser(context.TODO(), "tstuser")
+		user := User{
+			Name:        "tstuser",
+			DisplayName: "Test User",
+			Email:       "tstuser@example.com",
+			CreatedAt:   createdAt,
+			Attributes:  map[string]string{"team": "qa"},
+		}
+		id, err := repository.StoreUser(context.TODO(), user)
 		is.NoErr(err)
 		is.Equal(id, "tstuser")
 	}
@@ -123,12 +157,14 @@ func (s *repoTestSuite) testStoreDupUser(t *testing.T) {
 	result := sqlmock.NewErrorResult(fmt.Errorf("duplicate user"))
 
 	mock.ExpectBegin()
-	mock.ExpectExec("INSERT INTO users").WithArgs("tstuser").WillReturnResult(result)
+	mock.ExpectExec("INSERT INTO users").
+		WithArgs("tstuser", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(result)
 	mock.ExpectRollback()
 
 	{
 		repository := &userRepository{db}
-		_, err := repository.StoreUser(context.TODO(), "tstuser")
+		_, err := repository.StoreUser(context.TODO(), User{Name: "tstuser"})
 		is.True(err != nil)
 	}
 
@@ -279,3 +315,563 @@ func (s *repoTestSuite) testFetchGroupUsers(t *testing.T) {
 	}
 
 }
+
+// Test scenario - Add users to a group, skipping existing members
+func (s *repoTestSuite) testAddGroupUsers(t *testing.T) {
+	is := is.New(t)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	group := mock.NewRows([]string{"name"}).AddRow("tstgroup")
+	members := mock.NewRows([]string{"username"}).AddRow("tstusr1")
+	result := sqlmock.NewResult(1, 1)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT name FROM usergroups").WithArgs("tstgroup").WillReturnRows(group)
+	mock.ExpectQuery("SELECT username FROM groupusers").WithArgs("tstgroup").WillReturnRows(members)
+	mock.ExpectExec("INSERT INTO groupusers").WithArgs("tstgroup", "tstusr2").WillReturnResult(result)
+	mock.ExpectCommit()
+
+	{
+		repository := &userRepository{db}
+		err := repository.AddGroupUsers(context.TODO(), "tstgroup", []string{"tstusr1", "tstusr2"})
+		is.NoErr(err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+// Test scenario - Add users to an unknown group
+func (s *repoTestSuite) testAddUnknownGroupUsers(t *testing.T) {
+	is := is.New(t)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	group := mock.NewRows([]string{"name"})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT name FROM usergroups").WithArgs("tstgroup").WillReturnRows(group)
+	mock.ExpectRollback()
+
+	{
+		repository := &userRepository{db}
+		err := repository.AddGroupUsers(context.TODO(), "tstgroup", []string{"tstusr1"})
+		is.Equal(err, ErrGroupNotFound)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+// Test scenario - Remove a user from a group
+func (s *repoTestSuite) testRemoveGroupUser(t *testing.T) {
+	is := is.New(t)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	group := mock.NewRows([]string{"name"}).AddRow("tstgroup")
+	result := sqlmock.NewResult(0, 1)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT name FROM usergroups").WithArgs("tstgroup").WillReturnRows(group)
+	mock.ExpectExec("DELETE FROM groupusers").WithArgs("tstgroup", "tstusr1").WillReturnResult(result)
+	mock.ExpectCommit()
+
+	{
+		repository := &userRepository{db}
+		err := repository.RemoveGroupUser(context.TODO(), "tstgroup", "tstusr1")
+		is.NoErr(err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+// Test scenario - Remove a user who is not a member of the group
+func (s *repoTestSuite) testRemoveNonMemberGroupUser(t *testing.T) {
+	is := is.New(t)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	group := mock.NewRows([]string{"name"}).AddRow("tstgroup")
+	result := sqlmock.NewResult(0, 0)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT name FROM usergroups").WithArgs("tstgroup").WillReturnRows(group)
+	mock.ExpectExec("DELETE FROM groupusers").WithArgs("tstgroup", "tstusr1").WillReturnResult(result)
+	mock.ExpectRollback()
+
+	{
+		repository := &userRepository{db}
+		err := repository.RemoveGroupUser(context.TODO(), "tstgroup", "tstusr1")
+		is.Equal(err, ErrNotGroupMember)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+// Test scenario - Delete a group along with its membership
+func (s *repoTestSuite) testDeleteGroup(t *testing.T) {
+	is := is.New(t)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	group := mock.NewRows([]string{"name"}).AddRow("tstgroup")
+	result := sqlmock.NewResult(0, 1)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT name FROM usergroups").WithArgs("tstgroup").WillReturnRows(group)
+	mock.ExpectExec("DELETE FROM groupusers").WithArgs("tstgroup").WillReturnResult(result)
+	mock.ExpectExec("DELETE FROM usergroups").WithArgs("tstgroup").WillReturnResult(result)
+	mock.ExpectCommit()
+
+	{
+		repository := &userRepository{db}
+		err := repository.DeleteGroup(context.TODO(), "tstgroup")
+		is.NoErr(err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+// Test scenario - Fetch a deactivated user
+func (s *repoTestSuite) testFetchUser(t *testing.T) {
+	is := is.New(t)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	createdAt := time.Date(2019, 11, 2, 10, 30, 0, 0, time.UTC)
+
+	rows := mock.NewRows(userColumnNames).
+		AddRow("tstuser", "Test User", "tstuser@example.com", createdAt, []byte(`{"team":"qa"}`), true, "admin")
+
+	mock.ExpectQuery("SELECT name, display_name, email, created_at, attributes, deactivated, role FROM users").
+		WithArgs("tstuser").
+		WillReturnRows(rows)
+
+	{
+		repository := &userRepository{db}
+		user, err := repository.FetchUser(context.TODO(), "tstuser")
+		is.NoErr(err)
+		is.Equal(user, User{
+			Name:        "tstuser",
+			DisplayName: "Test User",
+			Email:       "tstuser@example.com",
+			CreatedAt:   createdAt,
+			Attributes:  map[string]string{"team": "qa"},
+			Deactivated: true,
+			Role:        RoleAdmin,
+		})
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+// Test scenario - Fetch an unknown user
+func (s *repoTestSuite) testFetchUnknownUser(t *testing.T) {
+	is := is.New(t)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	rows := mock.NewRows(userColumnNames)
+
+	mock.ExpectQuery("SELECT name, display_name, email, created_at, attributes, deactivated, role FROM users").
+		WithArgs("tstuser").
+		WillReturnRows(rows)
+
+	{
+		repository := &userRepository{db}
+		_, err := repository.FetchUser(context.TODO(), "tstuser")
+		is.Equal(err, ErrUserNotFound)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+// Test scenario - Deactivate a user
+func (s *repoTestSuite) testDeactivateUser(t *testing.T) {
+	is := is.New(t)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	user := mock.NewRows([]string{"name"}).AddRow("tstuser")
+	result := sqlmock.NewResult(0, 1)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT name FROM users").WithArgs("tstuser").WillReturnRows(user)
+	mock.ExpectExec("UPDATE users SET deactivated").WithArgs(true, "tstuser").WillReturnResult(result)
+	mock.ExpectCommit()
+
+	{
+		repository := &userRepository{db}
+		err := repository.SetUserDeactivated(context.TODO(), "tstuser", true)
+		is.NoErr(err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+// Test scenario - Delete a user along with group membership
+func (s *repoTestSuite) testDeleteUser(t *testing.T) {
+	is := is.New(t)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	user := mock.NewRows([]string{"name"}).AddRow("tstuser")
+	result := sqlmock.NewResult(0, 1)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT name FROM users").WithArgs("tstuser").WillReturnRows(user)
+	mock.ExpectExec("DELETE FROM groupusers").WithArgs("tstuser").WillReturnResult(result)
+	mock.ExpectExec("DELETE FROM users").WithArgs("tstuser").WillReturnResult(result)
+	mock.ExpectCommit()
+
+	{
+		repository := &userRepository{db}
+		err := repository.DeleteUser(context.TODO(), "tstuser")
+		is.NoErr(err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+// Test scenario - Delete an unknown user
+func (s *repoTestSuite) testDeleteUnknownUser(t *testing.T) {
+	is := is.New(t)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	user := mock.NewRows([]string{"name"})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT name FROM users").WithArgs("tstuser").WillReturnRows(user)
+	mock.ExpectRollback()
+
+	{
+		repository := &userRepository{db}
+		err := repository.DeleteUser(context.TODO(), "tstuser")
+		is.Equal(err, ErrUserNotFound)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+// Test scenario - List a page of users by prefix after a cursor
+func (s *repoTestSuite) testListUsers(t *testing.T) {
+	is := is.New(t)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	rows := mock.NewRows(userColumnNames).
+		AddRow("tst_usr2", nil, nil, nil, nil, false, "member").
+		AddRow("tst_usr3", nil, nil, nil, nil, true, "member").
+		AddRow("tst_usr4", nil, nil, nil, nil, false, "member")
+
+	mock.ExpectQuery(`SELECT name, display_name, email, created_at, attributes, deactivated, role FROM users WHERE name LIKE \? AND name > \? ORDER BY name ASC LIMIT \?`).
+		WithArgs(`tst\_%`, "tst_usr1", 3).
+		WillReturnRows(rows)
+
+	{
+		repository := &userRepository{db}
+		query := ListQuery{Prefix: "tst_", Limit: 2, Cursor: encodeCursor("tst_usr1")}
+		users, next, err := repository.ListUsers(context.TODO(), query)
+		is.NoErr(err)
+		is.Equal(users, []User{{Name: "tst_usr2", Role: RoleMember}, {Name: "tst_usr3", Deactivated: true, Role: RoleMember}})
+		is.Equal(next, encodeCursor("tst_usr3"))
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+// Test scenario - Fetch groups of a user
+func (s *repoTestSuite) testFetchUserGroups(t *testing.T) {
+	is := is.New(t)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	rows := mock.NewRows([]string{"groupname"}).AddRow("tstgroup1").AddRow("tstgroup2")
+
+	mock.ExpectQuery("SELECT groupname FROM groupusers").WithArgs("tstuser").WillReturnRows(rows)
+
+	{
+		repository := &userRepository{db}
+		groups, err := repository.FetchUserGroups(context.TODO(), "tstuser")
+		is.NoErr(err)
+		is.Equal(groups, []string{"tstgroup1", "tstgroup2"})
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+// Test scenario - List groups in descending order
+func (s *repoTestSuite) testListGroups(t *testing.T) {
+	is := is.New(t)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	rows := mock.NewRows([]string{"name"}).AddRow("tstgroup2").AddRow("tstgroup1")
+
+	mock.ExpectQuery(`SELECT name FROM usergroups ORDER BY name DESC LIMIT \?`).WithArgs(3).WillReturnRows(rows)
+
+	{
+		repository := &userRepository{db}
+		groups, next, err := repository.ListGroups(context.TODO(), ListQuery{Limit: 2, Descending: true})
+		is.NoErr(err)
+		is.Equal(groups, []string{"tstgroup2", "tstgroup1"})
+		is.Equal(next, "")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+// Test scenario - Change role of a user
+func (s *repoTestSuite) testSetUserRole(t *testing.T) {
+	is := is.New(t)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	user := mock.NewRows([]string{"name"}).AddRow("tstuser")
+	result := sqlmock.NewResult(0, 1)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT name FROM users").WithArgs("tstuser").WillReturnRows(user)
+	mock.ExpectExec("UPDATE users SET role").WithArgs(RoleAdmin, "tstuser").WillReturnResult(result)
+	mock.ExpectCommit()
+
+	{
+		repository := &userRepository{db}
+		err := repository.SetUserRole(context.TODO(), "tstuser", RoleAdmin)
+		is.NoErr(err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+// Test scenario - Fetch a group with its policy and moderators
+func (s *repoTestSuite) testFetchGroup(t *testing.T) {
+	is := is.New(t)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	group := mock.NewRows([]string{"policy"}).AddRow(PolicyAnnounce)
+	members := mock.NewRows([]string{"username", "moderator"}).
+		AddRow("tstusr1", true).
+		AddRow("tstusr2", false)
+
+	mock.ExpectQuery("SELECT policy FROM usergroups").WithArgs("tstgroup").WillReturnRows(group)
+	mock.ExpectQuery("SELECT username, moderator FROM groupusers").WithArgs("tstgroup").WillReturnRows(members)
+
+	{
+		repository := &userRepository{db}
+		group, err := repository.FetchGroup(context.TODO(), "tstgroup")
+		is.NoErr(err)
+		is.Equal(group, Group{
+			Name:       "tstgroup",
+			Policy:     PolicyAnnounce,
+			Members:    []string{"tstusr1", "tstusr2"},
+			Moderators: []string{"tstusr1"},
+		})
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+// Test scenario - Fetch a group that does not exist
+func (s *repoTestSuite) testFetchUnknownGroup(t *testing.T) {
+	is := is.New(t)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT policy FROM usergroups").WithArgs("tstgroup").WillReturnRows(mock.NewRows([]string{"policy"}))
+
+	{
+		repository := &userRepository{db}
+		_, err := repository.FetchGroup(context.TODO(), "tstgroup")
+		is.Equal(err, ErrGroupNotFound)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+// Test scenario - Change posting policy of a group
+func (s *repoTestSuite) testSetGroupPolicy(t *testing.T) {
+	is := is.New(t)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	group := mock.NewRows([]string{"name"}).AddRow("tstgroup")
+	result := sqlmock.NewResult(0, 1)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT name FROM usergroups").WithArgs("tstgroup").WillReturnRows(group)
+	mock.ExpectExec("UPDATE usergroups SET policy").WithArgs(PolicyMembers, "tstgroup").WillReturnResult(result)
+	mock.ExpectCommit()
+
+	{
+		repository := &userRepository{db}
+		err := repository.SetGroupPolicy(context.TODO(), "tstgroup", PolicyMembers)
+		is.NoErr(err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+// Test scenario - Make a member of a group its moderator
+func (s *repoTestSuite) testSetGroupModerator(t *testing.T) {
+	is := is.New(t)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	group := mock.NewRows([]string{"name"}).AddRow("tstgroup")
+	count := mock.NewRows([]string{"count(username)"}).AddRow(1)
+	result := sqlmock.NewResult(0, 1)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT name FROM usergroups").WithArgs("tstgroup").WillReturnRows(group)
+	mock.ExpectQuery("SELECT count").WithArgs("tstgroup", "tstusr1").WillReturnRows(count)
+	mock.ExpectExec("UPDATE groupusers SET moderator").WithArgs(true, "tstgroup", "tstusr1").WillReturnResult(result)
+	mock.ExpectCommit()
+
+	{
+		repository := &userRepository{db}
+		err := repository.SetGroupModerator(context.TODO(), "tstgroup", "tstusr1", true)
+		is.NoErr(err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+// Test scenario - Make a user who is not a member of the group its moderator
+func (s *repoTestSuite) testSetNonMemberGroupModerator(t *testing.T) {
+	is := is.New(t)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	group := mock.NewRows([]string{"name"}).AddRow("tstgroup")
+	count := mock.NewRows([]string{"count(username)"}).AddRow(0)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT name FROM usergroups").WithArgs("tstgroup").WillReturnRows(group)
+	mock.ExpectQuery("SELECT count").WithArgs("tstgroup", "tstusr1").WillReturnRows(count)
+	mock.ExpectRollback()
+
+	{
+		repository := &userRepository{db}
+		err := repository.SetGroupModerator(context.TODO(), "tstgroup", "tstusr1", true)
+		is.Equal(err, ErrNotGroupMember)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
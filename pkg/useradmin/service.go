@@ -5,19 +5,44 @@ import (
 	"time"
 
 	"github.com/ghsbhatia/msgbox/pkg/ctxlog"
+	"github.com/ghsbhatia/msgbox/pkg/middleware"
 	"github.com/go-kit/kit/log"
 )
 
 // Service interface for user admin functions
 type Service interface {
-	// register a new user
-	RegisterUser(context.Context, string) (string, error)
+	// register a new user with its profile
+	RegisterUser(context.Context, UserDetails) (UserDetails, error)
 	// get user for a given name
-	GetUser(context.Context, string) (string, error)
+	GetUser(context.Context, string) (UserDetails, error)
+	// get a page of users by name and the cursor of next page
+	ListUsers(context.Context, ListQuery) ([]UserDetails, string, error)
+	// get names of groups a user is member of
+	GetUserGroups(context.Context, string) ([]string, error)
+	// delete user along with its group membership
+	DeleteUser(context.Context, string) error
+	// prevent user from sending and receiving messages
+	DeactivateUser(context.Context, string) error
+	// allow deactivated user to send and receive messages again
+	ActivateUser(context.Context, string) error
+	// change role of a user
+	SetUserRole(context.Context, string, string) error
 	// register a new group
 	RegisterGroup(context.Context, string, []string) (string, error)
-	// get users for a groups
-	GetGroupUsers(context.Context, string) ([]string, error)
+	// get a group with its users and posting policy
+	GetGroup(context.Context, string) (GroupDetails, error)
+	// get a page of group names and the cursor of next page
+	ListGroups(context.Context, ListQuery) ([]string, string, error)
+	// add users to a group
+	AddGroupUsers(context.Context, string, []string) error
+	// remove a user from a group
+	RemoveGroupUser(context.Context, string, string) error
+	// delete a group along with its membership
+	DeleteGroup(context.Context, string) error
+	// change posting policy of a group
+	SetGroupPolicy(context.Context, string, string) error
+	// make a member of a group its moderator or revoke it
+	SetGroupModerator(context.Context, string, string, bool) error
 }
 
 // Create a new service instance with a given user repository
@@ -29,30 +54,41 @@ type service struct {
 	repository UserRepository
 }
 
-func (s *service) RegisterUser(ctx context.Context, username string) (id string, err error) {
+func (s *service) RegisterUser(ctx context.Context, u UserDetails) (registered UserDetails, err error) {
 	defer func(begin time.Time) {
 		svcLogger := log.With(ctxlog.Logger(ctx), "component", "service")
 		svcLogger.Log(
 			"method", "register user",
-			"username", username,
+			"username", u.Id,
 			"took", time.Since(begin),
 			"err", err,
 		)
 	}(time.Now())
 	{
-		exists, err := s.repository.FindUser(ctx, username)
+		exists, err := s.repository.FindUser(ctx, u.Id)
 		if exists {
-			return "", ErrUserExists
+			return UserDetails{}, ErrUserExists
 		}
 		if err != nil {
-			return "", err
+			return UserDetails{}, err
 		}
 	}
-	id, err = s.repository.StoreUser(ctx, username)
-	return id, err
+	record := User{
+		Name:        u.Id,
+		DisplayName: u.DisplayName,
+		Email:       u.Email,
+		CreatedAt:   time.Now().UTC().Truncate(time.Second),
+		Attributes:  u.Attributes,
+		Role:        RoleMember,
+	}
+	_, err = s.repository.StoreUser(ctx, record)
+	if err != nil {
+		return UserDetails{}, err
+	}
+	return mapUser(record), nil
 }
 
-func (s *service) GetUser(ctx context.Context, username string) (user string, err error) {
+func (s *service) GetUser(ctx context.Context, username string) (u UserDetails, err error) {
 	defer func(begin time.Time) {
 		svcLogger := log.With(ctxlog.Logger(ctx), "component", "service")
 		svcLogger.Log(
@@ -62,15 +98,130 @@ func (s *service) GetUser(ctx context.Context, username string) (user string, er
 			"err", err,
 		)
 	}(time.Now())
-	{
-		var exists bool
-		exists, err = s.repository.FindUser(ctx, username)
-		if exists {
-			user = username
-			return user, nil
-		}
-		return "", ErrUserNotFound
+	var record User
+	record, err = s.repository.FetchUser(ctx, username)
+	if err != nil {
+		return UserDetails{}, err
+	}
+	u = mapUser(record)
+	return u, nil
+}
+
+func (s *service) ListUsers(ctx context.Context, query ListQuery) (users []UserDetails, next string, err error) {
+	defer func(begin time.Time) {
+		svcLogger := log.With(ctxlog.Logger(ctx), "component", "service")
+		svcLogger.Log(
+			"method", "list users",
+			"prefix", query.Prefix,
+			"limit", query.Limit,
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+	var records []User
+	records, next, err = s.repository.ListUsers(ctx, query)
+	if err != nil {
+		return nil, "", err
+	}
+	users = make([]UserDetails, 0, len(records))
+	for _, record := range records {
+		users = append(users, mapUser(record))
+	}
+	return users, next, nil
+}
+
+func (s *service) GetUserGroups(ctx context.Context, username string) (groups []string, err error) {
+	defer func(begin time.Time) {
+		svcLogger := log.With(ctxlog.Logger(ctx), "component", "service")
+		svcLogger.Log(
+			"method", "get user groups",
+			"username", username,
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+	var exists bool
+	exists, err = s.repository.FindUser(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+	groups, err = s.repository.FetchUserGroups(ctx, username)
+	return groups, err
+}
+
+func (s *service) DeleteUser(ctx context.Context, username string) (err error) {
+	defer func(begin time.Time) {
+		svcLogger := log.With(ctxlog.Logger(ctx), "component", "service")
+		svcLogger.Log(
+			"method", "delete user",
+			"username", username,
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+	if err = s.authorizeAdmin(ctx); err != nil {
+		return err
 	}
+	err = s.repository.DeleteUser(ctx, username)
+	return err
+}
+
+func (s *service) DeactivateUser(ctx context.Context, username string) (err error) {
+	defer func(begin time.Time) {
+		svcLogger := log.With(ctxlog.Logger(ctx), "component", "service")
+		svcLogger.Log(
+			"method", "deactivate user",
+			"username", username,
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+	if err = s.authorizeAdmin(ctx); err != nil {
+		return err
+	}
+	err = s.repository.SetUserDeactivated(ctx, username, true)
+	return err
+}
+
+func (s *service) ActivateUser(ctx context.Context, username string) (err error) {
+	defer func(begin time.Time) {
+		svcLogger := log.With(ctxlog.Logger(ctx), "component", "service")
+		svcLogger.Log(
+			"method", "activate user",
+			"username", username,
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+	if err = s.authorizeAdmin(ctx); err != nil {
+		return err
+	}
+	err = s.repository.SetUserDeactivated(ctx, username, false)
+	return err
+}
+
+func (s *service) SetUserRole(ctx context.Context, username string, role string) (err error) {
+	defer func(begin time.Time) {
+		svcLogger := log.With(ctxlog.Logger(ctx), "component", "service")
+		svcLogger.Log(
+			"method", "set user role",
+			"username", username,
+			"role", role,
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+	if role != RoleAdmin && role != RoleMember {
+		return ErrBadRequest
+	}
+	if err = s.authorizeAdmin(ctx); err != nil {
+		return err
+	}
+	err = s.repository.SetUserRole(ctx, username, role)
+	return err
 }
 
 func (s *service) RegisterGroup(ctx context.Context, groupname string, usernames []string) (id string, err error) {
@@ -83,6 +234,9 @@ func (s *service) RegisterGroup(ctx context.Context, groupname string, usernames
 			"err", err,
 		)
 	}(time.Now())
+	if err = s.authorizeAdmin(ctx); err != nil {
+		return "", err
+	}
 	{
 		if usernamesEmpty(usernames) {
 			return "", ErrGroupEmpty
@@ -99,26 +253,213 @@ func (s *service) RegisterGroup(ctx context.Context, groupname string, usernames
 	return id, err
 }
 
-func (s *service) GetGroupUsers(ctx context.Context, groupname string) (users []string, err error) {
+func (s *service) GetGroup(ctx context.Context, groupname string) (g GroupDetails, err error) {
+	defer func(begin time.Time) {
+		svcLogger := log.With(ctxlog.Logger(ctx), "component", "service")
+		svcLogger.Log(
+			"method", "get group",
+			"groupname", groupname,
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+	var record Group
+	record, err = s.repository.FetchGroup(ctx, groupname)
+	if err != nil {
+		return GroupDetails{}, err
+	}
+	g = GroupDetails{
+		Groupname:  record.Name,
+		Usernames:  record.Members,
+		Policy:     record.Policy,
+		Moderators: record.Moderators,
+	}
+	return g, nil
+}
+
+func (s *service) ListGroups(ctx context.Context, query ListQuery) (groups []string, next string, err error) {
 	defer func(begin time.Time) {
 		svcLogger := log.With(ctxlog.Logger(ctx), "component", "service")
 		svcLogger.Log(
-			"method", "get group users",
+			"method", "list groups",
+			"prefix", query.Prefix,
+			"limit", query.Limit,
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+	groups, next, err = s.repository.ListGroups(ctx, query)
+	return groups, next, err
+}
+
+func (s *service) AddGroupUsers(ctx context.Context, groupname string, usernames []string) (err error) {
+	defer func(begin time.Time) {
+		svcLogger := log.With(ctxlog.Logger(ctx), "component", "service")
+		svcLogger.Log(
+			"method", "add group users",
 			"groupname", groupname,
+			"usernames", len(usernames),
 			"took", time.Since(begin),
 			"err", err,
 		)
 	}(time.Now())
+	if err = s.authorizeModerator(ctx, groupname); err != nil {
+		return err
+	}
+	if usernamesEmpty(usernames) {
+		return ErrBadRequest
+	}
 	var exists bool
 	exists, err = s.repository.FindGroup(ctx, groupname)
+	if err != nil {
+		return err
+	}
 	if !exists {
-		return nil, ErrGroupNotFound
+		return ErrGroupNotFound
+	}
+	for _, username := range usernames {
+		exists, err = s.repository.FindUser(ctx, username)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrUserNotFound
+		}
+	}
+	err = s.repository.AddGroupUsers(ctx, groupname, usernames)
+	return err
+}
+
+func (s *service) RemoveGroupUser(ctx context.Context, groupname string, username string) (err error) {
+	defer func(begin time.Time) {
+		svcLogger := log.With(ctxlog.Logger(ctx), "component", "service")
+		svcLogger.Log(
+			"method", "remove group user",
+			"groupname", groupname,
+			"username", username,
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+	// members may leave a group on their own
+	if subject, _ := middleware.Subject(ctx); subject != username {
+		if err = s.authorizeModerator(ctx, groupname); err != nil {
+			return err
+		}
+	}
+	err = s.repository.RemoveGroupUser(ctx, groupname, username)
+	return err
+}
+
+func (s *service) DeleteGroup(ctx context.Context, groupname string) (err error) {
+	defer func(begin time.Time) {
+		svcLogger := log.With(ctxlog.Logger(ctx), "component", "service")
+		svcLogger.Log(
+			"method", "delete group",
+			"groupname", groupname,
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+	if err = s.authorizeAdmin(ctx); err != nil {
+		return err
+	}
+	err = s.repository.DeleteGroup(ctx, groupname)
+	return err
+}
+
+func (s *service) SetGroupPolicy(ctx context.Context, groupname string, policy string) (err error) {
+	defer func(begin time.Time) {
+		svcLogger := log.With(ctxlog.Logger(ctx), "component", "service")
+		svcLogger.Log(
+			"method", "set group policy",
+			"groupname", groupname,
+			"policy", policy,
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+	if policy != PolicyOpen && policy != PolicyMembers && policy != PolicyAnnounce {
+		return ErrBadRequest
+	}
+	if err = s.authorizeAdmin(ctx); err != nil {
+		return err
+	}
+	err = s.repository.SetGroupPolicy(ctx, groupname, policy)
+	return err
+}
+
+func (s *service) SetGroupModerator(ctx context.Context, groupname string, username string, moderator bool) (err error) {
+	defer func(begin time.Time) {
+		svcLogger := log.With(ctxlog.Logger(ctx), "component", "service")
+		svcLogger.Log(
+			"method", "set group moderator",
+			"groupname", groupname,
+			"username", username,
+			"moderator", moderator,
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+	if err = s.authorizeAdmin(ctx); err != nil {
+		return err
+	}
+	err = s.repository.SetGroupModerator(ctx, groupname, username, moderator)
+	return err
+}
+
+// Check that an authenticated request is made by an active admin. Requests
+// that are not authenticated are not restricted.
+func (s *service) authorizeAdmin(ctx context.Context) error {
+	subject, ok := middleware.Subject(ctx)
+	if !ok {
+		return nil
+	}
+	record, err := s.repository.FetchUser(ctx, subject)
+	if err == ErrUserNotFound {
+		return ErrForbidden
 	}
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if record.Role != RoleAdmin || record.Deactivated {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// Check that an authenticated request is made by an admin or by a moderator
+// of given group.
+func (s *service) authorizeModerator(ctx context.Context, groupname string) error {
+	err := s.authorizeAdmin(ctx)
+	if err != ErrForbidden {
+		return err
+	}
+	subject, _ := middleware.Subject(ctx)
+	record, err := s.repository.FetchGroup(ctx, groupname)
+	if err != nil {
+		return err
+	}
+	if !contains(record.Moderators, subject) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// Map repository user to transport user structure.
+func mapUser(record User) UserDetails {
+	u := UserDetails{
+		Id:          record.Name,
+		DisplayName: record.DisplayName,
+		Email:       record.Email,
+		Attributes:  record.Attributes,
+		Deactivated: record.Deactivated,
+		Role:        record.Role,
+	}
+	if !record.CreatedAt.IsZero() {
+		u.CreatedAt = record.CreatedAt.Format(time.RFC3339)
 	}
-	users, err = s.repository.FetchGroupUsers(ctx, groupname)
-	return users, err
+	return u
 }
 
 func usernamesEmpty(names []string) bool {
@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
+	"net/mail"
+	"strconv"
 
 	"github.com/gorilla/mux"
 
@@ -13,6 +15,7 @@ import (
 	kithttp "github.com/go-kit/kit/transport/http"
 
 	"github.com/ghsbhatia/msgbox/pkg/middleware"
+	"github.com/ghsbhatia/msgbox/pkg/useradmin/api"
 )
 
 // Create http.Handler instance for servicing useradmin requests
@@ -34,6 +37,24 @@ func MakeHandler(service Service, logger kitlog.Logger) http.Handler {
 
 	r.Handle("/users", userRegistrationHandler).Methods("POST")
 
+	userListHandler := kithttp.NewServer(
+		makeUserListEndpoint(service),
+		decodeListRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	r.Handle("/users", userListHandler).Methods("GET")
+
+	userGroupsQueryHandler := kithttp.NewServer(
+		makeUserGroupsQueryEndpoint(service),
+		decodeUserQueryRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	r.Handle("/users/{userid}/groups", userGroupsQueryHandler).Methods("GET")
+
 	userQueryHandler := kithttp.NewServer(
 		makeUserQueryEndpoint(service),
 		decodeUserQueryRequest,
@@ -43,6 +64,42 @@ func MakeHandler(service Service, logger kitlog.Logger) http.Handler {
 
 	r.Handle("/users/{userid}", userQueryHandler).Methods("GET")
 
+	userDeleteHandler := kithttp.NewServer(
+		makeUserDeleteEndpoint(service),
+		decodeUserQueryRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	r.Handle("/users/{userid}", userDeleteHandler).Methods("DELETE")
+
+	userDeactivateHandler := kithttp.NewServer(
+		makeUserDeactivateEndpoint(service),
+		decodeUserQueryRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	r.Handle("/users/{userid}/deactivate", userDeactivateHandler).Methods("POST")
+
+	userActivateHandler := kithttp.NewServer(
+		makeUserActivateEndpoint(service),
+		decodeUserQueryRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	r.Handle("/users/{userid}/activate", userActivateHandler).Methods("POST")
+
+	userRoleHandler := kithttp.NewServer(
+		makeUserRoleEndpoint(service),
+		decodeUserRoleRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	r.Handle("/users/{userid}/role", userRoleHandler).Methods("PUT")
+
 	groupRegistrationHandler := kithttp.NewServer(
 		makeGroupRegistrationEndpoint(service),
 		decodeGroupRegistrationRequest,
@@ -52,6 +109,15 @@ func MakeHandler(service Service, logger kitlog.Logger) http.Handler {
 
 	r.Handle("/groups", groupRegistrationHandler).Methods("POST")
 
+	groupListHandler := kithttp.NewServer(
+		makeGroupListEndpoint(service),
+		decodeListRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	r.Handle("/groups", groupListHandler).Methods("GET")
+
 	groupQueryHandler := kithttp.NewServer(
 		makeGroupQueryEndpoint(service),
 		decodeGroupQueryRequest,
@@ -61,15 +127,84 @@ func MakeHandler(service Service, logger kitlog.Logger) http.Handler {
 
 	r.Handle("/groups/{groupid}", groupQueryHandler).Methods("GET")
 
+	groupDeleteHandler := kithttp.NewServer(
+		makeGroupDeleteEndpoint(service),
+		decodeGroupQueryRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	r.Handle("/groups/{groupid}", groupDeleteHandler).Methods("DELETE")
+
+	groupMembersAddHandler := kithttp.NewServer(
+		makeGroupMembersAddEndpoint(service),
+		decodeGroupMembersAddRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	r.Handle("/groups/{groupid}/members", groupMembersAddHandler).Methods("POST")
+
+	groupMemberRemoveHandler := kithttp.NewServer(
+		makeGroupMemberRemoveEndpoint(service),
+		decodeGroupMemberRemoveRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	r.Handle("/groups/{groupid}/members/{userid}", groupMemberRemoveHandler).Methods("DELETE")
+
+	groupPolicyHandler := kithttp.NewServer(
+		makeGroupPolicyEndpoint(service),
+		decodeGroupPolicyRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	r.Handle("/groups/{groupid}/policy", groupPolicyHandler).Methods("PUT")
+
+	groupModeratorAddHandler := kithttp.NewServer(
+		makeGroupModeratorEndpoint(service, true),
+		decodeGroupMemberRemoveRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	r.Handle("/groups/{groupid}/moderators/{userid}", groupModeratorAddHandler).Methods("PUT")
+
+	groupModeratorRemoveHandler := kithttp.NewServer(
+		makeGroupModeratorEndpoint(service, false),
+		decodeGroupMemberRemoveRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	r.Handle("/groups/{groupid}/moderators/{userid}", groupModeratorRemoveHandler).Methods("DELETE")
+
 	return middleware.NewHTTPInterceptor(r, logger)
 }
 
+const (
+	// number of users or groups in a page when client does not specify limit
+	defaultPageLimit = 50
+	// maximum number of users or groups in a page
+	maxPageLimit = 500
+	// maximum length of display name of a user
+	maxDisplayNameLength = 64
+)
+
+// UserDetails of a registered user as returned by the service
+type UserDetails = api.UserDetails
+
 type userRegistrationRequest struct {
-	Username string `json:"username"`
+	Username    string            `json:"username"`
+	DisplayName string            `json:"displayName,omitempty"`
+	Email       string            `json:"email,omitempty"`
+	Attributes  map[string]string `json:"attributes,omitempty"`
 }
 
 type userRegistrationResponse struct {
-	Id string `json:"id"`
+	UserDetails
 }
 
 func (m *userRegistrationResponse) StatusCode() int {
@@ -81,13 +216,46 @@ type userQueryRequest struct {
 }
 
 type userQueryResponse struct {
-	Id string `json:"id"`
+	UserDetails
 }
 
 func (m *userQueryResponse) StatusCode() int {
 	return http.StatusOK
 }
 
+type userRoleRequest struct {
+	Username string `json:"-"`
+	Role     string `json:"role"`
+}
+
+type userListResponse struct {
+	Users      []UserDetails `json:"users"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+func (m *userListResponse) StatusCode() int {
+	return http.StatusOK
+}
+
+type group struct {
+	Groupname string `json:"groupname"`
+}
+
+type groupListResponse struct {
+	Groups     []group `json:"groups"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+func (m *groupListResponse) StatusCode() int {
+	return http.StatusOK
+}
+
+type userUpdateResponse struct{}
+
+func (m *userUpdateResponse) StatusCode() int {
+	return http.StatusNoContent
+}
+
 type groupRegistrationRequest struct {
 	Groupname string   `json:"groupname"`
 	Usernames []string `json:"usernames"`
@@ -105,23 +273,52 @@ type groupQueryRequest struct {
 	Groupname string
 }
 
+// GroupDetails of a registered group with its users and posting policy
+type GroupDetails = api.GroupDetails
+
 type groupQueryResponse struct {
-	Groupname string   `json:"groupname"`
-	Usernames []string `json:"usernames"`
+	GroupDetails
 }
 
 func (m *groupQueryResponse) StatusCode() int {
 	return http.StatusOK
 }
 
+type groupMembersAddRequest struct {
+	Groupname string   `json:"-"`
+	Usernames []string `json:"usernames"`
+}
+
+type groupMemberRemoveRequest struct {
+	Groupname string
+	Username  string
+}
+
+type groupPolicyRequest struct {
+	Groupname string `json:"-"`
+	Policy    string `json:"policy"`
+}
+
+type groupUpdateResponse struct{}
+
+func (m *groupUpdateResponse) StatusCode() int {
+	return http.StatusNoContent
+}
+
 func makeUserRegistrationEndpoint(s Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		req := request.(userRegistrationRequest)
-		id, err := s.RegisterUser(ctx, req.Username)
+		u := UserDetails{
+			Id:          req.Username,
+			DisplayName: req.DisplayName,
+			Email:       req.Email,
+			Attributes:  req.Attributes,
+		}
+		registered, err := s.RegisterUser(ctx, u)
 		if err != nil {
 			return nil, err
 		}
-		return &userRegistrationResponse{id}, err
+		return &userRegistrationResponse{registered}, err
 	}
 }
 
@@ -136,6 +333,91 @@ func makeUserQueryEndpoint(s Service) endpoint.Endpoint {
 	}
 }
 
+func makeUserListEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(ListQuery)
+		users, next, err := s.ListUsers(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		return &userListResponse{users, next}, err
+	}
+}
+
+func makeUserGroupsQueryEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(userQueryRequest)
+		groupnames, err := s.GetUserGroups(ctx, req.Username)
+		if err != nil {
+			return nil, err
+		}
+		return &groupListResponse{Groups: groupsOf(groupnames)}, err
+	}
+}
+
+func makeGroupListEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(ListQuery)
+		groupnames, next, err := s.ListGroups(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		return &groupListResponse{groupsOf(groupnames), next}, err
+	}
+}
+
+func groupsOf(groupnames []string) []group {
+	groups := make([]group, 0, len(groupnames))
+	for _, groupname := range groupnames {
+		groups = append(groups, group{groupname})
+	}
+	return groups
+}
+
+func makeUserDeleteEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(userQueryRequest)
+		err := s.DeleteUser(ctx, req.Username)
+		if err != nil {
+			return nil, err
+		}
+		return &userUpdateResponse{}, err
+	}
+}
+
+func makeUserDeactivateEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(userQueryRequest)
+		err := s.DeactivateUser(ctx, req.Username)
+		if err != nil {
+			return nil, err
+		}
+		return &userUpdateResponse{}, err
+	}
+}
+
+func makeUserActivateEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(userQueryRequest)
+		err := s.ActivateUser(ctx, req.Username)
+		if err != nil {
+			return nil, err
+		}
+		return &userUpdateResponse{}, err
+	}
+}
+
+func makeUserRoleEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(userRoleRequest)
+		err := s.SetUserRole(ctx, req.Username, req.Role)
+		if err != nil {
+			return nil, err
+		}
+		return &userUpdateResponse{}, err
+	}
+}
+
 func makeGroupRegistrationEndpoint(s Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		req := request.(groupRegistrationRequest)
@@ -150,9 +432,66 @@ func makeGroupRegistrationEndpoint(s Service) endpoint.Endpoint {
 func makeGroupQueryEndpoint(s Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		req := request.(groupQueryRequest)
-		groupname := req.Groupname
-		users, err := s.GetGroupUsers(ctx, groupname)
-		return &groupQueryResponse{Groupname: groupname, Usernames: users}, err
+		group, err := s.GetGroup(ctx, req.Groupname)
+		if err != nil {
+			return nil, err
+		}
+		return &groupQueryResponse{group}, err
+	}
+}
+
+func makeGroupDeleteEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(groupQueryRequest)
+		err := s.DeleteGroup(ctx, req.Groupname)
+		if err != nil {
+			return nil, err
+		}
+		return &groupUpdateResponse{}, err
+	}
+}
+
+func makeGroupMembersAddEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(groupMembersAddRequest)
+		err := s.AddGroupUsers(ctx, req.Groupname, req.Usernames)
+		if err != nil {
+			return nil, err
+		}
+		return &groupUpdateResponse{}, err
+	}
+}
+
+func makeGroupMemberRemoveEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(groupMemberRemoveRequest)
+		err := s.RemoveGroupUser(ctx, req.Groupname, req.Username)
+		if err != nil {
+			return nil, err
+		}
+		return &groupUpdateResponse{}, err
+	}
+}
+
+func makeGroupPolicyEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(groupPolicyRequest)
+		err := s.SetGroupPolicy(ctx, req.Groupname, req.Policy)
+		if err != nil {
+			return nil, err
+		}
+		return &groupUpdateResponse{}, err
+	}
+}
+
+func makeGroupModeratorEndpoint(s Service, moderator bool) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(groupMemberRemoveRequest)
+		err := s.SetGroupModerator(ctx, req.Groupname, req.Username, moderator)
+		if err != nil {
+			return nil, err
+		}
+		return &groupUpdateResponse{}, err
 	}
 }
 
@@ -164,14 +503,34 @@ func decodeUserRegistrationRequest(_ context.Context, r *http.Request) (interfac
 		return nil, err
 	}
 
-	if body.Username == "" {
+	if !validRegistration(&body) {
 		return nil, ErrBadRequest
 	}
 
-	urRequest := userRegistrationRequest{body.Username}
+	return body, nil
 
-	return urRequest, nil
+}
 
+// Check user registration has a username, and a display name and email that
+// are valid when given.
+func validRegistration(req *userRegistrationRequest) bool {
+
+	if req.Username == "" {
+		return false
+	}
+
+	if len(req.DisplayName) > maxDisplayNameLength {
+		return false
+	}
+
+	if req.Email != "" {
+		address, err := mail.ParseAddress(req.Email)
+		if err != nil || address.Address != req.Email {
+			return false
+		}
+	}
+
+	return true
 }
 
 func decodeUserQueryRequest(_ context.Context, r *http.Request) (interface{}, error) {
@@ -181,6 +540,44 @@ func decodeUserQueryRequest(_ context.Context, r *http.Request) (interface{}, er
 	return uqRequest, nil
 }
 
+func decodeUserRoleRequest(_ context.Context, r *http.Request) (interface{}, error) {
+
+	var body userRoleRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+
+	if body.Role != RoleAdmin && body.Role != RoleMember {
+		return nil, ErrBadRequest
+	}
+
+	urRequest := userRoleRequest{mux.Vars(r)["userid"], body.Role}
+
+	return urRequest, nil
+
+}
+
+func decodeListRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	params := r.URL.Query()
+	query := ListQuery{Prefix: params.Get("prefix"), Limit: defaultPageLimit, Cursor: params.Get("cursor")}
+	if limit := params.Get("limit"); len(limit) > 0 {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 || n > maxPageLimit {
+			return nil, ErrBadRequest
+		}
+		query.Limit = n
+	}
+	switch params.Get("sort") {
+	case "", "name":
+	case "-name":
+		query.Descending = true
+	default:
+		return nil, ErrBadRequest
+	}
+	return query, nil
+}
+
 func decodeGroupRegistrationRequest(_ context.Context, r *http.Request) (interface{}, error) {
 
 	var body groupRegistrationRequest
@@ -206,6 +603,50 @@ func decodeGroupQueryRequest(_ context.Context, r *http.Request) (interface{}, e
 	return gqRequest, nil
 }
 
+func decodeGroupMembersAddRequest(_ context.Context, r *http.Request) (interface{}, error) {
+
+	var body groupMembersAddRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+
+	if len(body.Usernames) == 0 {
+		return nil, ErrBadRequest
+	}
+
+	gmaRequest := groupMembersAddRequest{mux.Vars(r)["groupid"], body.Usernames}
+
+	return gmaRequest, nil
+
+}
+
+func decodeGroupMemberRemoveRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	vars := mux.Vars(r)
+	gmrRequest := groupMemberRemoveRequest{vars["groupid"], vars["userid"]}
+	return gmrRequest, nil
+}
+
+func decodeGroupPolicyRequest(_ context.Context, r *http.Request) (interface{}, error) {
+
+	var body groupPolicyRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+
+	switch body.Policy {
+	case PolicyOpen, PolicyMembers, PolicyAnnounce:
+	default:
+		return nil, ErrBadRequest
+	}
+
+	gpRequest := groupPolicyRequest{mux.Vars(r)["groupid"], body.Policy}
+
+	return gpRequest, nil
+
+}
+
 // encode response
 func encodeResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
 	if e, ok := response.(errorer); ok && e.error() != nil {
@@ -231,19 +672,28 @@ type errorer interface {
 // encode request execution error
 func encodeError(_ context.Context, err error, w http.ResponseWriter) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(errorStatus(err))
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": err.Error(),
+	})
+}
+
+// Get http status code for request execution error
+func errorStatus(err error) int {
 	switch err {
 	case ErrUserExists:
-		w.WriteHeader(http.StatusConflict)
+		return http.StatusConflict
 	case ErrGroupExists:
-		w.WriteHeader(http.StatusConflict)
+		return http.StatusConflict
 	case ErrUserNotFound:
-		w.WriteHeader(http.StatusNotFound)
+		return http.StatusNotFound
 	case ErrGroupNotFound:
-		w.WriteHeader(http.StatusNotFound)
+		return http.StatusNotFound
+	case ErrNotGroupMember:
+		return http.StatusNotFound
+	case ErrForbidden:
+		return http.StatusForbidden
 	default:
-		w.WriteHeader(http.StatusBadRequest)
+		return http.StatusBadRequest
 	}
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"error": err.Error(),
-	})
 }
@@ -1,11 +1,16 @@
 package useradmin
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 
+	"github.com/ghsbhatia/msgbox/pkg/middleware"
+	kitlog "github.com/go-kit/kit/log"
 	"github.com/matryer/is"
 )
 
@@ -14,6 +19,9 @@ func TestUser(t *testing.T) {
 	s := &userTestSuite{}
 	t.Run("UserMarshal", func(t *testing.T) { s.testUserMarshal(t) })
 	t.Run("UserUnmarshal", func(t *testing.T) { s.testUserUnMarshal(t) })
+	t.Run("UserProfileUnmarshal", func(t *testing.T) { s.testUserProfileUnMarshal(t) })
+	t.Run("UserInvalidEmail", func(t *testing.T) { s.testUserInvalidEmail(t) })
+	t.Run("UserRegister", func(t *testing.T) { s.testUserRegister(t) })
 }
 
 // Test suite for user creation
@@ -24,7 +32,7 @@ func (s *userTestSuite) testUserMarshal(t *testing.T) {
 
 	is := is.New(t)
 
-	alice := &userRegistrationRequest{"alice"}
+	alice := &userRegistrationRequest{Username: "alice"}
 
 	data, err := json.Marshal(alice)
 
@@ -48,6 +56,72 @@ func (s *userTestSuite) testUserUnMarshal(t *testing.T) {
 
 }
 
+// Test scenario - Decode registration request of a user with profile
+func (s *userTestSuite) testUserProfileUnMarshal(t *testing.T) {
+
+	is := is.New(t)
+
+	body := strings.NewReader(`{
+      "username": "alice",
+      "displayName": "Alice Liddell",
+      "email": "alice@example.com",
+      "attributes": {"team": "wonderland"}
+    }`)
+
+	req := httptest.NewRequest("POST", "http://foo.com/users", body)
+
+	userReg, err := decodeUserRegistrationRequest(context.TODO(), req)
+
+	is.NoErr(err)
+	is.Equal(userReg, userRegistrationRequest{
+		Username:    "alice",
+		DisplayName: "Alice Liddell",
+		Email:       "alice@example.com",
+		Attributes:  map[string]string{"team": "wonderland"},
+	})
+
+}
+
+// Test scenario - Decode registration request of a user with invalid email
+func (s *userTestSuite) testUserInvalidEmail(t *testing.T) {
+
+	is := is.New(t)
+
+	for _, email := range []string{"alice", "Alice <alice@example.com>"} {
+		body := strings.NewReader(`{"username": "alice", "email": "` + email + `"}`)
+		req := httptest.NewRequest("POST", "http://foo.com/users", body)
+		_, err := decodeUserRegistrationRequest(context.TODO(), req)
+		is.Equal(err, ErrBadRequest)
+	}
+
+}
+
+// Test scenario - Register a user and get it back as stored, a member
+func (s *userTestSuite) testUserRegister(t *testing.T) {
+
+	is := is.New(t)
+
+	h := MakeHandler(NewService(NewInMemoryUserRepository()), kitlog.NewNopLogger())
+
+	req := httptest.NewRequest("POST", "http://foo.com/users", strings.NewReader(`{"username":"alice"}`))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	is.Equal(w.Code, http.StatusCreated)
+	var registered UserDetails
+	is.NoErr(json.Unmarshal(w.Body.Bytes(), &registered))
+	is.Equal(registered.Role, RoleMember)
+
+	req = httptest.NewRequest("GET", "http://foo.com/users/alice", nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	is.Equal(w.Code, http.StatusOK)
+	var fetched UserDetails
+	is.NoErr(json.Unmarshal(w.Body.Bytes(), &fetched))
+	is.Equal(fetched, registered)
+}
+
 // Test executor for group creation
 func TestGroup(t *testing.T) {
 	s := &groupTestSuite{}
@@ -97,3 +171,163 @@ func (s *groupTestSuite) testGroupUnMarshal(t *testing.T) {
 	is.Equal(len(grpCreation.Usernames), 3)
 
 }
+
+// Test executor for listing of users and groups
+func TestList(t *testing.T) {
+	s := &listTestSuite{}
+	t.Run("ListRequestDefaults", func(t *testing.T) { s.testListRequestDefaults(t) })
+	t.Run("ListRequest", func(t *testing.T) { s.testListRequest(t) })
+	t.Run("ListRequestInvalid", func(t *testing.T) { s.testListRequestInvalid(t) })
+}
+
+// Test suite for listing of users and groups
+type listTestSuite struct{}
+
+// Test scenario - Decode list request without parameters
+func (s *listTestSuite) testListRequestDefaults(t *testing.T) {
+
+	is := is.New(t)
+
+	req := httptest.NewRequest("GET", "http://foo.com/users", nil)
+
+	query, err := decodeListRequest(context.TODO(), req)
+
+	is.NoErr(err)
+	is.Equal(query, ListQuery{Limit: defaultPageLimit})
+}
+
+// Test scenario - Decode list request with prefix, limit, cursor and sort order
+func (s *listTestSuite) testListRequest(t *testing.T) {
+
+	is := is.New(t)
+
+	req := httptest.NewRequest("GET", "http://foo.com/groups?prefix=eng&limit=10&cursor=abc&sort=-name", nil)
+
+	query, err := decodeListRequest(context.TODO(), req)
+
+	is.NoErr(err)
+	is.Equal(query, ListQuery{Prefix: "eng", Limit: 10, Cursor: "abc", Descending: true})
+}
+
+// Test scenario - Decode list request with invalid limit or sort order
+func (s *listTestSuite) testListRequestInvalid(t *testing.T) {
+
+	is := is.New(t)
+
+	for _, params := range []string{"limit=0", "limit=501", "limit=x", "sort=created"} {
+		req := httptest.NewRequest("GET", "http://foo.com/users?"+params, nil)
+		_, err := decodeListRequest(context.TODO(), req)
+		is.Equal(err, ErrBadRequest)
+	}
+}
+
+// Test executor for roles and group policies
+func TestAuthorization(t *testing.T) {
+	s := &authzTestSuite{}
+	t.Run("PolicyRequestInvalid", func(t *testing.T) { s.testPolicyRequestInvalid(t) })
+	t.Run("AdminOnly", func(t *testing.T) { s.testAdminOnly(t) })
+	t.Run("ModeratorMembership", func(t *testing.T) { s.testModeratorMembership(t) })
+	t.Run("Unauthenticated", func(t *testing.T) { s.testUnauthenticated(t) })
+	t.Run("GroupQuery", func(t *testing.T) { s.testGroupQuery(t) })
+}
+
+// Test suite for roles and group policies
+type authzTestSuite struct{}
+
+// Get a handler over a repository with admin alice, members bob and carol,
+// and group engineering moderated by bob.
+func (s *authzTestSuite) handler() http.Handler {
+	ctx := context.TODO()
+	repository := NewInMemoryUserRepository()
+	repository.StoreUser(ctx, User{Name: "alice", Role: RoleAdmin})
+	repository.StoreUser(ctx, User{Name: "bob"})
+	repository.StoreUser(ctx, User{Name: "carol"})
+	repository.StoreGroup(ctx, "engineering", []string{"bob", "carol"})
+	repository.SetGroupModerator(ctx, "engineering", "bob", true)
+	return MakeHandler(NewService(repository), kitlog.NewNopLogger())
+}
+
+// Serve a request on behalf of given subject, or unauthenticated when the
+// subject is empty, and get the status code.
+func serveAs(h http.Handler, subject, method, target, body string) int {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if len(subject) > 0 {
+		req = req.WithContext(middleware.NewAuthContext(req.Context(), subject, "token"))
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w.Code
+}
+
+// Test scenario - Decode policy and role requests with unknown values
+func (s *authzTestSuite) testPolicyRequestInvalid(t *testing.T) {
+
+	is := is.New(t)
+
+	req := httptest.NewRequest("PUT", "http://foo.com/groups/engineering/policy", strings.NewReader(`{"policy":"closed"}`))
+	_, err := decodeGroupPolicyRequest(context.TODO(), req)
+	is.Equal(err, ErrBadRequest)
+
+	req = httptest.NewRequest("PUT", "http://foo.com/users/bob/role", strings.NewReader(`{"role":"owner"}`))
+	_, err = decodeUserRoleRequest(context.TODO(), req)
+	is.Equal(err, ErrBadRequest)
+}
+
+// Test scenario - Only admins change roles and policies and create groups
+func (s *authzTestSuite) testAdminOnly(t *testing.T) {
+
+	is := is.New(t)
+
+	h := s.handler()
+
+	is.Equal(serveAs(h, "bob", "PUT", "http://foo.com/groups/engineering/policy", `{"policy":"announce"}`), http.StatusForbidden)
+	is.Equal(serveAs(h, "alice", "PUT", "http://foo.com/groups/engineering/policy", `{"policy":"announce"}`), http.StatusNoContent)
+
+	is.Equal(serveAs(h, "bob", "PUT", "http://foo.com/users/bob/role", `{"role":"admin"}`), http.StatusForbidden)
+	is.Equal(serveAs(h, "alice", "PUT", "http://foo.com/users/bob/role", `{"role":"admin"}`), http.StatusNoContent)
+
+	is.Equal(serveAs(h, "carol", "POST", "http://foo.com/groups", `{"groupname":"sales","usernames":["carol"]}`), http.StatusForbidden)
+	is.Equal(serveAs(h, "nobody", "DELETE", "http://foo.com/users/carol", ""), http.StatusForbidden)
+}
+
+// Test scenario - Moderators manage membership and members may leave
+func (s *authzTestSuite) testModeratorMembership(t *testing.T) {
+
+	is := is.New(t)
+
+	h := s.handler()
+
+	is.Equal(serveAs(h, "carol", "POST", "http://foo.com/groups/engineering/members", `{"usernames":["alice"]}`), http.StatusForbidden)
+	is.Equal(serveAs(h, "bob", "POST", "http://foo.com/groups/engineering/members", `{"usernames":["alice"]}`), http.StatusNoContent)
+	is.Equal(serveAs(h, "bob", "PUT", "http://foo.com/groups/engineering/moderators/carol", ""), http.StatusForbidden)
+	is.Equal(serveAs(h, "carol", "DELETE", "http://foo.com/groups/engineering/members/carol", ""), http.StatusNoContent)
+}
+
+// Test scenario - Requests that are not authenticated are not restricted
+func (s *authzTestSuite) testUnauthenticated(t *testing.T) {
+
+	is := is.New(t)
+
+	h := s.handler()
+
+	is.Equal(serveAs(h, "", "PUT", "http://foo.com/groups/engineering/policy", `{"policy":"members"}`), http.StatusNoContent)
+	is.Equal(serveAs(h, "", "PUT", "http://foo.com/groups/engineering/moderators/carol", ""), http.StatusNoContent)
+	is.Equal(serveAs(h, "", "PUT", "http://foo.com/groups/engineering/moderators/alice", ""), http.StatusNotFound)
+}
+
+// Test scenario - Query a group along with its policy and moderators
+func (s *authzTestSuite) testGroupQuery(t *testing.T) {
+
+	is := is.New(t)
+
+	h := s.handler()
+	serveAs(h, "alice", "PUT", "http://foo.com/groups/engineering/policy", `{"policy":"announce"}`)
+
+	req := httptest.NewRequest("GET", "http://foo.com/groups/engineering", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	is.Equal(w.Code, http.StatusOK)
+	is.Equal(strings.TrimSpace(w.Body.String()),
+		`{"groupname":"engineering","usernames":["bob","carol"],"policy":"announce","moderators":["bob"]}`)
+}